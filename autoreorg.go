@@ -0,0 +1,213 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+import (
+	"sync"
+	"time"
+)
+
+// Default number of deletes and overwrites after which fragmentation is
+// evaluated by the background reorganizer.
+const DefaultReorganizeAfter = 1000
+
+// ReorganizeEvent describes an automatic reorganization.  It is passed
+// to the OnReorganize hook (see DatabaseHooks).
+type ReorganizeEvent struct {
+	Fragmentation float64
+	// Fragmentation that triggered the reorganization.
+	SizeBefore int64
+	// File size before reorganization.
+	SizeAfter int64
+	// File size after reorganization.  Zero if it failed.
+	Duration time.Duration
+	// Time spent reorganizing.
+	Err error
+	// Error, if the reorganization failed.
+}
+
+// Automatic reorganization of the database.
+type reorganizer struct {
+	threshold float64
+	// Reorganize when fragmentation exceeds this value.
+	after uint64
+	// Evaluate fragmentation after this number of deletes and
+	// overwrites.
+	idle time.Duration
+	// Idle time required before reorganizing in background.
+	hook func(ReorganizeEvent)
+	churn uint64
+	// Deletes and overwrites since the last evaluation.  Protected by
+	// the database lock.
+	lastWrite time.Time
+	// Time of the last write.  Protected by the database lock.
+	kick chan struct{}
+	// Signals that the churn count is reached.
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// Set up automatic reorganization and start the background goroutine,
+// if requested.
+func (db *Database) startReorganizer(cfg DatabaseConfig) {
+	r := &reorganizer{
+		threshold: cfg.ReorganizeThreshold,
+		after: uint64(cfg.ReorganizeAfter),
+		idle: cfg.ReorganizeIdle,
+		lastWrite: time.Now(),
+	}
+	if r.after == 0 {
+		r.after = DefaultReorganizeAfter
+	}
+	if cfg.Hooks != nil {
+		r.hook = cfg.Hooks.OnReorganize
+	}
+	db.reorg = r
+	if r.idle > 0 {
+		r.kick = make(chan struct{}, 1)
+		r.stop = make(chan struct{})
+		r.done = make(chan struct{})
+		go db.runReorganizer(r)
+	}
+}
+
+// Count deletes and overwrites and wake up the reorganizer if needed.
+// The caller must hold the database lock.
+func (db *Database) noteChurn(n uint) {
+	r := db.reorg
+	if r == nil {
+		return
+	}
+	r.churn += uint64(n)
+	if r.kick != nil && r.churn >= r.after {
+		select {
+		case r.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// MaintenanceTick evaluates the database fragmentation and reorganizes
+// it if the ReorganizeThreshold set in DatabaseConfig is exceeded.  It
+// returns true if the database was reorganized.  If automatic
+// reorganization is not configured, MaintenanceTick does nothing.
+// Evaluating fragmentation synchronizes the database, as Stats does.
+//
+// Use it to schedule reorganization explicitly, e.g. from a periodic
+// maintenance job, instead of or in addition to the idle window set by
+// ReorganizeIdle.
+func (db *Database) MaintenanceTick() (bool, error) {
+	db.sync.Lock()
+	if db.dbf == nil {
+		db.sync.Unlock()
+		return false, ErrNotOpen
+	}
+	r := db.reorg
+	if r == nil {
+		db.sync.Unlock()
+		return false, nil
+	}
+	ev, err := db.maintain()
+	db.sync.Unlock()
+	if ev != nil && r.hook != nil {
+		r.hook(*ev)
+	}
+	if err == nil && ev != nil {
+		err = ev.Err
+	}
+	return ev != nil && ev.Err == nil, err
+}
+
+// Evaluate fragmentation and reorganize the database if it exceeds the
+// threshold.  Returns the event describing the reorganization, or nil if
+// none was attempted.  The caller must hold the database lock.
+func (db *Database) maintain() (*ReorganizeEvent, error) {
+	r := db.reorg
+	r.churn = 0
+	st, err := db.layoutStats()
+	if err != nil {
+		return nil, err
+	}
+	frag := st.Fragmentation()
+	if frag <= r.threshold {
+		return nil, nil
+	}
+	ev := &ReorganizeEvent{Fragmentation: frag, SizeBefore: st.FileSize}
+	start := time.Now()
+	ev.Err = db.reorganize()
+	ev.Duration = time.Since(start)
+	if ev.Err == nil {
+		if st, err = db.layoutStats(); err != nil {
+			ev.Err = err
+		} else {
+			ev.SizeAfter = st.FileSize
+		}
+	}
+	return ev, nil
+}
+
+func (db *Database) runReorganizer(r *reorganizer) {
+	defer close(r.done)
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-r.kick:
+		}
+		// Wait until the database has been idle long enough.
+		for {
+			db.sync.RLock()
+			wait := r.idle - time.Since(r.lastWrite)
+			db.sync.RUnlock()
+			if wait <= 0 {
+				break
+			}
+			t := time.NewTimer(wait)
+			select {
+			case <-r.stop:
+				t.Stop()
+				return
+			case <-t.C:
+			}
+		}
+		db.sync.Lock()
+		var ev *ReorganizeEvent
+		var err error
+		if db.dbf != nil && r.churn >= r.after {
+			ev, err = db.maintain()
+			if err != nil {
+				ev = &ReorganizeEvent{Err: err}
+			}
+		}
+		db.sync.Unlock()
+		if ev != nil && r.hook != nil {
+			r.hook(*ev)
+		}
+	}
+}
+
+// Stop the goroutine and wait for it to terminate.
+func (r *reorganizer) shutdown() {
+	if r.stop == nil {
+		return
+	}
+	r.once.Do(func() {
+		close(r.stop)
+	})
+	<-r.done
+}
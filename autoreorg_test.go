@@ -0,0 +1,209 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const reorgKeys = 1000
+
+var reorgValue = bytes.Repeat([]byte{'x'}, 512)
+
+// Create a database for reorganization tests and fill it with data.
+func openReorgDatabase(t *testing.T, cfg DatabaseConfig) *Database {
+	t.Cleanup(func() {
+		os.Remove(dbname)
+	})
+	cfg.FileName = dbname
+	cfg.Mode = ModeNewdb
+	db, err := OpenConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	for i := 0; i < reorgKeys; i++ {
+		if err := db.Store([]byte(strconv.Itoa(i)), reorgValue, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// Delete most of the keys, leaving every tenth one.
+func fragmentDatabase(t *testing.T, db *Database) {
+	for i := 0; i < reorgKeys; i++ {
+		if i % 10 == 0 {
+			continue
+		}
+		if err := db.Delete([]byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Verify that the keys left by fragmentDatabase are intact.
+func verifyReorgDatabase(t *testing.T, db *Database) {
+	n, err := db.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != reorgKeys / 10 {
+		t.Errorf("expected %d keys, got %d", reorgKeys / 10, n)
+	}
+	for i := 0; i < reorgKeys; i += 10 {
+		v, err := db.Fetch([]byte(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatalf("key %d: %v", i, err)
+		}
+		if !bytes.Equal(v, reorgValue) {
+			t.Fatalf("key %d: bad value", i)
+		}
+	}
+}
+
+func checkReorgEvent(t *testing.T, ev ReorganizeEvent) {
+	if ev.Err != nil {
+		t.Fatal(ev.Err)
+	}
+	if ev.Fragmentation <= 0.5 {
+		t.Errorf("reorganized at fragmentation %f", ev.Fragmentation)
+	}
+	if ev.SizeAfter <= 0 || ev.SizeAfter >= ev.SizeBefore {
+		t.Errorf("file size didn't shrink: %d -> %d", ev.SizeBefore, ev.SizeAfter)
+	}
+}
+
+func TestMaintenanceTick(t *testing.T) {
+	var events []ReorganizeEvent
+	db := openReorgDatabase(t, DatabaseConfig{
+		ReorganizeThreshold: 0.5,
+		Hooks: &DatabaseHooks{OnReorganize: func(ev ReorganizeEvent) {
+			events = append(events, ev)
+		}},
+	})
+
+	done, err := db.MaintenanceTick()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done || len(events) != 0 {
+		t.Fatal("unfragmented database reorganized")
+	}
+
+	fragmentDatabase(t, db)
+	done, err = db.MaintenanceTick()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !done {
+		t.Fatal("fragmented database not reorganized")
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	checkReorgEvent(t, events[0])
+	verifyReorgDatabase(t, db)
+
+	st, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.FileSize != events[0].SizeAfter {
+		t.Errorf("file size %d, reported %d", st.FileSize, events[0].SizeAfter)
+	}
+	if st.Fragmentation() > 0.5 {
+		t.Errorf("fragmentation after reorganize: %f", st.Fragmentation())
+	}
+}
+
+func TestMaintenanceTickDisabled(t *testing.T) {
+	db := openReorgDatabase(t, DatabaseConfig{})
+	fragmentDatabase(t, db)
+	done, err := db.MaintenanceTick()
+	if err != nil || done {
+		t.Errorf("MaintenanceTick returned %v, %v", done, err)
+	}
+	db.Close()
+	if _, err := db.MaintenanceTick(); !errors.Is(err, ErrNotOpen) {
+		t.Errorf("expected ErrNotOpen, got %v", err)
+	}
+}
+
+func TestAutoReorganize(t *testing.T) {
+	events := make(chan ReorganizeEvent, 1)
+	db := openReorgDatabase(t, DatabaseConfig{
+		ReorganizeThreshold: 0.5,
+		ReorganizeAfter: 100,
+		ReorganizeIdle: 50 * time.Millisecond,
+		Hooks: &DatabaseHooks{OnReorganize: func(ev ReorganizeEvent) {
+			events <- ev
+		}},
+	})
+	fragmentDatabase(t, db)
+	select {
+	case ev := <-events:
+		checkReorgEvent(t, ev)
+	case <-time.After(5 * time.Second):
+		t.Fatal("database not reorganized")
+	}
+	verifyReorgDatabase(t, db)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReorganizeChurn(t *testing.T) {
+	db := openReorgDatabase(t, DatabaseConfig{ReorganizeThreshold: 0.5})
+	if db.reorg.churn != 0 {
+		t.Fatalf("insertions counted: %d", db.reorg.churn)
+	}
+
+	// Storing new keys with replace set doesn't count.
+	if err := db.Store([]byte("new"), reorgValue, true); err != nil {
+		t.Fatal(err)
+	}
+	b := db.NewBatch()
+	b.Put([]byte("newer"), reorgValue, true)
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if db.reorg.churn != 0 {
+		t.Errorf("new keys counted: %d", db.reorg.churn)
+	}
+
+	// Overwrites and deletes do.
+	if err := db.Store([]byte("new"), reorgValue, true); err != nil {
+		t.Fatal(err)
+	}
+	b.Put([]byte("newer"), reorgValue, true)
+	b.Put([]byte("newest"), reorgValue, true)
+	b.Delete([]byte("0"))
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if db.reorg.churn != 3 {
+		t.Errorf("expected churn 3, got %d", db.reorg.churn)
+	}
+}
@@ -0,0 +1,125 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+import (
+	"sync"
+	"time"
+)
+
+// SyncStats reports synchronizations of the database with its disk file,
+// made either by Sync or automatically.
+type SyncStats struct {
+	LastSync time.Time
+	// Time of the last successful synchronization.  Zero if there
+	// was none.
+	Syncs uint64
+	// Number of synchronizations.
+	Errors uint64
+	// Number of failed synchronizations.
+	LastError error
+	// Error of the last failed synchronization.
+	PendingWrites uint64
+	// Number of writes since the last successful synchronization.
+}
+
+// SyncStats returns the synchronization statistics.
+func (db *Database) SyncStats() SyncStats {
+	db.sync.RLock()
+	defer db.sync.RUnlock()
+	return db.stats
+}
+
+// Background synchronization of the database.
+type syncer struct {
+	every uint
+	// Synchronize after this number of writes.
+	interval time.Duration
+	// Synchronization interval.
+	onError func(error)
+	kick chan struct{}
+	// Signals that the write count is reached.
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// Start the background synchronization goroutine.
+func (db *Database) startSyncer(cfg DatabaseConfig) {
+	s := &syncer{
+		every: cfg.SyncEvery,
+		interval: cfg.SyncInterval,
+		kick: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if cfg.Hooks != nil {
+		s.onError = cfg.Hooks.OnSyncError
+	}
+	db.syncer = s
+	go db.runSyncer(s)
+}
+
+// Count writes made to the database and wake up the syncer if needed.
+// The caller must hold the database lock.
+func (db *Database) noteWrites(n uint) {
+	db.stats.PendingWrites += uint64(n)
+	if db.reorg != nil {
+		db.reorg.lastWrite = time.Now()
+	}
+	if s := db.syncer; s != nil && s.every > 0 && db.stats.PendingWrites >= uint64(s.every) {
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (db *Database) runSyncer(s *syncer) {
+	defer close(s.done)
+	var tick <-chan time.Time
+	if s.interval > 0 {
+		t := time.NewTicker(s.interval)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-tick:
+		case <-s.kick:
+		}
+		db.sync.Lock()
+		var err error
+		if db.dbf != nil && db.stats.PendingWrites > 0 {
+			err = db.syncFile()
+		}
+		db.sync.Unlock()
+		if err != nil && s.onError != nil {
+			s.onError(err)
+		}
+	}
+}
+
+// Stop the goroutine and wait for it to terminate.
+func (s *syncer) shutdown() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
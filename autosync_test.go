@@ -0,0 +1,138 @@
+package gdbm
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSyncEvery(t *testing.T) {
+	db, err := OpenConfig(DatabaseConfig{FileName: dbname, Mode: ModeNewdb, FileMode: 0666, SyncEvery: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(dbname) })
+	defer db.Close()
+
+	for i := 0; i < 4; i++ {
+		db.Store([]byte(strconv.Itoa(i)), []byte("x"), true)
+	}
+	if st := db.SyncStats(); st.PendingWrites != 4 || st.Syncs != 0 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+	db.Delete([]byte("0"))
+	st := waitSync(t, db, 1)
+	if st.PendingWrites != 0 || st.LastSync.IsZero() || st.Errors != 0 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+
+	b := db.NewBatch()
+	for i := 0; i < 5; i++ {
+		b.Put([]byte(strconv.Itoa(i)), []byte("y"), true)
+	}
+	b.Commit()
+	waitSync(t, db, 2)
+}
+
+func TestLoadPendingWrites(t *testing.T) {
+	db, err := OpenConfig(DatabaseConfig{FileName: dbname, Mode: ModeNewdb, FileMode: 0666, SyncEvery: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(dbname) })
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		db.Store([]byte(strconv.Itoa(i)), []byte("x"), true)
+	}
+	var buf bytes.Buffer
+	if err := db.DumpTo(&buf, AsciiDump); err != nil {
+		if errors.Is(err, ErrNotImplemented) {
+			return
+		}
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		db.Delete([]byte(strconv.Itoa(i)))
+	}
+	if err := db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LoadFrom(&buf, true); err != nil {
+		t.Fatal(err)
+	}
+	if st := db.SyncStats(); st.PendingWrites != 5 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+
+	db.Close()
+	if err := db.Load(DumpConfig{FileName: dbname}); !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Load on a closed database returned %v", err)
+	}
+}
+
+func TestSyncInterval(t *testing.T) {
+	db, err := OpenConfig(DatabaseConfig{FileName: dbname, Mode: ModeNewdb, FileMode: 0666, SyncInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(dbname) })
+
+	time.Sleep(30 * time.Millisecond)
+	if st := db.SyncStats(); st.Syncs != 0 {
+		t.Errorf("synchronized without writes: %+v", st)
+	}
+	db.Store([]byte("a"), []byte("b"), true)
+	waitSync(t, db, 1)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-db.syncer.done:
+	default:
+		t.Error("sync goroutine not stopped")
+	}
+	if err := db.Close(); err != ErrNotOpen {
+		t.Errorf("second Close returned %v", err)
+	}
+}
+
+func TestSyncManual(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	db, err := Open(dbname, ModeWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.syncer != nil {
+		t.Error("syncer started without configuration")
+	}
+	db.Store([]byte("a"), []byte("b"), true)
+	if err := db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if st := db.SyncStats(); st.Syncs != 1 || st.PendingWrites != 0 || st.LastSync.IsZero() {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+}
+
+// Wait until the number of synchronizations reaches n.
+func waitSync(t *testing.T, db *Database, n uint64) SyncStats {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st := db.SyncStats()
+		if st.Syncs >= n {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for sync: %+v", st)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
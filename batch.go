@@ -0,0 +1,274 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+/*
+#include <stdlib.h>
+#include <errno.h>
+#include <gdbm.h>
+
+#if !(GDBM_VERSION_MAJOR > 1 || GDBM_VERSION_MINOR > 12)
+static inline int batch_last_errno(GDBM_FILE f) { return gdbm_errno; }
+static inline int batch_last_syserr(GDBM_FILE f) { return errno; }
+static inline int batch_check_syserr(gdbm_error n)
+{
+    switch (n) {
+	case GDBM_FILE_OPEN_ERROR:
+	case GDBM_FILE_WRITE_ERROR:
+	case GDBM_FILE_SEEK_ERROR:
+	case GDBM_FILE_READ_ERROR:
+	case GDBM_FILE_STAT_ERROR:
+	case GDBM_FILE_TRUNCATE_ERROR:
+	    return 1;
+    }
+    return 0;
+}
+#else
+static inline int batch_last_errno(GDBM_FILE f) { return gdbm_last_errno(f); }
+static inline int batch_last_syserr(GDBM_FILE f) { return gdbm_last_syserr(f); }
+static inline int batch_check_syserr(gdbm_error n) { return gdbm_check_syserr(n); }
+#endif
+
+enum {
+    BATCH_INSERT,
+    BATCH_REPLACE,
+    BATCH_DELETE
+};
+
+struct batch_op {
+    int op;           // Operation code.
+    size_t koff;      // Key offset in the buffer.
+    size_t klen;      // Key length.
+    size_t voff;      // Value offset.
+    size_t vlen;      // Value length.
+    int err;          // On return: GDBM error code, or 0.
+    int syserr;       // On return: system error code, or 0.
+    int existed;      // On return: 1 if BATCH_REPLACE overwrote a key.
+};
+
+// Apply n operations from ops, taking keys and values from buf.  If
+// overwrites is not 0, set the existed field of BATCH_REPLACE operations.
+// Return the number of failed operations.
+static int apply_batch(GDBM_FILE dbf, char *buf, struct batch_op *ops, size_t n,
+		       int overwrites)
+{
+    size_t i;
+    int failed = 0;
+
+    for (i = 0; i < n; i++) {
+	struct batch_op *op = &ops[i];
+	datum key, value;
+	int rc;
+
+	key.dptr = buf + op->koff;
+	key.dsize = op->klen;
+	op->existed = 0;
+	switch (op->op) {
+	case BATCH_DELETE:
+	    rc = gdbm_delete(dbf, key);
+	    break;
+	default:
+	    value.dptr = buf + op->voff;
+	    value.dsize = op->vlen;
+	    if (overwrites && op->op == BATCH_REPLACE)
+		op->existed = gdbm_exists(dbf, key) == 1;
+	    rc = gdbm_store(dbf, key, value,
+			    op->op == BATCH_REPLACE ? GDBM_REPLACE : GDBM_INSERT);
+	}
+	if (rc) {
+	    op->err = batch_last_errno(dbf);
+	    op->syserr = batch_check_syserr(op->err) ? batch_last_syserr(dbf) : 0;
+	    failed++;
+	} else {
+	    op->err = 0;
+	    op->syserr = 0;
+	}
+    }
+    return failed;
+}
+*/
+import "C"
+
+import (
+	"strconv"
+	"syscall"
+)
+
+// Batch collects Store and Delete operations and applies them to the
+// database at once, under a single lock and with a single call into the
+// library.  This considerably speeds up bulk updates.
+//
+// Example:
+//	b := db.NewBatch()
+//	for _, rec := range records {
+//		b.Put(rec.Key, rec.Value, true)
+//	}
+//	if err := b.Commit(); err != nil {
+//		panic(err)
+//	}
+//
+// A Batch is not safe for concurrent use.
+type Batch struct {
+	db *Database
+	buf []byte
+	ops []C.struct_batch_op
+}
+
+// NewBatch returns an empty batch for the database.
+func (db *Database) NewBatch() *Batch {
+	return &Batch{db: db}
+}
+
+func (b *Batch) add(op C.int, key, value []byte) {
+	var bop C.struct_batch_op
+	bop.op = op
+	bop.koff = C.size_t(len(b.buf))
+	bop.klen = C.size_t(len(key))
+	b.buf = append(b.buf, key...)
+	bop.voff = C.size_t(len(b.buf))
+	bop.vlen = C.size_t(len(value))
+	b.buf = append(b.buf, value...)
+	b.ops = append(b.ops, bop)
+}
+
+// Put adds a store operation to the batch.  The replace parameter has the
+// same meaning as in Database.Store.  Key and value are copied, so the
+// caller is free to reuse them.
+func (b *Batch) Put(key, value []byte, replace bool) {
+	op := C.int(C.BATCH_INSERT)
+	if replace {
+		op = C.BATCH_REPLACE
+	}
+	b.add(op, key, value)
+}
+
+// Delete adds a delete operation to the batch.
+func (b *Batch) Delete(key []byte) {
+	b.add(C.BATCH_DELETE, key, nil)
+}
+
+// Len returns the number of operations in the batch.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Reset removes all operations from the batch.
+func (b *Batch) Reset() {
+	b.buf = b.buf[:0]
+	b.ops = b.ops[:0]
+}
+
+// BatchError reports operations of a batch that failed.
+type BatchError struct {
+	Errors []error
+	// Errors of the individual operations, in the order they were
+	// added to the batch.  Successful operations have nil errors.
+	Failed int
+	// Number of failed operations.
+}
+
+func (err *BatchError) Error() string {
+	msg := strconv.Itoa(err.Failed) + " of " + strconv.Itoa(len(err.Errors)) +
+		" batch operations failed"
+	for i, e := range err.Errors {
+		if e != nil {
+			msg += "; operation " + strconv.Itoa(i) + ": " + e.Error()
+			break
+		}
+	}
+	return msg
+}
+
+// Unwrap returns the errors of failed operations.
+func (err *BatchError) Unwrap() []error {
+	var res []error
+	for _, e := range err.Errors {
+		if e != nil {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// Commit applies all operations to the database, in the order they were
+// added, and resets the batch.  Failure of an operation does not prevent
+// the subsequent ones from being applied.  If any operations failed,
+// Commit returns a *BatchError describing them.
+func (b *Batch) Commit() error {
+	defer b.Reset()
+	if len(b.ops) == 0 {
+		return nil
+	}
+
+	db := b.db
+	db.sync.Lock()
+	defer db.sync.Unlock()
+	if db.dbf == nil {
+		return ErrNotOpen
+	}
+
+	// Both slices contain no Go pointers and are not retained by the
+	// C code, so they can be passed directly, without copying.
+	// Replaces count as churn only if they overwrite existing keys,
+	// which requires an extra lookup.  Skip it unless needed.
+	overwrites := C.int(0)
+	if db.reorg != nil {
+		overwrites = 1
+	}
+	failed := C.apply_batch(db.dbf, bytesPtr(b.buf), &b.ops[0], C.size_t(len(b.ops)), overwrites)
+	db.noteWrites(uint(len(b.ops) - int(failed)))
+	if db.reorg != nil {
+		churn := uint(0)
+		for _, op := range b.ops {
+			if op.err == 0 && (op.op == C.BATCH_DELETE || op.existed != 0) {
+				churn++
+			}
+		}
+		db.noteChurn(churn)
+	}
+	if db.index != nil || db.compact != nil {
+		for _, op := range b.ops {
+			if op.err == 0 {
+				key := b.buf[op.koff:op.koff+op.klen]
+				db.noteDirty(key)
+				if db.index == nil {
+					continue
+				}
+				if op.op == C.BATCH_DELETE {
+					db.index.remove(key)
+				} else {
+					db.index.insert(key)
+				}
+			}
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+
+	berr := &BatchError{Errors: make([]error, len(b.ops)), Failed: int(failed)}
+	for i, op := range b.ops {
+		if op.err != 0 {
+			var syserr error
+			if op.syserr != 0 {
+				syserr = syscall.Errno(op.syserr)
+			}
+			berr.Errors[i] = &GdbmError{errorCode: int(op.err), sysError: syserr}
+		}
+	}
+	return berr
+}
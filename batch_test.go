@@ -0,0 +1,228 @@
+package gdbm
+
+import (
+	"testing"
+	"errors"
+	"path/filepath"
+	"strconv"
+)
+
+func TestBatch(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+
+	db, err := Open(dbname, ModeWriter)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	b := db.NewBatch()
+	b.Put([]byte("eleven"), []byte("11"), false)
+	b.Put([]byte("one"), []byte("ONE"), false)   // fails: exists
+	b.Put([]byte("two"), []byte("TWO"), true)
+	b.Delete([]byte("three"))
+	b.Delete([]byte("zero"))                     // fails: not found
+	b.Put([]byte{}, []byte{}, false)
+	if b.Len() != 6 {
+		t.Fatalf("Expected 6 operations, got %d", b.Len())
+	}
+
+	err = b.Commit()
+	var berr *BatchError
+	if !errors.As(err, &berr) {
+		t.Fatal("Expected BatchError, got ", err)
+	}
+	if berr.Failed != 2 {
+		t.Errorf("Expected 2 failures, got %d", berr.Failed)
+	}
+	for i, e := range berr.Errors {
+		switch i {
+		case 1:
+			if !errors.Is(e, ErrCannotReplace) {
+				t.Errorf("Operation %d: unexpected error %v", i, e)
+			}
+		case 4:
+			if !errors.Is(e, ErrItemNotFound) {
+				t.Errorf("Operation %d: unexpected error %v", i, e)
+			}
+		default:
+			if e != nil {
+				t.Errorf("Operation %d: unexpected error %v", i, e)
+			}
+		}
+	}
+	if !errors.Is(err, ErrCannotReplace) {
+		t.Error("errors.Is failed on BatchError")
+	}
+	if b.Len() != 0 {
+		t.Error("Batch not reset after Commit")
+	}
+
+	for key, expected := range map[string]string{
+		"eleven": "11",
+		"one": "0",
+		"two": "TWO",
+		"": "",
+	} {
+		val, err := db.Fetch([]byte(key))
+		if err != nil {
+			t.Errorf("Fetch %q: %v", key, err)
+		} else if string(val) != expected {
+			t.Errorf("Fetch %q: expected %q, got %q", key, expected, val)
+		}
+	}
+	if db.Exists([]byte("three")) {
+		t.Error("Key not deleted")
+	}
+
+	b.Put([]byte("twelve"), []byte("12"), false)
+	if err = b.Commit(); err != nil {
+		t.Error("Commit: ", err)
+	}
+}
+
+func TestBatchReader(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	b := db.NewBatch()
+	b.Put([]byte("eleven"), []byte("11"), false)
+	if err := b.Commit(); !errors.Is(err, ErrReaderCantStore) {
+		t.Error("Unexpected error: ", err)
+	}
+}
+
+const benchValueSize = 100
+
+func benchDatabase(b *testing.B) *Database {
+	db, err := Open(filepath.Join(b.TempDir(), "bench.gdbm"), ModeNewdb)
+	if err != nil {
+		b.Fatal("Can't create the database:", err)
+	}
+	b.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+func benchKeys(n int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = []byte("key" + strconv.Itoa(i))
+	}
+	return keys
+}
+
+func BenchmarkStore(b *testing.B) {
+	db := benchDatabase(b)
+	keys := benchKeys(b.N)
+	value := make([]byte, benchValueSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := db.Store(keys[i], value, true); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkBatch(b *testing.B, size int) {
+	db := benchDatabase(b)
+	keys := benchKeys(b.N)
+	value := make([]byte, benchValueSize)
+	batch := db.NewBatch()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		batch.Put(keys[i], value, true)
+		if batch.Len() == size {
+			if err := batch.Commit(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkBatch10(b *testing.B) {
+	benchmarkBatch(b, 10)
+}
+
+func BenchmarkBatch100(b *testing.B) {
+	benchmarkBatch(b, 100)
+}
+
+func BenchmarkBatch1000(b *testing.B) {
+	benchmarkBatch(b, 1000)
+}
+
+func BenchmarkDelete(b *testing.B) {
+	db := benchDatabase(b)
+	keys := benchKeys(b.N)
+	for _, key := range keys {
+		db.Store(key, key, true)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := db.Delete(keys[i]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBatchDelete(b *testing.B) {
+	db := benchDatabase(b)
+	keys := benchKeys(b.N)
+	for _, key := range keys {
+		db.Store(key, key, true)
+	}
+	batch := db.NewBatch()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		batch.Delete(keys[i])
+		if batch.Len() == 1000 {
+			if err := batch.Commit(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func TestBatchEmptyRecords(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	db, err := Open(dbname, ModeWriter)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	// All keys and values are empty, so the batch buffer is empty.
+	b := db.NewBatch()
+	b.Put([]byte{}, []byte{}, true)
+	b.Delete([]byte{})
+	b.Put([]byte{}, []byte{}, false)
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	val, err := db.Fetch([]byte{})
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if len(val) != 0 {
+		t.Errorf("Expected empty value, got %q", val)
+	}
+}
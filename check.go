@@ -0,0 +1,268 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/graygnuorg/go-gdbm/format"
+)
+
+// CheckConfig controls the database check.
+type CheckConfig struct {
+	Repair bool
+	// If true and problems were found, recover the database and check
+	// it again.
+	Recovery RecoveryConfig
+	// Recovery parameters used when repairing.  The Force field is
+	// implied.
+}
+
+// CheckProblem describes a problem found by Check.
+type CheckProblem struct {
+	Err error
+	// The corresponding error: ErrBadHeader, ErrBadDirEntry,
+	// ErrBadBucket, ErrBadAvail or ErrBadHashTable for structural
+	// damage, or the error returned when fetching a key.
+	Offset int64
+	// File offset of the damaged structure, or -1 if not known.
+	Key []byte
+	// Key that could not be fetched, if any.
+	Message string
+	// Description of the problem.
+}
+
+// Error returns the problem description.
+func (p *CheckProblem) Error() string {
+	return p.Message
+}
+
+// Unwrap returns the error corresponding to the problem, so that it can
+// be tested using errors.Is.
+func (p *CheckProblem) Unwrap() error {
+	return p.Err
+}
+
+// CheckReport is returned by Check.
+type CheckReport struct {
+	DirEntries int
+	// Number of directory entries.
+	Buckets int
+	// Number of buckets examined.
+	AvailBlocks int
+	// Number of avail blocks, including the one in the file header.
+	Keys int
+	// Number of keys fetched successfully.
+	Problems []CheckProblem
+	// Problems found.
+	Recovery *RecoveryStat
+	// Recovery statistics, if the database was repaired.
+	Remaining []CheckProblem
+	// Problems that remained after repair.
+}
+
+// OK returns true if the database is (or, after repair, became) free of
+// problems.
+func (r *CheckReport) OK() bool {
+	if r.Recovery != nil {
+		return len(r.Remaining) == 0
+	}
+	return len(r.Problems) == 0
+}
+
+func (r *CheckReport) add(err error, off int64, key []byte, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, CheckProblem{
+		Err: err,
+		Offset: off,
+		Key: key,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Map errors from the format package to the library errors.
+func checkError(err error) error {
+	switch {
+	case errors.Is(err, format.ErrBadDirEntry):
+		return ErrBadDirEntry
+	case errors.Is(err, format.ErrBadBucket):
+		return ErrBadBucket
+	case errors.Is(err, format.ErrBadAvail):
+		return ErrBadAvail
+	case errors.Is(err, format.ErrBadHashEntry):
+		return ErrBadHashTable
+	case errors.Is(err, format.ErrBadMagic):
+		return ErrBadMagicNumber
+	}
+	return ErrBadHeader
+}
+
+// Check verifies the integrity of the database.  It examines the file
+// header, every directory entry, bucket and avail block, then fetches
+// each key returned by the database iterator.  The problems found are
+// returned in the report.  If cfg.Repair is set and problems were found,
+// the database is recovered and checked again.
+//
+// The returned error reports failures of the check itself, not the
+// problems it found.  Use the OK method of the report to tell whether the
+// database is consistent.
+func (db *Database) Check(cfg CheckConfig) (*CheckReport, error) {
+	r := &CheckReport{}
+	if err := db.check(r); err != nil {
+		return nil, err
+	}
+	if !cfg.Repair || len(r.Problems) == 0 {
+		return r, nil
+	}
+
+	rcfg := cfg.Recovery
+	rcfg.Force = true
+	stat, err := db.Recover(rcfg)
+	r.Recovery = stat
+	if err != nil {
+		return r, err
+	}
+	after := &CheckReport{}
+	if err := db.check(after); err != nil {
+		return r, err
+	}
+	r.Remaining = after.Problems
+	return r, nil
+}
+
+func (db *Database) check(r *CheckReport) error {
+	db.sync.Lock()
+	defer db.sync.Unlock()
+	if db.dbf == nil {
+		return ErrNotOpen
+	}
+
+	if db.needsRecovery() {
+		r.add(ErrNeedRecovery, -1, nil, "database needs recovery")
+		return nil
+	}
+
+	// Flush cached buckets, so that the file reflects the current
+	// state of the database.
+	if err := db.syncFile(); err != nil {
+		return err
+	}
+	name, err := db.fileName()
+	if err != nil {
+		return err
+	}
+	db.checkFile(name, r)
+	db.checkKeys(r)
+	return nil
+}
+
+// Check the file structure.
+func (db *Database) checkFile(name string, r *CheckReport) {
+	f, err := format.Open(name)
+	if err != nil {
+		r.add(checkError(err), -1, nil, "%v", err)
+		return
+	}
+	defer f.Close()
+	h := &f.Header
+
+	r.DirEntries = len(f.Dir)
+	for i := 0; i < len(f.Dir); {
+		addr := f.Dir[i]
+		j := i + 1
+		for j < len(f.Dir) && f.Dir[j] == addr {
+			j++
+		}
+		r.Buckets++
+		b, err := f.ReadBucket(addr)
+		if err != nil {
+			r.add(checkError(err), addr, nil, "%v", err)
+			i = j
+			continue
+		}
+		// A bucket using n hash bits is referred to by a run of
+		// 2^(DirBits-n) directory entries, aligned on that boundary.
+		span := 1 << uint(h.DirBits - b.Bits)
+		if i % span != 0 || j - i != span {
+			r.add(ErrBadDirEntry, h.Dir, nil,
+				"directory entries %d-%d refer to bucket at %d using %d bits",
+				i, j - 1, addr, b.Bits)
+		}
+		for k := range b.Table {
+			e := &b.Table[k]
+			if !e.InUse() {
+				continue
+			}
+			idx := int(e.Hash >> uint(format.HashBits - h.DirBits))
+			if idx >= len(f.Dir) || f.Dir[idx] != addr {
+				r.add(ErrBadHashTable, addr, nil,
+					"bucket at %d, slot %d: hash value %d belongs to another bucket",
+					addr, k, e.Hash)
+				continue
+			}
+			key, err := f.ReadKey(e)
+			if err != nil {
+				r.add(checkError(err), addr, nil, "%v", err)
+				continue
+			}
+			n := len(key)
+			if n > format.SmallKey {
+				n = format.SmallKey
+			}
+			if !bytes.Equal(key[:n], e.KeyStart[:n]) {
+				r.add(ErrBadHashTable, addr, key,
+					"bucket at %d, slot %d: key doesn't match the hash table entry",
+					addr, k)
+			}
+		}
+		i = j
+	}
+
+	blocks, err := f.AvailBlocks()
+	r.AvailBlocks = len(blocks)
+	if err != nil {
+		r.add(checkError(err), -1, nil, "%v", err)
+	}
+}
+
+// Fetch every key returned by the iterator.
+func (db *Database) checkKeys(r *CheckReport) {
+	var keys [][]byte
+	err := db.eachKey(func(key []byte) error {
+		keys = append(keys, append([]byte{}, key...))
+		return nil
+	})
+	if err != nil {
+		r.add(err, -1, nil, "iteration failed: %v", err)
+	}
+	for _, key := range keys {
+		if db.needsRecovery() {
+			// Further fetches would fail anyway.
+			break
+		}
+		if _, err := db.fetch(key); err != nil {
+			if errors.Is(err, ErrItemNotFound) {
+				// The key is present in a bucket, but can't be
+				// found by its hash value.
+				err = ErrBadHashTable
+			}
+			r.add(err, -1, key, "can't fetch key %q: %v", key, err)
+		} else {
+			r.Keys++
+		}
+	}
+}
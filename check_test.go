@@ -0,0 +1,197 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+import (
+	"errors"
+	"github.com/graygnuorg/go-gdbm/format"
+	"testing"
+)
+
+// Encode an int32 value in the byte order of the test database.
+func encodeInt(f *format.File, n int) []byte {
+	buf := make([]byte, 4)
+	f.Header.ByteOrder.PutUint32(buf, uint32(n))
+	return buf
+}
+
+// Encode a file offset in the format of the test database.
+func encodeOffset(f *format.File, off int64) []byte {
+	buf := make([]byte, f.Header.OffsetSize)
+	if f.Header.OffsetSize == 8 {
+		f.Header.ByteOrder.PutUint64(buf, uint64(off))
+	} else {
+		f.Header.ByteOrder.PutUint32(buf, uint32(off))
+	}
+	return buf
+}
+
+// Run Check on the test database and return the report.
+func checkDatabase(t *testing.T, mode int, cfg CheckConfig) *CheckReport {
+	db, err := Open(dbname, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	r, err := db.Check(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// Verify that the report contains a problem matching expected.
+func expectProblem(t *testing.T, r *CheckReport, expected error) {
+	for i := range r.Problems {
+		if errors.Is(&r.Problems[i], expected) {
+			return
+		}
+	}
+	t.Errorf("expected %v, got %+v", expected, r.Problems)
+}
+
+func TestCheck(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	for _, mode := range []int{ModeReader, ModeWriter} {
+		r := checkDatabase(t, mode, CheckConfig{})
+		if !r.OK() {
+			t.Errorf("mode %d: unexpected problems: %+v", mode, r.Problems)
+		}
+		if r.Keys != len(keys) {
+			t.Errorf("mode %d: fetched %d keys, expected %d", mode, r.Keys, len(keys))
+		}
+		if r.DirEntries == 0 || r.Buckets == 0 || r.AvailBlocks == 0 {
+			t.Errorf("mode %d: bad report: %+v", mode, r)
+		}
+	}
+}
+
+func TestCheckNotOpen(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if _, err := db.Check(CheckConfig{}); !errors.Is(err, ErrNotOpen) {
+		t.Errorf("expected ErrNotOpen, got %v", err)
+	}
+}
+
+func TestCheckBadBucket(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	f := inspectDatabase(t)
+	corruptDatabase(t, f.BucketAddrs()[0], encodeInt(f, 0x7fffffff))
+	r := checkDatabase(t, ModeReader, CheckConfig{})
+	expectProblem(t, r, ErrBadBucket)
+	if r.OK() {
+		t.Error("database reported OK")
+	}
+}
+
+func TestCheckBadAvail(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	f := inspectDatabase(t)
+	addr := f.BucketAddrs()[0]
+	b, err := f.ReadBucket(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Add a bucket avail entry pointing beyond the end of file.
+	n := len(b.Avail)
+	if n == format.BucketAvail {
+		t.Skip("bucket avail table is full")
+	}
+	off := int64(f.Header.OffsetSize)
+	corruptDatabase(t, addr, encodeInt(f, n + 1))
+	elem := addr + off + int64(n) * 2 * off
+	corruptDatabase(t, elem, encodeInt(f, 16))
+	corruptDatabase(t, elem + off, encodeOffset(f, 1 << 30))
+	expectProblem(t, checkDatabase(t, ModeReader, CheckConfig{}), ErrBadAvail)
+}
+
+func TestCheckBadDirEntry(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	f := inspectDatabase(t)
+	if f.Header.DirBits == 0 {
+		t.Skip("directory has a single entry")
+	}
+	// Claim that the bucket uses all directory bits, although it is
+	// referred to by all directory entries.
+	addr := f.BucketAddrs()[0]
+	off := f.Header.OffsetSize
+	corruptDatabase(t, addr + int64(off + format.BucketAvail * 2 * off),
+		encodeInt(f, f.Header.DirBits))
+	expectProblem(t, checkDatabase(t, ModeReader, CheckConfig{}), ErrBadDirEntry)
+}
+
+func TestCheckBadHashTable(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	f := inspectDatabase(t)
+	addr := f.BucketAddrs()[0]
+	b, err := f.ReadBucket(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Change the first byte of a key, so that it no longer matches the
+	// hash table entry.
+	for _, e := range b.Table {
+		if e.InUse() {
+			corruptDatabase(t, e.DataPointer, []byte{'#'})
+			break
+		}
+	}
+	r := checkDatabase(t, ModeReader, CheckConfig{})
+	expectProblem(t, r, ErrBadHashTable)
+	if r.Keys >= len(keys) {
+		t.Errorf("all keys fetched from a damaged database")
+	}
+}
+
+func TestCheckRepair(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	f := inspectDatabase(t)
+	corruptDatabase(t, f.BucketAddrs()[0], encodeInt(f, 0x7fffffff))
+	r := checkDatabase(t, ModeWriter, CheckConfig{Repair: true})
+	expectProblem(t, r, ErrBadBucket)
+	if r.Recovery == nil {
+		t.Fatal("database was not recovered")
+	}
+	if r.Recovery.FailedBuckets == 0 {
+		t.Errorf("unexpected recovery statistics: %+v", r.Recovery)
+	}
+	if !r.OK() {
+		t.Errorf("problems remain after repair: %+v", r.Remaining)
+	}
+	if r := checkDatabase(t, ModeReader, CheckConfig{}); !r.OK() {
+		t.Errorf("problems found after repair: %+v", r.Problems)
+	}
+}
@@ -0,0 +1,527 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"github.com/graygnuorg/go-gdbm"
+	"github.com/graygnuorg/go-gdbm/shell"
+)
+
+func init() {
+	commands = map[string]*command{
+		"get": {"DBFILE KEY", "Print the value of KEY", setupGet},
+		"put": {"DBFILE KEY [VALUE]", "Store VALUE (or standard input) under KEY", setupPut},
+		"delete": {"DBFILE KEY...", "Delete keys", setupDelete},
+		"list": {"DBFILE", "List the database contents", setupList},
+		"count": {"DBFILE", "Print the number of keys", setupCount},
+		"dump": {"DBFILE [DUMPFILE]", "Dump the database to DUMPFILE or standard output", setupDump},
+		"load": {"DBFILE [DUMPFILE]", "Load a dump from DUMPFILE or standard input", setupLoad},
+		"reorganize": {"DBFILE", "Reorganize the database", setupReorganize},
+		"compact": {"DBFILE [DSTFILE]", "Compact the database, using DSTFILE as temporary file", setupCompact},
+		"recover": {"DBFILE", "Recover structural consistency of the database", setupRecover},
+		"check": {"DBFILE", "Check the database integrity", setupCheck},
+		"convert": {"DBFILE", "Convert the database to another format", setupConvert},
+		"stats": {"DBFILE", "Print database statistics", setupStats},
+		"snapshot-restore": {"DBFILE", "Restore the database from its crash tolerance snapshots", setupSnapshotRestore},
+		"version": {"", "Print the GDBM library version", setupVersion},
+		"shell": {"[DBFILE]", "Run interactive shell", setupShell},
+	}
+}
+
+// Options controlling how the database is opened.
+type openOptions struct {
+	nolock bool
+	nommap bool
+}
+
+func (o *openOptions) declare(fs *flag.FlagSet) {
+	fs.BoolVar(&o.nolock, "nolock", false, "don't lock the database")
+	fs.BoolVar(&o.nommap, "nommap", false, "don't use memory mapping")
+}
+
+func (o *openOptions) open(name string, mode int) (*gdbm.Database, error) {
+	cfg := gdbm.DatabaseConfig{FileName: name, Mode: mode, FileMode: 0666}
+	if o.nolock {
+		cfg.Flags |= gdbm.OF_NOLOCK
+	}
+	if o.nommap {
+		cfg.Flags |= gdbm.OF_NOMMAP
+	}
+	return gdbm.OpenConfig(cfg)
+}
+
+// Check the number of positional arguments.
+func checkArgs(args []string, min, max int) error {
+	if len(args) < min {
+		return usagef("not enough arguments")
+	}
+	if max >= 0 && len(args) > max {
+		return usagef("too many arguments")
+	}
+	return nil
+}
+
+// Close the database, returning the first of err and the close error.
+func closeDB(db *gdbm.Database, err error) error {
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func setupGet(fs *flag.FlagSet) func(*env, []string) error {
+	var oo openOptions
+	oo.declare(fs)
+	noNewline := fs.Bool("n", false, "don't output trailing newline")
+	return func(e *env, args []string) (err error) {
+		if err = checkArgs(args, 2, 2); err != nil {
+			return
+		}
+		db, err := oo.open(args[0], gdbm.ModeReader)
+		if err != nil {
+			return
+		}
+		defer func() { err = closeDB(db, err) }()
+		value, err := db.Fetch([]byte(args[1]))
+		if err != nil {
+			return
+		}
+		e.stdout.Write(value)
+		if !*noNewline {
+			fmt.Fprintln(e.stdout)
+		}
+		return
+	}
+}
+
+func setupPut(fs *flag.FlagSet) func(*env, []string) error {
+	var oo openOptions
+	oo.declare(fs)
+	insert := fs.Bool("insert", false, "fail if the key already exists")
+	return func(e *env, args []string) (err error) {
+		if err = checkArgs(args, 2, 3); err != nil {
+			return
+		}
+		var value []byte
+		if len(args) == 3 {
+			value = []byte(args[2])
+		} else if value, err = io.ReadAll(e.stdin); err != nil {
+			return
+		}
+		db, err := oo.open(args[0], gdbm.ModeWrcreat)
+		if err != nil {
+			return
+		}
+		defer func() { err = closeDB(db, err) }()
+		return db.Store([]byte(args[1]), value, !*insert)
+	}
+}
+
+func setupDelete(fs *flag.FlagSet) func(*env, []string) error {
+	var oo openOptions
+	oo.declare(fs)
+	ignore := fs.Bool("f", false, "ignore nonexistent keys")
+	return func(e *env, args []string) (err error) {
+		if err = checkArgs(args, 2, -1); err != nil {
+			return
+		}
+		db, err := oo.open(args[0], gdbm.ModeWriter)
+		if err != nil {
+			return
+		}
+		defer func() { err = closeDB(db, err) }()
+		for _, key := range args[1:] {
+			err = db.Delete([]byte(key))
+			if err != nil && !(*ignore && errors.Is(err, gdbm.ErrItemNotFound)) {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+		return nil
+	}
+}
+
+func setupList(fs *flag.FlagSet) func(*env, []string) error {
+	var oo openOptions
+	oo.declare(fs)
+	keysOnly := fs.Bool("k", false, "list keys only")
+	return func(e *env, args []string) (err error) {
+		if err = checkArgs(args, 1, 1); err != nil {
+			return
+		}
+		db, err := oo.open(args[0], gdbm.ModeReader)
+		if err != nil {
+			return
+		}
+		defer func() { err = closeDB(db, err) }()
+		w := bufio.NewWriter(e.stdout)
+		defer w.Flush()
+		c := db.Cursor()
+		defer c.Close()
+		for c.Next() {
+			w.Write(c.Key())
+			if !*keysOnly {
+				value := c.Value()
+				if value == nil {
+					break
+				}
+				w.WriteByte('\t')
+				w.Write(value)
+			}
+			w.WriteByte('\n')
+		}
+		return c.Err()
+	}
+}
+
+func setupCount(fs *flag.FlagSet) func(*env, []string) error {
+	var oo openOptions
+	oo.declare(fs)
+	return func(e *env, args []string) (err error) {
+		if err = checkArgs(args, 1, 1); err != nil {
+			return
+		}
+		db, err := oo.open(args[0], gdbm.ModeReader)
+		if err != nil {
+			return
+		}
+		defer func() { err = closeDB(db, err) }()
+		n, err := db.Count()
+		if err == nil {
+			fmt.Fprintln(e.stdout, n)
+		}
+		return
+	}
+}
+
+func setupDump(fs *flag.FlagSet) func(*env, []string) error {
+	var oo openOptions
+	oo.declare(fs)
+	format := fs.String("format", "ascii", "dump format: ascii or binary")
+	return func(e *env, args []string) (err error) {
+		if err = checkArgs(args, 1, 2); err != nil {
+			return
+		}
+		var fmtCode int
+		switch *format {
+		case "ascii":
+			fmtCode = gdbm.AsciiDump
+		case "binary":
+			fmtCode = gdbm.BinaryDump
+		default:
+			return usagef("unknown dump format %q", *format)
+		}
+		db, err := oo.open(args[0], gdbm.ModeReader)
+		if err != nil {
+			return
+		}
+		defer func() { err = closeDB(db, err) }()
+
+		w := e.stdout
+		if len(args) == 2 {
+			var f *os.File
+			f, err = os.OpenFile(args[1], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+			if err != nil {
+				return
+			}
+			defer func() {
+				if cerr := f.Close(); err == nil {
+					err = cerr
+				}
+			}()
+			w = f
+		}
+		return db.DumpTo(w, fmtCode)
+	}
+}
+
+func setupLoad(fs *flag.FlagSet) func(*env, []string) error {
+	var oo openOptions
+	oo.declare(fs)
+	replace := fs.Bool("replace", false, "replace existing keys")
+	return func(e *env, args []string) (err error) {
+		if err = checkArgs(args, 1, 2); err != nil {
+			return
+		}
+		r := e.stdin
+		if len(args) == 2 {
+			f, err := os.Open(args[1])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		db, err := oo.open(args[0], gdbm.ModeWrcreat)
+		if err != nil {
+			return
+		}
+		defer func() { err = closeDB(db, err) }()
+		return db.LoadFrom(r, *replace)
+	}
+}
+
+func setupReorganize(fs *flag.FlagSet) func(*env, []string) error {
+	var oo openOptions
+	oo.declare(fs)
+	return func(e *env, args []string) (err error) {
+		if err = checkArgs(args, 1, 1); err != nil {
+			return
+		}
+		db, err := oo.open(args[0], gdbm.ModeWriter)
+		if err != nil {
+			return
+		}
+		defer func() { err = closeDB(db, err) }()
+		return db.Reorganize()
+	}
+}
+
+func setupCompact(fs *flag.FlagSet) func(*env, []string) error {
+	var oo openOptions
+	oo.declare(fs)
+	return func(e *env, args []string) (err error) {
+		if err = checkArgs(args, 1, 2); err != nil {
+			return
+		}
+		db, err := oo.open(args[0], gdbm.ModeWriter)
+		if err != nil {
+			return
+		}
+		defer func() { err = closeDB(db, err) }()
+		var dst string
+		if len(args) > 1 {
+			dst = args[1]
+		}
+		return db.Compact(dst)
+	}
+}
+
+func setupRecover(fs *flag.FlagSet) func(*env, []string) error {
+	var oo openOptions
+	oo.declare(fs)
+	var cfg gdbm.RecoveryConfig
+	fs.BoolVar(&cfg.Backup, "backup", false, "create a backup copy of the database")
+	fs.BoolVar(&cfg.Force, "force", false, "recover even if the database doesn't need it")
+	fs.UintVar(&cfg.MaxFailedKeys, "max-failed-keys", 0, "fail after `N` failed keys")
+	fs.UintVar(&cfg.MaxFailedBuckets, "max-failed-buckets", 0, "fail after `N` failed buckets")
+	fs.UintVar(&cfg.MaxFailures, "max-failures", 0, "fail after `N` failures")
+	verbose := fs.Bool("verbose", false, "print recovery messages")
+	return func(e *env, args []string) (err error) {
+		if err = checkArgs(args, 1, 1); err != nil {
+			return
+		}
+		if *verbose {
+			cfg.ErrorFunc = func(msg string) {
+				fmt.Fprintf(e.stderr, "%s: %s\n", args[0], msg)
+			}
+		}
+		db, err := oo.open(args[0], gdbm.ModeWriter)
+		if err != nil {
+			return
+		}
+		defer func() { err = closeDB(db, err) }()
+		stat, err := db.Recover(cfg)
+		if err != nil {
+			return
+		}
+		if stat.BackupName != "" {
+			fmt.Fprintf(e.stdout, "backup: %s\n", stat.BackupName)
+		}
+		fmt.Fprintf(e.stdout, "recovered keys: %d\n", stat.RecoveredKeys)
+		fmt.Fprintf(e.stdout, "recovered buckets: %d\n", stat.RecoveredBuckets)
+		fmt.Fprintf(e.stdout, "failed keys: %d\n", stat.FailedKeys)
+		fmt.Fprintf(e.stdout, "failed buckets: %d\n", stat.FailedBuckets)
+		fmt.Fprintf(e.stdout, "duplicate keys: %d\n", stat.DuplicateKeys)
+		return
+	}
+}
+
+func setupCheck(fs *flag.FlagSet) func(*env, []string) error {
+	var oo openOptions
+	oo.declare(fs)
+	var cfg gdbm.CheckConfig
+	fs.BoolVar(&cfg.Repair, "repair", false, "recover the database if problems are found")
+	fs.BoolVar(&cfg.Recovery.Backup, "backup", false, "create a backup copy of the database before repairing")
+	return func(e *env, args []string) (err error) {
+		if err = checkArgs(args, 1, 1); err != nil {
+			return
+		}
+		mode := gdbm.ModeReader
+		if cfg.Repair {
+			mode = gdbm.ModeWriter
+		}
+		db, err := oo.open(args[0], mode)
+		if err != nil {
+			return
+		}
+		defer func() { err = closeDB(db, err) }()
+		r, err := db.Check(cfg)
+		if r != nil {
+			for _, p := range r.Problems {
+				fmt.Fprintf(e.stdout, "%s: %s\n", args[0], p.Message)
+			}
+			fmt.Fprintf(e.stdout, "directory entries: %d\n", r.DirEntries)
+			fmt.Fprintf(e.stdout, "buckets: %d\n", r.Buckets)
+			fmt.Fprintf(e.stdout, "avail blocks: %d\n", r.AvailBlocks)
+			fmt.Fprintf(e.stdout, "keys: %d\n", r.Keys)
+			fmt.Fprintf(e.stdout, "problems: %d\n", len(r.Problems))
+			if r.Recovery != nil {
+				if r.Recovery.BackupName != "" {
+					fmt.Fprintf(e.stdout, "backup: %s\n", r.Recovery.BackupName)
+				}
+				fmt.Fprintf(e.stdout, "recovered keys: %d\n", r.Recovery.RecoveredKeys)
+				fmt.Fprintf(e.stdout, "failed keys: %d\n", r.Recovery.FailedKeys)
+				fmt.Fprintf(e.stdout, "remaining problems: %d\n", len(r.Remaining))
+			}
+		}
+		if err != nil {
+			return
+		}
+		if !r.OK() {
+			p := r.Problems
+			if r.Recovery != nil {
+				p = r.Remaining
+			}
+			err = fmt.Errorf("database is damaged: %w", p[0].Err)
+		}
+		return
+	}
+}
+
+func setupStats(fs *flag.FlagSet) func(*env, []string) error {
+	var oo openOptions
+	oo.declare(fs)
+	return func(e *env, args []string) (err error) {
+		if err = checkArgs(args, 1, 1); err != nil {
+			return
+		}
+		db, err := oo.open(args[0], gdbm.ModeReader)
+		if err != nil {
+			return
+		}
+		defer func() { err = closeDB(db, err) }()
+		st, err := db.Stats()
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(e.stdout, "file size: %d\n", st.FileSize)
+		fmt.Fprintf(e.stdout, "block size: %d\n", st.BlockSize)
+		if st.Numsync {
+			fmt.Fprintf(e.stdout, "numsync: %d\n", st.NumsyncCount)
+		}
+		fmt.Fprintf(e.stdout, "directory size: %d\n", st.DirSize)
+		fmt.Fprintf(e.stdout, "directory depth: %d\n", st.DirBits)
+		fmt.Fprintf(e.stdout, "bucket size: %d\n", st.BucketSize)
+		fmt.Fprintf(e.stdout, "bucket elements: %d\n", st.BucketElems)
+		fmt.Fprintf(e.stdout, "buckets: %d\n", st.Buckets)
+		fmt.Fprintf(e.stdout, "keys: %d\n", st.Keys)
+		fmt.Fprintf(e.stdout, "fill factor: %.2f\n", st.FillFactor)
+		for n, count := range st.BucketFill {
+			if count > 0 {
+				fmt.Fprintf(e.stdout, "buckets with %d elements: %d\n", n, count)
+			}
+		}
+		for _, a := range st.Avail {
+			fmt.Fprintf(e.stdout, "avail block at %d: %d/%d entries, %d bytes\n", a.Addr, a.Count, a.Size, a.Bytes)
+		}
+		fmt.Fprintf(e.stdout, "bucket avail: %d entries, %d bytes\n", st.BucketAvailEntries, st.BucketAvailBytes)
+		fmt.Fprintf(e.stdout, "wasted bytes: %d\n", st.WastedBytes)
+		return
+	}
+}
+
+func setupConvert(fs *flag.FlagSet) func(*env, []string) error {
+	var oo openOptions
+	oo.declare(fs)
+	format := fs.String("format", "numsync", "target format: numsync or standard")
+	return func(e *env, args []string) (err error) {
+		if err = checkArgs(args, 1, 1); err != nil {
+			return
+		}
+		var numsync bool
+		switch *format {
+		case "numsync":
+			numsync = true
+		case "standard":
+			numsync = false
+		default:
+			return usagef("unknown database format %q", *format)
+		}
+		db, err := oo.open(args[0], gdbm.ModeWriter)
+		if err != nil {
+			return
+		}
+		defer func() { err = closeDB(db, err) }()
+		return db.Convert(numsync)
+	}
+}
+
+func setupSnapshotRestore(fs *flag.FlagSet) func(*env, []string) error {
+	return func(e *env, args []string) error {
+		if err := checkArgs(args, 1, 1); err != nil {
+			return err
+		}
+		return gdbm.SnapshotRestore(args[0])
+	}
+}
+
+func setupVersion(fs *flag.FlagSet) func(*env, []string) error {
+	return func(e *env, args []string) error {
+		if err := checkArgs(args, 0, 0); err != nil {
+			return err
+		}
+		fmt.Fprintln(e.stdout, gdbm.VersionString())
+		return nil
+	}
+}
+
+func setupShell(fs *flag.FlagSet) func(*env, []string) error {
+	write := fs.Bool("w", false, "open DBFILE for writing")
+	history := fs.String("history", "", "history `FILE` (default ~/.gogdbm_history)")
+	return func(e *env, args []string) error {
+		if err := checkArgs(args, 0, 1); err != nil {
+			return err
+		}
+		sh := shell.New(e.stdout)
+		defer sh.Close()
+		if *history != "" {
+			sh.HistoryFile = *history
+		} else if home, err := os.UserHomeDir(); err == nil {
+			sh.HistoryFile = filepath.Join(home, ".gogdbm_history")
+		}
+		if len(args) == 1 {
+			mode := gdbm.ModeReader
+			if *write {
+				mode = gdbm.ModeWriter
+			}
+			if err := sh.Open(args[0], mode, ""); err != nil {
+				return err
+			}
+		}
+		if f, ok := e.stdin.(*os.File); ok {
+			return sh.RunTerminal(f)
+		}
+		return sh.Run(e.stdin)
+	}
+}
@@ -0,0 +1,168 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+// Gogdbm examines and modifies GDBM database files.
+//
+// Usage:
+//
+//	gogdbm COMMAND [OPTIONS] ARGS...
+//
+// Run "gogdbm help" for the list of commands, and "gogdbm COMMAND -h"
+// for the description of a particular command.
+//
+// Exit status is 0 on success, 1 on errors not originating from the
+// GDBM library (including those reported by the bindings themselves,
+// such as ErrNotOpen), and 2 on command line usage errors.  If the library
+// reports an error, the exit status is 64 plus the GDBM error code (as
+// returned by GdbmError.Code()).  For example, looking up a nonexistent
+// key exits with status 79 (64 + GDBM_ITEM_NOT_FOUND).
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"github.com/graygnuorg/go-gdbm"
+)
+
+const (
+	ExitOK = 0
+	// Success.
+	ExitFailure = 1
+	// Generic failure.
+	ExitUsage = 2
+	// Command line usage error.
+	ExitGdbmBase = 64
+	// GDBM errors exit with ExitGdbmBase + GdbmError.Code().  Errors
+	// with non-positive codes are raised by the bindings rather than by
+	// the library and exit with ExitFailure.
+)
+
+// Error in the command line usage.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{fmt.Sprintf(format, args...)}
+}
+
+// Returns the exit status corresponding to err.
+func exitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var uerr *usageError
+	if errors.As(err, &uerr) {
+		return ExitUsage
+	}
+	var gerr *gdbm.GdbmError
+	if errors.As(err, &gerr) && gerr.Code() > 0 {
+		return ExitGdbmBase + gerr.Code()
+	}
+	return ExitFailure
+}
+
+// Command execution environment.
+type env struct {
+	stdin io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	flags *flag.FlagSet
+}
+
+type command struct {
+	args string
+	// Synopsis of positional arguments.
+	descr string
+	// Short description.
+	setup func(fs *flag.FlagSet) func(e *env, args []string) error
+	// Declares command options and returns the command handler.
+}
+
+var commands map[string]*command
+
+func commandNames() []string {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: gogdbm COMMAND [OPTIONS] ARGS...")
+	fmt.Fprintln(w, "Commands are:")
+	for _, name := range commandNames() {
+		fmt.Fprintf(w, "  %-17s %s\n", name, commands[name].descr)
+	}
+	fmt.Fprintln(w, "Run 'gogdbm COMMAND -h' for help on a particular command.")
+}
+
+// Run the command line args and return the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return ExitUsage
+	}
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage(stdout)
+		return ExitOK
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "gogdbm: unknown command %q\n", name)
+		usage(stderr)
+		return ExitUsage
+	}
+
+	fs := flag.NewFlagSet("gogdbm " + name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: gogdbm %s [OPTIONS] %s\n%s.\n", name, cmd.args, cmd.descr)
+		fs.PrintDefaults()
+	}
+	handler := cmd.setup(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	e := &env{stdin: stdin, stdout: stdout, stderr: stderr, flags: fs}
+	err := handler(e, fs.Args())
+	if err != nil {
+		fmt.Fprintf(stderr, "gogdbm %s: %v\n", name, err)
+		var uerr *usageError
+		if errors.As(err, &uerr) {
+			fs.Usage()
+		}
+	}
+	return exitCode(err)
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"github.com/graygnuorg/go-gdbm"
+)
+
+type result struct {
+	status int
+	stdout string
+	stderr string
+}
+
+func gogdbm(stdin string, args ...string) result {
+	var stdout, stderr bytes.Buffer
+	status := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return result{status, stdout.String(), stderr.String()}
+}
+
+func expectStatus(t *testing.T, res result, status int) {
+	t.Helper()
+	if res.status != status {
+		t.Fatalf("Expected exit status %d, got %d (stderr: %q)", status, res.status, res.stderr)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	dbname := filepath.Join(dir, "junk.gdbm")
+
+	expectStatus(t, gogdbm("", "put", dbname, "one", "1"), ExitOK)
+	expectStatus(t, gogdbm("2", "put", dbname, "two"), ExitOK)
+	expectStatus(t, gogdbm("", "put", "-insert", dbname, "one", "uno"),
+		ExitGdbmBase + gdbm.GDBM_CANNOT_REPLACE)
+	expectStatus(t, gogdbm("", "put", dbname, "three", "3"), ExitOK)
+
+	res := gogdbm("", "get", dbname, "one")
+	expectStatus(t, res, ExitOK)
+	if res.stdout != "1\n" {
+		t.Errorf("get returned %q", res.stdout)
+	}
+	res = gogdbm("", "get", "-n", dbname, "two")
+	if res.stdout != "2" {
+		t.Errorf("get returned %q", res.stdout)
+	}
+	expectStatus(t, gogdbm("", "get", dbname, "four"), ExitGdbmBase + gdbm.GDBM_ITEM_NOT_FOUND)
+
+	res = gogdbm("", "count", dbname)
+	expectStatus(t, res, ExitOK)
+	if res.stdout != "3\n" {
+		t.Errorf("count returned %q", res.stdout)
+	}
+
+	res = gogdbm("", "list", dbname)
+	expectStatus(t, res, ExitOK)
+	lines := strings.Split(strings.TrimSuffix(res.stdout, "\n"), "\n")
+	sort.Strings(lines)
+	if strings.Join(lines, ",") != "one\t1,three\t3,two\t2" {
+		t.Errorf("list returned %q", res.stdout)
+	}
+	res = gogdbm("", "list", "-k", dbname)
+	if strings.Count(res.stdout, "\n") != 3 || strings.Contains(res.stdout, "\t") {
+		t.Errorf("list -k returned %q", res.stdout)
+	}
+
+	// Dump and load
+	dumpname := filepath.Join(dir, "junk.dump")
+	expectStatus(t, gogdbm("", "dump", dbname, dumpname), ExitOK)
+	res = gogdbm("", "dump", "-format", "binary", dbname)
+	expectStatus(t, res, ExitOK)
+	if !strings.HasPrefix(res.stdout, "!\r\n! GDBM FLAT FILE DUMP") {
+		t.Errorf("Bad binary dump: %q", res.stdout)
+	}
+	newname := filepath.Join(dir, "new.gdbm")
+	expectStatus(t, gogdbm("", "load", newname, dumpname), ExitOK)
+	expectStatus(t, gogdbm("", "load", newname, dumpname), ExitGdbmBase + gdbm.GDBM_CANNOT_REPLACE)
+	expectStatus(t, gogdbm("", "load", "-replace", newname, dumpname), ExitOK)
+	dump, _ := os.ReadFile(dumpname)
+	expectStatus(t, gogdbm(string(dump), "load", "-replace", newname), ExitOK)
+	if res := gogdbm("", "count", newname); res.stdout != "3\n" {
+		t.Errorf("count returned %q", res.stdout)
+	}
+
+	res = gogdbm("count\nget two\nquit\n", "shell", "-history", filepath.Join(dir, "history"), dbname)
+	expectStatus(t, res, ExitOK)
+	if res.stdout != "3\n2\n" {
+		t.Errorf("shell returned %q", res.stdout)
+	}
+
+	expectStatus(t, gogdbm("", "delete", dbname, "one", "two"), ExitOK)
+	expectStatus(t, gogdbm("", "delete", dbname, "one"), ExitGdbmBase + gdbm.GDBM_ITEM_NOT_FOUND)
+	expectStatus(t, gogdbm("", "delete", "-f", dbname, "one", "three"), ExitOK)
+	if res := gogdbm("", "count", dbname); res.stdout != "0\n" {
+		t.Errorf("count returned %q", res.stdout)
+	}
+
+	expectStatus(t, gogdbm("", "reorganize", dbname), ExitOK)
+	expectStatus(t, gogdbm("", "compact", dbname), ExitOK)
+
+	res = gogdbm("", "recover", "-force", "-backup", newname)
+	expectStatus(t, res, ExitOK)
+	if !strings.Contains(res.stdout, "recovered keys: 3\n") || !strings.Contains(res.stdout, "backup: ") {
+		t.Errorf("recover returned %q", res.stdout)
+	}
+
+	res = gogdbm("", "check", newname)
+	expectStatus(t, res, ExitOK)
+	if !strings.Contains(res.stdout, "keys: 3\n") || !strings.Contains(res.stdout, "problems: 0\n") {
+		t.Errorf("check returned %q", res.stdout)
+	}
+
+	res = gogdbm("", "stats", newname)
+	expectStatus(t, res, ExitOK)
+	if !strings.Contains(res.stdout, "\nkeys: 3\n") || !strings.Contains(res.stdout, "wasted bytes: ") {
+		t.Errorf("stats returned %q", res.stdout)
+	}
+
+	expectStatus(t, gogdbm("", "convert", newname), ExitOK)
+	db, err := gdbm.Open(newname, gdbm.ModeReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numsync, _ := db.IsNumsync()
+	db.Close()
+	if !numsync {
+		t.Error("Database not converted")
+	}
+	expectStatus(t, gogdbm("", "convert", "-format", "standard", newname), ExitOK)
+}
+
+func TestUsage(t *testing.T) {
+	expectStatus(t, gogdbm(""), ExitUsage)
+	expectStatus(t, gogdbm("", "frobnicate"), ExitUsage)
+	expectStatus(t, gogdbm("", "get", "x"), ExitUsage)
+	expectStatus(t, gogdbm("", "count", "-bogus", "x"), ExitUsage)
+	expectStatus(t, gogdbm("", "dump", "-format", "xml", "x"), ExitUsage)
+	expectStatus(t, gogdbm("", "help"), ExitOK)
+
+	res := gogdbm("", "version")
+	expectStatus(t, res, ExitOK)
+	if res.stdout != gdbm.VersionString() + "\n" {
+		t.Errorf("version returned %q", res.stdout)
+	}
+
+	expectStatus(t, gogdbm("", "count", filepath.Join(t.TempDir(), "nonexistent")),
+		ExitGdbmBase + gdbm.GDBM_FILE_OPEN_ERROR)
+	expectStatus(t, gogdbm("", "snapshot-restore", filepath.Join(t.TempDir(), "nonexistent")),
+		ExitFailure)
+}
+
+func TestExitCode(t *testing.T) {
+	for _, tc := range []struct {
+		err error
+		status int
+	}{
+		{nil, ExitOK},
+		{usagef("bad"), ExitUsage},
+		{os.ErrNotExist, ExitFailure},
+		{gdbm.ErrItemNotFound, ExitGdbmBase + gdbm.GDBM_ITEM_NOT_FOUND},
+		{gdbm.ErrNotOpen, ExitFailure},
+		{gdbm.ErrNotImplemented, ExitFailure},
+		{gdbm.ErrorFromCode(gdbm.GDBM_NO_ERROR), ExitFailure},
+	} {
+		if status := exitCode(tc.err); status != tc.status {
+			t.Errorf("exitCode(%v) = %d, expected %d", tc.err, status, tc.status)
+		}
+	}
+}
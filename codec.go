@@ -0,0 +1,150 @@
+//go:build go1.18
+
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+)
+
+// Codec converts values of type T to and from their database
+// representation.  Decode must not retain data after returning.
+type Codec[T any] interface {
+	Encode(value T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// StringCodec stores strings as is.
+type StringCodec struct{}
+
+func (StringCodec) Encode(s string) ([]byte, error) {
+	return []byte(s), nil
+}
+
+func (StringCodec) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
+
+// BytesCodec stores byte slices as is.
+type BytesCodec struct{}
+
+func (BytesCodec) Encode(b []byte) ([]byte, error) {
+	return b, nil
+}
+
+func (BytesCodec) Decode(data []byte) ([]byte, error) {
+	return append([]byte{}, data...), nil
+}
+
+// Integer is a constraint for fixed-size integer types.
+type Integer interface {
+	~int8 | ~int16 | ~int32 | ~int64 |
+		~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+// ErrBadIntegerSize is returned by BigEndian.Decode if the size of the
+// data doesn't match the size of the integer type.
+var ErrBadIntegerSize = errors.New("bad integer size")
+
+// BigEndian stores integers in big-endian byte order, using the size of
+// the integer type.  Non-negative integers stored this way sort in the
+// same order as their byte representations.
+type BigEndian[T Integer] struct{}
+
+func (BigEndian[T]) size() int {
+	var v T
+	return binary.Size(v)
+}
+
+func (c BigEndian[T]) Encode(v T) ([]byte, error) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(v))
+	return buf[8-c.size():], nil
+}
+
+func (c BigEndian[T]) Decode(data []byte) (T, error) {
+	if len(data) != c.size() {
+		return 0, ErrBadIntegerSize
+	}
+	var buf [8]byte
+	copy(buf[8-len(data):], data)
+	return T(binary.BigEndian.Uint64(buf[:])), nil
+}
+
+// JSONCodec stores values in JSON format.
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec[T]) Decode(data []byte) (v T, err error) {
+	err = json.Unmarshal(data, &v)
+	return
+}
+
+// GobCodec stores values using encoding/gob.  Each value is encoded as
+// a self-contained gob stream, including the type description.
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Encode(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[T]) Decode(data []byte) (v T, err error) {
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return
+}
+
+// BinaryCodec stores fixed-size values (numbers, and structures and
+// arrays of them) using encoding/binary.
+type BinaryCodec[T any] struct {
+	Order binary.ByteOrder
+	// Byte order to use.  Defaults to binary.BigEndian.
+}
+
+func (c BinaryCodec[T]) order() binary.ByteOrder {
+	if c.Order == nil {
+		return binary.BigEndian
+	}
+	return c.Order
+}
+
+func (c BinaryCodec[T]) Encode(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, c.order(), v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c BinaryCodec[T]) Decode(data []byte) (v T, err error) {
+	if len(data) != binary.Size(v) {
+		return v, errors.New("binary codec: data size doesn't match the type")
+	}
+	err = binary.Read(bytes.NewReader(data), c.order(), &v)
+	return
+}
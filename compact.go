@@ -0,0 +1,260 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+import (
+	"errors"
+	"github.com/graygnuorg/go-gdbm/format"
+	"os"
+	"path/filepath"
+)
+
+// Suffix appended to the database file name to obtain the default name
+// of the compacted copy.
+const CompactSuffix = ".compact"
+
+var (
+	ErrCompacting = errors.New("gdbm: compaction already in progress")
+	// Returned by Compact if another compaction is running.
+	ErrCompactAborted = errors.New("gdbm: compaction aborted by a bulk update")
+	// Returned by Compact if the database was loaded from a dump or
+	// recovered while copying.
+)
+
+// SwapError is returned by Compact if the compacted file has replaced the
+// database file and has been reopened, but setting it up failed: the
+// tuning options, crash tolerance or the ordered index could not be
+// restored.  The database remains open on the new file and holds all the
+// data, but the failed part of its setup is missing.  Closing and opening
+// the database again restores it.
+type SwapError struct {
+	Err error
+	// Error encountered when setting up the new file.
+}
+
+func (err *SwapError) Error() string {
+	return "gdbm: database file replaced, but not set up: " + err.Err.Error()
+}
+
+func (err *SwapError) Unwrap() error {
+	return err.Err
+}
+
+// Compaction in progress.
+type compaction struct {
+	dirty map[string]struct{}
+	// Keys written since the copy started.
+	aborted bool
+	// True if the database was changed in a way that can't be
+	// replayed.
+}
+
+// Remember a key written during compaction.  The caller must hold the
+// database lock.
+func (db *Database) noteDirty(key []byte) {
+	if db.compact != nil {
+		db.compact.dirty[string(key)] = struct{}{}
+	}
+}
+
+// Abort the compaction in progress, if any.  The caller must hold the
+// database lock.
+func (db *Database) abortCompaction() {
+	if db.compact != nil {
+		db.compact.aborted = true
+	}
+}
+
+// Compact rewrites the database into a new file, dropping the free space,
+// and replaces the database file with it.  Unlike Reorganize, it doesn't
+// hold the database lock while copying the data.  First, a sorted snapshot
+// of the keys is taken (see SortedScan).  This holds the read lock for the
+// whole key walk: other goroutines can read the database meanwhile, but
+// writes wait until it is over.  Then the records are copied into the file
+// dst one by one, without holding the lock, while other goroutines
+// continue to read and write the database.  Finally, the writes made during
+// the copy are replayed into the new file, which is atomically renamed
+// over the database file and reopened.
+//
+// The dst file must be on the same file system as the database.  If it
+// is empty, the database file name with CompactSuffix appended is used.
+// On error, dst is removed and the database is left intact, except in two
+// cases when the new file has already been renamed over the database
+// file.  If it can't be reopened, the database is left closed.  Its
+// methods then return ErrNotOpen, and background synchronization and
+// reorganization do nothing.  Close must still be called to stop them (it
+// returns ErrNotOpen as well), after which the database can be opened
+// again.  If it is reopened, but can't be set up completely, a *SwapError
+// is returned and the database remains open on the new file.
+//
+// The new file has the same block size and format as the original one.
+// Tuning options, crash tolerance and the ordered index are preserved.
+// The database must not be open in ModeReader.
+func (db *Database) Compact(dst string) (err error) {
+	db.sync.Lock()
+	if db.dbf == nil {
+		db.sync.Unlock()
+		return ErrNotOpen
+	}
+	if db.mode == ModeReader {
+		db.sync.Unlock()
+		return ErrReaderCantReorganize
+	}
+	if db.compact != nil {
+		db.sync.Unlock()
+		return ErrCompacting
+	}
+	ndb, dst, err := db.startCompaction(dst)
+	db.sync.Unlock()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			ndb.Close()
+			if dst != "" {
+				os.Remove(dst)
+			}
+		}
+		db.sync.Lock()
+		db.compact = nil
+		db.sync.Unlock()
+	}()
+
+	if err = db.copyTo(ndb, filepath.Dir(dst)); err != nil {
+		return
+	}
+
+	db.sync.Lock()
+	defer db.sync.Unlock()
+	if db.dbf == nil {
+		return ErrNotOpen
+	}
+	if db.compact.aborted {
+		return ErrCompactAborted
+	}
+	if err = db.replay(ndb); err != nil {
+		return
+	}
+	if err = ndb.Close(); err != nil {
+		return
+	}
+	if err = db.replaceFile(dst); err != nil {
+		var serr *SwapError
+		if db.dbf != nil && !errors.As(err, &serr) {
+			// Renaming failed.
+			return
+		}
+		// The new file is in place, but could not be reopened or
+		// set up.  There's nothing to remove.
+		dst = ""
+	}
+	return
+}
+
+// Create the new database file and start tracking writes.  The caller
+// must hold the database lock.
+func (db *Database) startCompaction(dst string) (*Database, string, error) {
+	// Flush cached buckets, so that the header read below is up to
+	// date.
+	if err := db.syncFile(); err != nil {
+		return nil, "", err
+	}
+	name, err := db.fileName()
+	if err != nil {
+		return nil, "", err
+	}
+	if dst == "" {
+		dst = name + CompactSuffix
+	}
+	f, err := format.Open(name)
+	if err != nil {
+		return nil, "", statsError(err)
+	}
+	h := f.Header
+	f.Close()
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cfg := DatabaseConfig{
+		FileName: dst,
+		Mode: ModeNewdb,
+		BlockSize: h.BlockSize,
+		FileMode: int(fi.Mode().Perm()),
+	}
+	if h.Numsync {
+		cfg.Flags |= OF_NUMSYNC
+	}
+	ndb, err := OpenConfig(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	db.compact = &compaction{dirty: make(map[string]struct{})}
+	return ndb, dst, nil
+}
+
+// If not nil, called after copying each record.  Used in tests.
+var compactCopyHook func()
+
+// Copy live records to ndb.  The keys are copied in sorted order, from a
+// snapshot taken at the start under the read lock.  Each value is fetched
+// separately, so that the database remains available to other goroutines.
+func (db *Database) copyTo(ndb *Database, tmpdir string) error {
+	c, err := db.SortedScan(SortConfig{TempDir: tmpdir})
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for c.Next() {
+		value := c.Value()
+		if value == nil {
+			// Deleted since the snapshot was taken.
+			continue
+		}
+		if err := ndb.Store(c.Key(), value, true); err != nil {
+			return err
+		}
+		if compactCopyHook != nil {
+			compactCopyHook()
+		}
+	}
+	return c.Err()
+}
+
+// Apply the writes made during the copy to ndb.  The caller must hold the
+// database lock.
+func (db *Database) replay(ndb *Database) error {
+	for k := range db.compact.dirty {
+		key := []byte(k)
+		value, err := db.fetch(key)
+		if err == nil {
+			err = ndb.Store(key, value, true)
+		} else if errors.Is(err, ErrItemNotFound) {
+			err = ndb.Delete(key)
+			if errors.Is(err, ErrItemNotFound) {
+				err = nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCompact(t *testing.T) {
+	db := openReorgDatabase(t, DatabaseConfig{CacheSize: 32})
+	fragmentDatabase(t, db)
+	if err := db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(dbname)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Compact(""); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(dbname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Size() >= before.Size() {
+		t.Errorf("file size didn't shrink: %d -> %d", before.Size(), after.Size())
+	}
+	if _, err := os.Stat(dbname + CompactSuffix); !os.IsNotExist(err) {
+		t.Errorf("temporary file left: %v", err)
+	}
+	verifyReorgDatabase(t, db)
+	if n, err := db.CacheSize(); err != nil || n != 32 {
+		t.Errorf("cache size not preserved: %d, %v", n, err)
+	}
+
+	// The database remains usable.
+	if err := db.Store([]byte("new"), []byte("value"), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, err := db.Fetch([]byte("new")); err != nil || string(v) != "value" {
+		t.Errorf("fetch after reopen returned %q, %v", v, err)
+	}
+	if n, _ := db.Count(); n != reorgKeys / 10 + 1 {
+		t.Errorf("expected %d keys, got %d", reorgKeys / 10 + 1, n)
+	}
+}
+
+func TestCompactConcurrent(t *testing.T) {
+	db := openReorgDatabase(t, DatabaseConfig{})
+	fragmentDatabase(t, db)
+
+	// Expected database contents.
+	expect := make(map[string][]byte)
+	for i := 0; i < reorgKeys; i += 10 {
+		expect[strconv.Itoa(i)] = reorgValue
+	}
+
+	// Overwrite, delete and add keys while the records are copied.
+	// Keys are visited in sorted order, so that both copied and not
+	// yet copied ones are modified.
+	var writeErr error
+	step := 0
+	compactCopyHook = func() {
+		if writeErr != nil {
+			return
+		}
+		i := (step * 70 + 10) % reorgKeys
+		if i == 0 {
+			// Leave "0" for the reader.
+			i = 10
+		}
+		key := strconv.Itoa(i)
+		switch step % 4 {
+		case 0:
+			value := []byte("w" + key)
+			writeErr = db.Store([]byte(key), value, true)
+			expect[key] = value
+		case 1:
+			writeErr = db.Delete([]byte(key))
+			if errors.Is(writeErr, ErrItemNotFound) {
+				writeErr = nil
+			}
+			delete(expect, key)
+		case 2:
+			b := db.NewBatch()
+			b.Put([]byte("b" + key), []byte(key), true)
+			writeErr = b.Commit()
+			expect["b" + key] = []byte(key)
+		case 3:
+			writeErr = db.Store([]byte("n" + key), []byte(key), true)
+			expect["n" + key] = []byte(key)
+		}
+		step++
+	}
+	defer func() {
+		compactCopyHook = nil
+	}()
+
+	// Read concurrently with compaction.
+	stop := make(chan struct{})
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				readErr <- nil
+				return
+			default:
+			}
+			if _, err := db.Fetch([]byte("0")); err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	err := db.Compact("")
+	close(stop)
+	if e := <-readErr; e != nil {
+		t.Errorf("read failed: %v", e)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	if step == 0 {
+		t.Fatal("no writes during compaction")
+	}
+
+	n, err := db.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(n) != len(expect) {
+		t.Errorf("expected %d keys, got %d", len(expect), n)
+	}
+	for k, v := range expect {
+		got, err := db.Fetch([]byte(k))
+		if err != nil {
+			t.Fatalf("key %q: %v", k, err)
+		}
+		if !bytes.Equal(got, v) {
+			t.Fatalf("key %q: expected %q, got %q", k, v, got)
+		}
+	}
+}
+
+func TestCompactAborted(t *testing.T) {
+	db := openReorgDatabase(t, DatabaseConfig{})
+	compactCopyHook = func() {
+		db.sync.Lock()
+		db.abortCompaction()
+		db.sync.Unlock()
+	}
+	defer func() {
+		compactCopyHook = nil
+	}()
+	if err := db.Compact(""); !errors.Is(err, ErrCompactAborted) {
+		t.Errorf("expected ErrCompactAborted, got %v", err)
+	}
+	if _, err := os.Stat(dbname + CompactSuffix); !os.IsNotExist(err) {
+		t.Errorf("temporary file left: %v", err)
+	}
+	if n, err := db.Count(); err != nil || n != reorgKeys {
+		t.Errorf("database damaged: %d keys, %v", n, err)
+	}
+}
+
+func TestCompactReopenFailure(t *testing.T) {
+	db := openReorgDatabase(t, DatabaseConfig{
+		SyncInterval: 10 * time.Millisecond,
+		ReorganizeThreshold: 0.5,
+		ReorganizeAfter: 1,
+		ReorganizeIdle: 10 * time.Millisecond,
+	})
+	// Make reopening fail.
+	replaceFileHook = func() {
+		os.Remove(dbname)
+	}
+	defer func() {
+		replaceFileHook = nil
+	}()
+	if err := db.Compact(""); err == nil {
+		t.Fatal("Compact succeeded")
+	}
+
+	// The database is left closed, but background goroutines keep
+	// running until Close.
+	if err := db.Delete([]byte("0")); !errors.Is(err, ErrNotOpen) {
+		t.Errorf("expected ErrNotOpen, got %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := db.Close(); !errors.Is(err, ErrNotOpen) {
+		t.Errorf("expected ErrNotOpen, got %v", err)
+	}
+}
+
+func TestCompactSetupFailure(t *testing.T) {
+	db := openReorgDatabase(t, DatabaseConfig{Index: true})
+	t.Cleanup(func() {
+		os.RemoveAll(dbname + IndexSuffix)
+	})
+	fragmentDatabase(t, db)
+	// Make saving the index fail after the new file is reopened.
+	replaceFileHook = func() {
+		name := dbname + IndexSuffix
+		os.Remove(name)
+		os.Mkdir(name, 0755)
+		os.WriteFile(filepath.Join(name, "x"), nil, 0644)
+	}
+	defer func() {
+		replaceFileHook = nil
+	}()
+	var serr *SwapError
+	if err := db.Compact(""); !errors.As(err, &serr) {
+		t.Fatalf("expected SwapError, got %v", err)
+	}
+
+	// The database is open on the new file.
+	verifyReorgDatabase(t, db)
+	if _, err := os.Stat(dbname + CompactSuffix); !os.IsNotExist(err) {
+		t.Errorf("temporary file left: %v", err)
+	}
+	if err := db.Store([]byte("new"), reorgValue, false); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCompactIndex(t *testing.T) {
+	db := openReorgDatabase(t, DatabaseConfig{Index: true})
+	t.Cleanup(func() {
+		os.Remove(dbname + IndexSuffix)
+	})
+	fragmentDatabase(t, db)
+	if err := db.Compact(""); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CheckIndex(); err != nil {
+		t.Error(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenConfig(DatabaseConfig{FileName: dbname, Mode: ModeReader, Index: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.CheckIndex(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCompactErrors(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Compact(""); !errors.Is(err, ErrReaderCantReorganize) {
+		t.Errorf("expected ErrReaderCantReorganize, got %v", err)
+	}
+	db.Close()
+	if err := db.Compact(""); !errors.Is(err, ErrNotOpen) {
+		t.Errorf("expected ErrNotOpen, got %v", err)
+	}
+
+	db, err = Open(dbname, ModeWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	dst := t.TempDir() + "/nonexistent/junk.gdbm"
+	if err := db.Compact(dst); err == nil {
+		t.Error("compacting into a nonexistent directory succeeded")
+	}
+	if n, err := db.Count(); err != nil || n != uint(len(keys)) {
+		t.Errorf("database damaged: %d keys, %v", n, err)
+	}
+}
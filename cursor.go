@@ -0,0 +1,213 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+/*
+#include <stdlib.h>
+#include <gdbm.h>
+*/
+import "C"
+
+import (
+	"context"
+	"errors"
+	"unsafe"
+)
+
+// Cursor visits all keys in the database, in unspecified order.
+//
+// Example:
+//	c := db.Cursor()
+//	defer c.Close()
+//	for c.Next() {
+//		do_something(c.Key(), c.Value())
+//	}
+//	if err := c.Err(); err != nil {
+//		panic(err)
+//	}
+//
+// As with Iterator, the database must not be modified while iterating
+// over it.
+type Cursor struct {
+	db *Database
+	ctx context.Context
+	cur C.datum
+	// Current key, as returned by the library.
+	key []byte
+	value []byte
+	fetched bool
+	started bool
+	done bool
+	resumed bool
+	// Created by CursorAfter, and Next was not called yet.
+	match func(key []byte) bool
+	// If not nil, keys for which it returns false are skipped.  The
+	// argument points to memory owned by the library.
+	err error
+}
+
+// Cursor returns a new cursor, positioned before the first key.
+func (db *Database) Cursor() *Cursor {
+	return db.CursorContext(context.Background())
+}
+
+// CursorContext returns a new cursor that stops when ctx is done.  In that
+// case, Err returns the context error.
+func (db *Database) CursorContext(ctx context.Context) *Cursor {
+	return &Cursor{db: db, ctx: ctx}
+}
+
+// CursorAfter returns a new cursor positioned at the key, so that Next
+// advances to the key following it in iteration order.  This allows
+// resuming an iteration, e.g. when paginating.  If the key doesn't exist
+// in the database, the iteration ends immediately with ErrItemNotFound.
+func (db *Database) CursorAfter(key []byte) *Cursor {
+	return db.CursorAfterContext(context.Background(), key)
+}
+
+// CursorAfterContext is like CursorAfter, but the returned cursor stops
+// when ctx is done.
+func (db *Database) CursorAfterContext(ctx context.Context, key []byte) *Cursor {
+	c := db.CursorContext(ctx)
+	c.started = true
+	c.resumed = true
+	c.cur = C.datum{dptr: (*C.char)(C.CBytes(key)), dsize: C.int(len(key))}
+	c.key = append([]byte{}, key...)
+	return c
+}
+
+// Free the current key and mark the cursor as exhausted.
+func (c *Cursor) release() {
+	if c.cur.dptr != nil {
+		C.free(unsafe.Pointer(c.cur.dptr))
+		c.cur.dptr = nil
+	}
+	c.key = nil
+	c.value = nil
+	c.done = true
+}
+
+// Advance the cursor to the next key.  Returns false when there are no
+// more keys or an error occurred.
+func (c *Cursor) Next() bool {
+	if c.done {
+		return false
+	}
+
+	db := c.db
+	db.sync.RLock()
+	defer db.sync.RUnlock()
+	for {
+		if err := c.ctx.Err(); err != nil {
+			c.err = err
+			c.release()
+			return false
+		}
+		if db.dbf == nil {
+			c.err = ErrNotOpen
+			c.release()
+			return false
+		}
+
+		var next C.datum
+		var err error
+		resumed := c.resumed
+		c.resumed = false
+		if c.started {
+			next = C.gdbm_nextkey(db.dbf, c.cur)
+			if next.dptr == nil {
+				err = lastSequentialError()
+				// The library reports the same error when the key is
+				// not found and at the end of the database.  Tell the
+				// two apart for resumed cursors.
+				if resumed && errors.Is(err, ErrItemNotFound) &&
+					C.gdbm_exists(db.dbf, c.cur) == 1 {
+					err = nil
+				}
+			}
+			C.free(unsafe.Pointer(c.cur.dptr))
+		} else {
+			c.started = true
+			next = C.gdbm_firstkey(db.dbf)
+			if next.dptr == nil {
+				err = lastSequentialError()
+			}
+		}
+		c.cur = next
+		c.value = nil
+		c.fetched = false
+		if next.dptr == nil {
+			if !errors.Is(err, ErrItemNotFound) || resumed {
+				c.err = err
+			}
+			c.release()
+			return false
+		}
+		if c.match == nil || c.match(cSlice(next)) {
+			c.key = C.GoBytes(unsafe.Pointer(next.dptr), next.dsize)
+			return true
+		}
+	}
+}
+
+// Returns the key at the current cursor position, or nil if the cursor
+// is not positioned on a key.
+func (c *Cursor) Key() []byte {
+	return c.key
+}
+
+// Returns the value associated with the current key.  The value is fetched
+// on the first call and cached.  On error, nil is returned, the iteration
+// stops and Err reports the error.
+func (c *Cursor) Value() []byte {
+	if c.cur.dptr == nil {
+		return nil
+	}
+	if !c.fetched {
+		db := c.db
+		db.sync.RLock()
+		defer db.sync.RUnlock()
+		if db.dbf == nil {
+			c.err = ErrNotOpen
+			c.release()
+			return nil
+		}
+		vdat := C.gdbm_fetch(db.dbf, c.cur)
+		if vdat.dptr == nil {
+			c.err = db.lastError()
+			c.release()
+			return nil
+		}
+		c.value = C.GoBytes(unsafe.Pointer(vdat.dptr), vdat.dsize)
+		C.free(unsafe.Pointer(vdat.dptr))
+		c.fetched = true
+	}
+	return c.value
+}
+
+// Returns the error that stopped the iteration, if any.  Reaching the end
+// of the database is not an error.
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// Close the cursor and release the resources associated with it.  It is
+// safe to call Close several times.
+func (c *Cursor) Close() error {
+	c.release()
+	return nil
+}
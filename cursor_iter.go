@@ -0,0 +1,83 @@
+//go:build go1.23
+
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+import (
+	"iter"
+)
+
+// Keys returns an iterator over the remaining keys.  The cursor is closed
+// when the iteration ends.  Use c.Err() to check for errors afterwards.
+func (c *Cursor) Keys() iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		defer c.Close()
+		for c.Next() {
+			if !yield(c.Key()) {
+				return
+			}
+		}
+	}
+}
+
+// All returns an iterator over the remaining key/value pairs.  The cursor
+// is closed when the iteration ends.  Use c.Err() to check for errors
+// afterwards.
+func (c *Cursor) All() iter.Seq2[[]byte, []byte] {
+	return func(yield func([]byte, []byte) bool) {
+		defer c.Close()
+		for c.Next() {
+			key := c.Key()
+			value := c.Value()
+			if value == nil {
+				return
+			}
+			if !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// Keys returns an iterator over all keys in the database:
+//
+//	for key := range db.Keys() {
+//		do_something(key)
+//	}
+//
+// The iteration silently stops on error.  Use Cursor if you need to
+// handle errors.
+func (db *Database) Keys() iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		db.Cursor().Keys()(yield)
+	}
+}
+
+// All returns an iterator over all key/value pairs in the database:
+//
+//	for key, value := range db.All() {
+//		do_something(key, value)
+//	}
+//
+// The iteration silently stops on error.  Use Cursor if you need to
+// handle errors.
+func (db *Database) All() iter.Seq2[[]byte, []byte] {
+	return func(yield func([]byte, []byte) bool) {
+		db.Cursor().All()(yield)
+	}
+}
@@ -0,0 +1,75 @@
+//go:build go1.23
+
+package gdbm
+
+import (
+	"testing"
+	"strconv"
+)
+
+func TestRangeAll(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	keymap := make(map[string]int)
+	for i, key := range keys {
+		keymap[key] = i
+	}
+	for key, value := range db.All() {
+		n, ok := keymap[string(key)]
+		if !ok {
+			t.Errorf("Unexpected key %q", key)
+			continue
+		}
+		if string(value) != strconv.Itoa(n) {
+			t.Errorf("Wrong value for %q: %q", key, value)
+		}
+		delete(keymap, string(key))
+	}
+	if len(keymap) != 0 {
+		t.Error("Some keys missing")
+	}
+}
+
+func TestRangeKeys(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	n := 0
+	for range db.Keys() {
+		n++
+	}
+	if n != len(keys) {
+		t.Errorf("Expected %d keys, got %d", len(keys), n)
+	}
+
+	// Break out early and make sure the sequence can be restarted.
+	n = 0
+	for range db.Keys() {
+		n++
+		if n == 2 {
+			break
+		}
+	}
+	n = 0
+	for range db.Keys() {
+		n++
+	}
+	if n != len(keys) {
+		t.Errorf("Restarted: expected %d keys, got %d", len(keys), n)
+	}
+}
@@ -0,0 +1,187 @@
+package gdbm
+
+import (
+	"testing"
+	"context"
+	"errors"
+	"strconv"
+)
+
+func TestCursor(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	keymap := make(map[string]int)
+	for i, key := range keys {
+		keymap[key] = i
+	}
+
+	c := db.Cursor()
+	defer c.Close()
+	for c.Next() {
+		key := string(c.Key())
+		n, ok := keymap[key]
+		if !ok {
+			t.Errorf("Unexpected key %q", key)
+			continue
+		}
+		if string(c.Value()) != strconv.Itoa(n) {
+			t.Errorf("Wrong value for %q: %q", key, c.Value())
+		}
+		delete(keymap, key)
+	}
+	if err := c.Err(); err != nil {
+		t.Error("iterating failed: ", err)
+	}
+	if len(keymap) != 0 {
+		t.Error("Some keys missing")
+	}
+	if c.Next() {
+		t.Error("Next succeeded after the end of iteration")
+	}
+}
+
+func TestCursorEarlyClose(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	c := db.Cursor()
+	if !c.Next() {
+		t.Fatal("Next failed: ", c.Err())
+	}
+	c.Close()
+	if c.Next() || c.Key() != nil || c.Value() != nil {
+		t.Error("Cursor usable after Close")
+	}
+	if err := c.Err(); err != nil {
+		t.Error("Unexpected error: ", err)
+	}
+}
+
+func TestCursorContext(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := db.CursorContext(ctx)
+	defer c.Close()
+	n := 0
+	for c.Next() {
+		n++
+		if n == 3 {
+			cancel()
+		}
+	}
+	if n != 3 {
+		t.Errorf("Expected 3 keys, got %d", n)
+	}
+	if !errors.Is(c.Err(), context.Canceled) {
+		t.Error("Unexpected error: ", c.Err())
+	}
+}
+
+func TestCursorNotOpen(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	c := db.Cursor()
+	if !c.Next() {
+		t.Fatal("Next failed: ", c.Err())
+	}
+	db.Close()
+	if c.Next() {
+		t.Error("Next succeeded on closed database")
+	}
+	if !errors.Is(c.Err(), ErrNotOpen) {
+		t.Error("Unexpected error: ", c.Err())
+	}
+}
+
+func TestCursorAfter(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	var order []string
+	c := db.Cursor()
+	for c.Next() {
+		order = append(order, string(c.Key()))
+	}
+	if c.Err() != nil {
+		t.Fatal(c.Err())
+	}
+
+	// Resume from each key in turn
+	for i, k := range order {
+		c := db.CursorAfter([]byte(k))
+		var rest []string
+		for c.Next() {
+			rest = append(rest, string(c.Key()))
+		}
+		if c.Err() != nil {
+			t.Errorf("Resuming after %q: %v", k, c.Err())
+		}
+		if len(rest) != len(order) - i - 1 {
+			t.Errorf("Resuming after %q: got %v", k, rest)
+			continue
+		}
+		for j := range rest {
+			if rest[j] != order[i+j+1] {
+				t.Errorf("Resuming after %q: got %v", k, rest)
+				break
+			}
+		}
+	}
+
+	c = db.CursorAfter([]byte("zero"))
+	if c.Next() {
+		t.Error("Next succeeded after a nonexistent key")
+	}
+	if !errors.Is(c.Err(), ErrItemNotFound) {
+		t.Error("Unexpected error: ", c.Err())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c = db.CursorAfterContext(ctx, []byte(order[0]))
+	defer c.Close()
+	if c.Next() {
+		t.Error("Next succeeded with a canceled context")
+	}
+	if !errors.Is(c.Err(), context.Canceled) {
+		t.Error("Unexpected error: ", c.Err())
+	}
+}
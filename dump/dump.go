@@ -0,0 +1,577 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+// Package dump reads and writes GDBM dump files in ASCII and binary
+// formats (https://www.gnu.org.ua/software/gdbm/manual/Flat-files.html).
+// It is written in pure Go and works on arbitrary io.Reader and io.Writer
+// streams, so dumps can be sent over pipes, compressed or kept in memory
+// without involving libgdbm.
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// Dump file formats.  The values are the same as those of gdbm.BinaryDump
+// and gdbm.AsciiDump.
+const (
+	BinaryDump = 0
+	AsciiDump  = 1
+)
+
+const (
+	// Maximum length of a base64 line in ASCII dumps.
+	maxLineLen = 76
+	// Layout of the creation date in ASCII dumps (see ctime(3)).
+	dateLayout = "Mon Jan _2 15:04:05 2006"
+	// Default creator name.
+	defaultCreator = "go-gdbm"
+	// Version of the ASCII dump format produced by this package.
+	asciiVersion = "1.1"
+)
+
+// Binary dumps store record lengths in C long integers, in network byte
+// order.  Thus their layout depends on the platform where the dump was
+// created.  NativeSizeWidth is the width of C long on this platform.
+var NativeSizeWidth = func() int {
+	if runtime.GOOS == "windows" {
+		return 4
+	}
+	return strconv.IntSize / 8
+}()
+
+var nativeBigEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 0
+}()
+
+// Header keeps the metadata of an ASCII dump.  For binary dumps, only the
+// Creator field is used.
+type Header struct {
+	Creator string
+	// Name and version of the software that created the dump, e.g.
+	// "GDBM version 1.23. 04/02/2022".
+	Date time.Time
+	// Creation date.
+	Version string
+	// Dump format version.
+	File string
+	// Name of the database file.
+	UID int
+	// Owner UID, or -1 if unknown.
+	User string
+	// Owner name.
+	GID int
+	// Owner GID, or -1 if unknown.
+	Group string
+	// Owner group name.
+	Mode int
+	// File permission bits, or -1 if unknown.
+	Numsync bool
+	// True if the database was in extended (numsync) format.
+}
+
+// NewHeader returns a header with unknown ownership and mode.
+func NewHeader() *Header {
+	return &Header{UID: -1, GID: -1, Mode: -1, Version: asciiVersion}
+}
+
+// SyntaxError reports a malformed dump file.
+type SyntaxError struct {
+	Line int
+	// Line number (ASCII dumps), or 0.
+	Record int
+	// Ordinal number of the record (1-based) for binary dumps, or 0.
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+	if e.Record > 0 {
+		return fmt.Sprintf("record %d: %s", e.Record, e.Msg)
+	}
+	return e.Msg
+}
+
+// Writer writes a dump file.
+type Writer struct {
+	w *bufio.Writer
+	format int
+	count uint
+	// SizeWidth is the number of bytes used to store record lengths
+	// in binary dumps: 4 or 8.  It defaults to NativeSizeWidth.
+	SizeWidth int
+}
+
+// NewWriter returns a Writer that writes a dump in the given format to w.
+// The header is written immediately.  If hdr is nil, a default header is
+// used.
+func NewWriter(w io.Writer, format int, hdr *Header) (*Writer, error) {
+	if format != BinaryDump && format != AsciiDump {
+		return nil, fmt.Errorf("unsupported dump format: %d", format)
+	}
+	if hdr == nil {
+		hdr = NewHeader()
+	}
+	dw := &Writer{w: bufio.NewWriter(w), format: format, SizeWidth: NativeSizeWidth}
+	creator := hdr.Creator
+	if creator == "" {
+		creator = defaultCreator
+	}
+	if format == BinaryDump {
+		fmt.Fprintf(dw.w, "!\r\n! GDBM FLAT FILE DUMP -- THIS IS NOT A TEXT FILE\r\n! %s\r\n!\r\n", creator)
+	} else {
+		date := hdr.Date
+		if date.IsZero() {
+			date = time.Now()
+		}
+		fmt.Fprintf(dw.w, "# GDBM dump file created by %s on %s\n",
+			creator, date.Format(dateLayout))
+		version := hdr.Version
+		if version == "" {
+			version = asciiVersion
+		}
+		fmt.Fprintf(dw.w, "#:version=%s\n", version)
+		if hdr.File != "" {
+			fmt.Fprintf(dw.w, "#:file=%s\n", hdr.File)
+		}
+		if hdr.UID >= 0 && hdr.GID >= 0 && hdr.Mode >= 0 {
+			fmt.Fprintf(dw.w, "#:uid=%d,", hdr.UID)
+			if hdr.User != "" {
+				fmt.Fprintf(dw.w, "user=%s,", hdr.User)
+			}
+			fmt.Fprintf(dw.w, "gid=%d,", hdr.GID)
+			if hdr.Group != "" {
+				fmt.Fprintf(dw.w, "group=%s,", hdr.Group)
+			}
+			fmt.Fprintf(dw.w, "mode=%03o\n", hdr.Mode & 0777)
+		}
+		if hdr.Numsync {
+			dw.w.WriteString("#:format=numsync\n")
+		} else {
+			dw.w.WriteString("#:format=standard\n")
+		}
+		dw.w.WriteString("# End of header\n")
+	}
+	if err := dw.w.Flush(); err != nil {
+		return nil, err
+	}
+	return dw, nil
+}
+
+func (w *Writer) writeSize(n int) {
+	var buf [8]byte
+	switch w.SizeWidth {
+	case 4:
+		putUint32(buf[:], uint32(n))
+	default:
+		// A 64-bit long holding a 32-bit value in network byte
+		// order.
+		if nativeBigEndian {
+			putUint32(buf[4:], uint32(n))
+		} else {
+			putUint32(buf[:], uint32(n))
+		}
+	}
+	w.w.Write(buf[:w.width()])
+}
+
+func (w *Writer) width() int {
+	if w.SizeWidth == 4 {
+		return 4
+	}
+	return 8
+}
+
+func (w *Writer) writeDatum(d []byte) {
+	if w.format == BinaryDump {
+		w.writeSize(len(d))
+		w.w.Write(d)
+		return
+	}
+	fmt.Fprintf(w.w, "#:len=%d\n", len(d))
+	enc := base64.StdEncoding.EncodeToString(d)
+	for len(enc) > 0 {
+		n := len(enc)
+		if n > maxLineLen {
+			n = maxLineLen
+		}
+		w.w.WriteString(enc[:n])
+		w.w.WriteByte('\n')
+		enc = enc[n:]
+	}
+}
+
+// Write writes a key/value pair to the dump.  The output is buffered:
+// use Flush or Close to write it to the underlying writer.  An error
+// returned by the underlying writer is reported by this and all
+// subsequent calls.
+func (w *Writer) Write(key, value []byte) error {
+	w.writeDatum(key)
+	w.writeDatum(value)
+	w.count++
+	// Writing an empty slice returns the error of the buffered writer,
+	// if any.
+	_, err := w.w.Write(nil)
+	return err
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Count returns the number of records written so far.
+func (w *Writer) Count() uint {
+	return w.count
+}
+
+// Close writes the dump trailer and flushes the buffered data.  It does not
+// close the underlying writer.
+func (w *Writer) Close() error {
+	if w.format == AsciiDump {
+		fmt.Fprintf(w.w, "#:count=%d\n# End of data\n", w.count)
+	}
+	return w.w.Flush()
+}
+
+func putUint32(b []byte, n uint32) {
+	b[0] = byte(n >> 24)
+	b[1] = byte(n >> 16)
+	b[2] = byte(n >> 8)
+	b[3] = byte(n)
+}
+
+func getUint32(b []byte) uint32 {
+	return uint32(b[0]) << 24 | uint32(b[1]) << 16 | uint32(b[2]) << 8 | uint32(b[3])
+}
+
+// Reader reads a dump file.
+type Reader struct {
+	r *bufio.Reader
+	format int
+	hdr *Header
+	line int
+	count uint
+	done bool
+	// SizeWidth is the number of bytes used to store record lengths
+	// in binary dumps: 4 or 8.  It defaults to NativeSizeWidth and
+	// can be changed before reading the first record.
+	SizeWidth int
+}
+
+// NewReader returns a Reader for the dump in r.  The dump format is
+// detected automatically.  The header is read immediately.
+func NewReader(r io.Reader) (*Reader, error) {
+	dr := &Reader{r: bufio.NewReader(r), SizeWidth: NativeSizeWidth}
+	c, err := dr.r.Peek(1)
+	if err != nil {
+		if err == io.EOF {
+			return nil, &SyntaxError{Msg: "empty dump file"}
+		}
+		return nil, err
+	}
+	switch c[0] {
+	case '!':
+		dr.format = BinaryDump
+		err = dr.readBinaryHeader()
+	case '#':
+		dr.format = AsciiDump
+		err = dr.readAsciiHeader()
+	default:
+		err = &SyntaxError{Msg: "unrecognized dump format"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dr, nil
+}
+
+// Format returns the format of the dump: AsciiDump or BinaryDump.
+func (r *Reader) Format() int {
+	return r.format
+}
+
+// Header returns the dump header.
+func (r *Reader) Header() *Header {
+	return r.hdr
+}
+
+// Line returns the number of the last line read from an ASCII dump.
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// Count returns the number of records read so far.
+func (r *Reader) Count() uint {
+	return r.count
+}
+
+func (r *Reader) syntaxError(format string, args ...interface{}) error {
+	e := &SyntaxError{Msg: fmt.Sprintf(format, args...)}
+	if r.format == AsciiDump {
+		e.Line = r.line
+	} else {
+		e.Record = int(r.count) + 1
+	}
+	return e
+}
+
+// Read a line, stripping the trailing newline.
+func (r *Reader) readLine() (string, error) {
+	s, err := r.r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			if s == "" {
+				return "", io.ErrUnexpectedEOF
+			}
+			err = nil
+		} else {
+			return "", err
+		}
+	}
+	r.line++
+	return strings.TrimRight(s, "\r\n"), err
+}
+
+func (r *Reader) readBinaryHeader() error {
+	r.hdr = NewHeader()
+	for i := 0; i < 4; i++ {
+		s, err := r.readLine()
+		if err != nil {
+			return r.syntaxError("reading header: %v", err)
+		}
+		if !strings.HasPrefix(s, "!") {
+			return r.syntaxError("malformed header")
+		}
+		if i == 2 {
+			r.hdr.Creator = strings.TrimSpace(s[1:])
+		}
+	}
+	return nil
+}
+
+const creatorPrefix = "# GDBM dump file created by "
+
+func (r *Reader) readAsciiHeader() error {
+	hdr := NewHeader()
+	hdr.Version = ""
+	r.hdr = hdr
+	for {
+		s, err := r.readLine()
+		if err != nil {
+			return r.syntaxError("reading header: %v", err)
+		}
+		if s == "# End of header" {
+			break
+		}
+		if strings.HasPrefix(s, creatorPrefix) {
+			s = s[len(creatorPrefix):]
+			if n := strings.LastIndex(s, " on "); n != -1 {
+				hdr.Creator = s[:n]
+				hdr.Date, _ = time.ParseInLocation(dateLayout, s[n+4:], time.Local)
+			} else {
+				hdr.Creator = s
+			}
+			continue
+		}
+		if !strings.HasPrefix(s, "#:") {
+			if strings.HasPrefix(s, "#") {
+				continue
+			}
+			return r.syntaxError("unexpected line in header")
+		}
+		for _, kv := range strings.Split(s[2:], ",") {
+			n := strings.IndexByte(kv, '=')
+			if n == -1 {
+				return r.syntaxError("malformed header variable: %s", kv)
+			}
+			if err := r.setHeaderVar(kv[:n], kv[n+1:]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Reader) setHeaderVar(name, value string) (err error) {
+	hdr := r.hdr
+	var n int64
+	switch name {
+	case "version":
+		hdr.Version = value
+	case "file":
+		hdr.File = value
+	case "uid":
+		n, err = strconv.ParseInt(value, 10, 32)
+		hdr.UID = int(n)
+	case "user":
+		hdr.User = value
+	case "gid":
+		n, err = strconv.ParseInt(value, 10, 32)
+		hdr.GID = int(n)
+	case "group":
+		hdr.Group = value
+	case "mode":
+		n, err = strconv.ParseInt(value, 8, 32)
+		hdr.Mode = int(n)
+	case "format":
+		switch value {
+		case "standard":
+			hdr.Numsync = false
+		case "numsync":
+			hdr.Numsync = true
+		default:
+			return r.syntaxError("unknown database format: %s", value)
+		}
+	}
+	// Unknown variables are ignored, for forward compatibility.
+	if err != nil {
+		return r.syntaxError("bad value for %s: %s", name, value)
+	}
+	return nil
+}
+
+// Next returns the next key/value pair from the dump.  At the end of the
+// dump it returns io.EOF.
+func (r *Reader) Next() (key, value []byte, err error) {
+	if r.done {
+		return nil, nil, io.EOF
+	}
+	if r.format == BinaryDump {
+		key, err = r.readBinaryDatum(true)
+		if err == nil {
+			value, err = r.readBinaryDatum(false)
+		}
+	} else {
+		key, err = r.readAsciiDatum(true)
+		if err == nil {
+			value, err = r.readAsciiDatum(false)
+		}
+	}
+	if err != nil {
+		if err == io.EOF {
+			r.done = true
+		}
+		return nil, nil, err
+	}
+	r.count++
+	return
+}
+
+func (r *Reader) readBinaryDatum(first bool) ([]byte, error) {
+	width := 8
+	if r.SizeWidth == 4 {
+		width = 4
+	}
+	var buf [8]byte
+	n, err := io.ReadFull(r.r, buf[:width])
+	if err != nil {
+		if first && n == 0 && err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, r.syntaxError("unexpected end of file")
+	}
+	var size uint32
+	var pad []byte
+	if width == 4 {
+		size = getUint32(buf[:])
+	} else if nativeBigEndian {
+		size = getUint32(buf[4:])
+		pad = buf[:4]
+	} else {
+		size = getUint32(buf[:])
+		pad = buf[4:8]
+	}
+	if !bytes.Equal(pad, make([]byte, len(pad))) || size > 0x7fffffff {
+		return nil, r.syntaxError("bad record length")
+	}
+	d := make([]byte, size)
+	if _, err := io.ReadFull(r.r, d); err != nil {
+		return nil, r.syntaxError("unexpected end of file")
+	}
+	return d, nil
+}
+
+func (r *Reader) readAsciiDatum(first bool) ([]byte, error) {
+	s, err := r.readLine()
+	if err != nil {
+		return nil, r.syntaxError("unexpected end of file")
+	}
+	if first && strings.HasPrefix(s, "#:count=") {
+		return nil, r.readTrailer(s)
+	}
+	if !strings.HasPrefix(s, "#:len=") {
+		return nil, r.syntaxError("expected #:len")
+	}
+	size, err := strconv.ParseUint(s[6:], 10, 31)
+	if err != nil {
+		return nil, r.syntaxError("bad length: %s", s[6:])
+	}
+	var enc strings.Builder
+	for uint64(base64.StdEncoding.DecodedLen(enc.Len())) < size {
+		s, err := r.readLine()
+		if err != nil {
+			return nil, r.syntaxError("unexpected end of file")
+		}
+		if strings.HasPrefix(s, "#") {
+			return nil, r.syntaxError("data too short")
+		}
+		enc.WriteString(s)
+	}
+	d, err := base64.StdEncoding.DecodeString(enc.String())
+	if err != nil {
+		return nil, r.syntaxError("malformed base64 data: %v", err)
+	}
+	if uint64(len(d)) != size {
+		return nil, r.syntaxError("length mismatch: expected %d, got %d", size, len(d))
+	}
+	return d, nil
+}
+
+func (r *Reader) readTrailer(s string) error {
+	count, err := strconv.ParseUint(s[8:], 10, 64)
+	if err != nil {
+		return r.syntaxError("bad count: %s", s[8:])
+	}
+	if uint(count) != r.count {
+		return r.syntaxError("record count mismatch: expected %d, got %d", count, r.count)
+	}
+	for {
+		s, err = r.readLine()
+		if err == io.ErrUnexpectedEOF {
+			return io.EOF
+		}
+		if err != nil {
+			return err
+		}
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		return r.syntaxError("garbage after end of data")
+	}
+}
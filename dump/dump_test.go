@@ -0,0 +1,229 @@
+package dump
+
+import (
+	"testing"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var records = [][2][]byte{
+	{[]byte("one"), []byte("1")},
+	{[]byte("empty"), []byte{}},
+	{[]byte("long"), bytes.Repeat([]byte("x"), 300)},
+	{[]byte{0, 1, 2, 0xff}, []byte{0x80, 0}},
+}
+
+func roundTrip(t *testing.T, format int, width int) {
+	hdr := NewHeader()
+	hdr.File = "test.db"
+	hdr.UID = 1000
+	hdr.User = "user"
+	hdr.GID = 100
+	hdr.Group = "users"
+	hdr.Mode = 0640
+	hdr.Numsync = true
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format, hdr)
+	if err != nil {
+		t.Fatal("NewWriter: ", err)
+	}
+	w.SizeWidth = width
+	for _, rec := range records {
+		if err := w.Write(rec[0], rec[1]); err != nil {
+			t.Fatal("Write: ", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal("Close: ", err)
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal("NewReader: ", err)
+	}
+	r.SizeWidth = width
+	if r.Format() != format {
+		t.Errorf("Format: expected %d, got %d", format, r.Format())
+	}
+	if format == AsciiDump {
+		h := r.Header()
+		if h.File != hdr.File || h.UID != hdr.UID || h.User != hdr.User ||
+			h.GID != hdr.GID || h.Group != hdr.Group ||
+			h.Mode != hdr.Mode || h.Numsync != hdr.Numsync ||
+			h.Version != "1.1" || h.Creator != "go-gdbm" {
+			t.Errorf("Header mismatch: %+v", *h)
+		}
+	}
+	for i, rec := range records {
+		key, value, err := r.Next()
+		if err != nil {
+			t.Fatalf("Record %d: %v", i, err)
+		}
+		if !bytes.Equal(key, rec[0]) || !bytes.Equal(value, rec[1]) {
+			t.Errorf("Record %d: mismatch", i)
+		}
+	}
+	if _, _, err := r.Next(); err != io.EOF {
+		t.Error("Expected EOF, got ", err)
+	}
+}
+
+func TestAsciiRoundTrip(t *testing.T) {
+	roundTrip(t, AsciiDump, NativeSizeWidth)
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	roundTrip(t, BinaryDump, 8)
+	roundTrip(t, BinaryDump, 4)
+}
+
+const asciiSample = `# GDBM dump file created by GDBM version 1.23. 04/02/2022 on Sun Oct 18 07:21:13 2026
+#:version=1.1
+#:file=l.db
+#:uid=0,user=root,gid=0,group=root,mode=600
+#:format=standard
+# End of header
+#:len=4
+bG9uZw==
+#:len=300
+eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4
+eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4
+eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4
+eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4
+eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4
+eHh4eHh4eHh4eHh4eHh4
+#:len=5
+ZW1wdHk=
+#:len=0
+#:len=1
+YQ==
+#:len=2
+YmM=
+#:count=3
+# End of data
+`
+
+func TestAsciiSample(t *testing.T) {
+	r, err := NewReader(strings.NewReader(asciiSample))
+	if err != nil {
+		t.Fatal("NewReader: ", err)
+	}
+	hdr := r.Header()
+	if hdr.Creator != "GDBM version 1.23. 04/02/2022" {
+		t.Errorf("Wrong creator: %q", hdr.Creator)
+	}
+	if hdr.Date.IsZero() {
+		t.Error("Date not parsed")
+	}
+	if hdr.File != "l.db" || hdr.Mode != 0600 || hdr.User != "root" || hdr.Numsync {
+		t.Errorf("Header mismatch: %+v", *hdr)
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, AsciiDump, hdr)
+	if err != nil {
+		t.Fatal("NewWriter: ", err)
+	}
+	for {
+		key, value, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("Next: ", err)
+		}
+		w.Write(key, value)
+	}
+	w.Close()
+	if buf.String() != asciiSample {
+		t.Errorf("Re-encoded dump differs:\n%s", buf.String())
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	header := "# GDBM dump file created by test on " +
+		time.Now().Format(dateLayout) + "\n" +
+		"#:version=1.1\n# End of header\n"
+	for _, tc := range []struct {
+		input string
+		line int
+	}{
+		{"#:len=3\nb25l\n#:len=1\n!!!!\n", 7},
+		{"#:len=3\nb25l\n#:len=10\nMQ==\n#:count=1\n", 8},
+		{"#:len=3\nb25l\n#:lan=1\n", 6},
+		{"#:len=3\nb25l\n#:len=1\nMQ==\n#:count=2\n", 8},
+		{"#:len=3\nb25l\n", 5},
+	} {
+		r, err := NewReader(strings.NewReader(header + tc.input))
+		if err != nil {
+			t.Fatal("NewReader: ", err)
+		}
+		for err == nil {
+			_, _, err = r.Next()
+		}
+		var serr *SyntaxError
+		if !errors.As(err, &serr) {
+			t.Errorf("%q: expected syntax error, got %v", tc.input, err)
+			continue
+		}
+		if serr.Line != tc.line {
+			t.Errorf("%q: expected error at line %d, got %d", tc.input, tc.line, serr.Line)
+		}
+	}
+}
+
+func TestUnrecognized(t *testing.T) {
+	_, err := NewReader(strings.NewReader("garbage"))
+	var serr *SyntaxError
+	if !errors.As(err, &serr) {
+		t.Error("Expected syntax error, got ", err)
+	}
+}
+
+func TestWriterBuffering(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, BinaryDump, nil)
+	if err != nil {
+		t.Fatal("NewWriter: ", err)
+	}
+	n := buf.Len()
+	if err := w.Write([]byte("key"), []byte("value")); err != nil {
+		t.Fatal("Write: ", err)
+	}
+	if buf.Len() != n {
+		t.Error("Write flushed the output")
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal("Flush: ", err)
+	}
+	if buf.Len() == n {
+		t.Error("Flush did not write the output")
+	}
+}
+
+func ExampleWriter() {
+	var buf bytes.Buffer
+	hdr := NewHeader()
+	hdr.Creator = "example"
+	hdr.Date = time.Date(2022, 1, 2, 3, 4, 5, 0, time.Local)
+	w, _ := NewWriter(&buf, AsciiDump, hdr)
+	w.Write([]byte("key"), []byte("value"))
+	w.Close()
+	fmt.Print(buf.String())
+	// Output:
+	// # GDBM dump file created by example on Sun Jan  2 03:04:05 2022
+	// #:version=1.1
+	// #:format=standard
+	// # End of header
+	// #:len=3
+	// a2V5
+	// #:len=5
+	// dmFsdWU=
+	// #:count=1
+	// # End of data
+}
@@ -0,0 +1,132 @@
+//go:build cgo
+
+package dump_test
+
+import (
+	"testing"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"github.com/graygnuorg/go-gdbm"
+	"github.com/graygnuorg/go-gdbm/dump"
+)
+
+// Create a database and dump it using libgdbm.  Return the dump file name.
+func libgdbmDump(t *testing.T, format int) string {
+	dir := t.TempDir()
+	dbname := filepath.Join(dir, "test.gdbm")
+	db, err := gdbm.Open(dbname, gdbm.ModeNewdb)
+	if err != nil {
+		t.Fatal("Can't create the database:", err)
+	}
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		key := []byte("key" + strconv.Itoa(i))
+		// Some versions of libgdbm can't export empty values in
+		// binary format, so make sure all values are non-empty.
+		value := bytes.Repeat([]byte{byte(i)}, i + 1)
+		if err := db.Store(key, value, false); err != nil {
+			t.Fatal("Store: ", err)
+		}
+	}
+	dumpname := filepath.Join(dir, "test.dump")
+	err = db.Dump(gdbm.DumpConfig{FileName: dumpname,
+				   Format: format,
+				   Rewrite: true,
+				   FileMode: 0600})
+	if err != nil {
+		if err == gdbm.ErrNotImplemented {
+			t.Skip("dump not implemented")
+		}
+		t.Fatal("Dump: ", err)
+	}
+	return dumpname
+}
+
+// Read the dump produced by libgdbm and write it back.  The result must
+// be identical to the original.
+func reencode(t *testing.T, format int) {
+	name := libgdbmDump(t, format)
+	orig, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := dump.NewReader(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal("NewReader: ", err)
+	}
+	if r.Format() != format {
+		t.Fatalf("Wrong format detected: %d", r.Format())
+	}
+	var buf bytes.Buffer
+	w, err := dump.NewWriter(&buf, format, r.Header())
+	if err != nil {
+		t.Fatal("NewWriter: ", err)
+	}
+	for {
+		key, value, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("Next: ", err)
+		}
+		if err := w.Write(key, value); err != nil {
+			t.Fatal("Write: ", err)
+		}
+	}
+	w.Close()
+	if r.Count() != 100 {
+		t.Errorf("Expected 100 records, got %d", r.Count())
+	}
+	if !bytes.Equal(buf.Bytes(), orig) {
+		t.Errorf("Re-encoded dump differs from the original")
+	}
+}
+
+func TestReencodeAscii(t *testing.T) {
+	reencode(t, dump.AsciiDump)
+}
+
+func TestReencodeBinary(t *testing.T) {
+	reencode(t, dump.BinaryDump)
+}
+
+// A dump created by the Writer must be loadable by libgdbm.
+func TestLoad(t *testing.T) {
+	for _, format := range []int{dump.AsciiDump, dump.BinaryDump} {
+		dir := t.TempDir()
+		dumpname := filepath.Join(dir, "test.dump")
+		file, err := os.Create(dumpname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := dump.NewWriter(file, format, nil)
+		if err != nil {
+			t.Fatal("NewWriter: ", err)
+		}
+		for i := 0; i < 10; i++ {
+			w.Write([]byte(strconv.Itoa(i)), []byte("value" + strconv.Itoa(i)))
+		}
+		w.Close()
+		file.Close()
+
+		db, err := gdbm.Open(filepath.Join(dir, "test.gdbm"), gdbm.ModeNewdb)
+		if err != nil {
+			t.Fatal("Can't create the database:", err)
+		}
+		if err = db.LoadFromFile(dumpname); err != nil {
+			t.Fatalf("Load (format %d): %v", format, err)
+		}
+		for i := 0; i < 10; i++ {
+			v, err := db.Fetch([]byte(strconv.Itoa(i)))
+			if err != nil || string(v) != "value" + strconv.Itoa(i) {
+				t.Errorf("Format %d: key %d: %q, %v", format, i, v, err)
+			}
+		}
+		db.Close()
+	}
+}
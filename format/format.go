@@ -0,0 +1,630 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+// Package format implements a read-only parser for the GDBM on-disk file
+// format.  It is written in pure Go and does not require libgdbm, so it
+// can be used on hosts where the library is not available, or in programs
+// built with CGO_ENABLED=0.
+//
+// Both standard and extended (numsync) database formats are supported,
+// with 32- and 64-bit file offsets, in either byte order.
+package format
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Magic numbers identifying the file format.
+const (
+	MagicOriginal  = 0x13579ace
+	Magic32        = 0x13579acd
+	Magic64        = 0x13579acf
+	MagicNumsync32 = 0x13579ad0
+	MagicNumsync64 = 0x13579ad1
+)
+
+const (
+	// Number of avail entries kept in each bucket.
+	BucketAvail = 6
+	// Number of initial key bytes kept in a bucket element.
+	SmallKey = 4
+	// Number of significant bits in the hash value.
+	HashBits = 31
+	// Size of the extended header, in bytes.
+	extHeaderSize = 32
+)
+
+var (
+	ErrBadMagic     = errors.New("bad magic number")
+	ErrBadHeader    = errors.New("malformed database file header")
+	ErrBadDirEntry  = errors.New("invalid directory entry")
+	ErrBadBucket    = errors.New("malformed bucket")
+	ErrBadHashEntry = errors.New("incorrect hash table entry")
+	ErrBadAvail     = errors.New("malformed avail table")
+	ErrItemNotFound = errors.New("item not found")
+)
+
+// Offsets and sizes of the on-disk structures.  These depend on the size
+// of the file offset type used by the library that created the file.
+type layout struct {
+	order binary.ByteOrder
+	off int
+}
+
+func (l layout) align(n int) int {
+	return (n + l.off - 1) / l.off * l.off
+}
+
+func (l layout) int(b []byte) int {
+	return int(int32(l.order.Uint32(b)))
+}
+
+func (l layout) offset(b []byte) int64 {
+	if l.off == 4 {
+		return int64(int32(l.order.Uint32(b)))
+	}
+	return int64(l.order.Uint64(b))
+}
+
+func (l layout) headerSize() int   { return l.align(l.off + 28) }
+func (l layout) availElemSize() int { return 2 * l.off }
+func (l layout) availTableOff() int { return l.align(8 + l.off) }
+func (l layout) bucketAvailOff() int { return l.off }
+func (l layout) bucketBitsOff() int {
+	return l.bucketAvailOff() + BucketAvail * l.availElemSize()
+}
+func (l layout) bucketTableOff() int { return l.align(l.bucketBitsOff() + 8) }
+func (l layout) elemSize() int      { return l.align(16 + l.off) }
+
+// AvailElem describes a free area in the file.
+type AvailElem struct {
+	Size int
+	// Size of the area, in bytes.
+	Addr int64
+	// Its file offset.
+}
+
+// AvailBlock is a table of free areas.  The first avail block is stored
+// in the file header.  Subsequent blocks form a linked list.
+type AvailBlock struct {
+	Addr int64
+	// File offset of the block.
+	Size int
+	// Number of slots in the table.
+	Count int
+	// Number of slots in use.
+	Next int64
+	// File offset of the next avail block, or 0.
+	Table []AvailElem
+	// Used slots.
+}
+
+// Header represents the database file header.
+type Header struct {
+	Magic uint32
+	// Magic number.
+	BlockSize int
+	// Block size.
+	Dir int64
+	// File offset of the hash directory.
+	DirSize int
+	// Size of the hash directory, in bytes.
+	DirBits int
+	// Number of hash bits used to index the directory.
+	BucketSize int
+	// Size of a hash bucket, in bytes.
+	BucketElems int
+	// Number of elements in a hash bucket.
+	NextBlock int64
+	// Next unallocated block address.
+	Numsync bool
+	// True if the database is in extended (numsync) format.
+	ExtVersion int
+	// Extended header version.
+	NumsyncCount uint32
+	// Number of synchronizations (extended format only).
+	Avail AvailBlock
+	// The avail block stored in the header.
+	ByteOrder binary.ByteOrder
+	// Byte order of the file.
+	OffsetSize int
+	// Size of file offsets: 4 or 8 bytes.
+}
+
+// BucketElement is an entry of the bucket hash table.
+type BucketElement struct {
+	Hash int32
+	// Hash value of the key, or -1 if the slot is unused.
+	KeyStart [SmallKey]byte
+	// Initial bytes of the key.
+	DataPointer int64
+	// File offset of the record.  The key is stored there, directly
+	// followed by the value.
+	KeySize int
+	// Key length.
+	DataSize int
+	// Value length.
+}
+
+// Returns true if the element is in use.
+func (e *BucketElement) InUse() bool {
+	return e.Hash != -1
+}
+
+// Bucket represents a hash bucket.
+type Bucket struct {
+	Addr int64
+	// File offset of the bucket.
+	Avail []AvailElem
+	// Bucket avail table.
+	Bits int
+	// Number of hash bits used to reach this bucket.
+	Count int
+	// Number of elements in use.
+	Table []BucketElement
+	// The hash table.
+}
+
+// File represents a GDBM database file opened for reading.
+type File struct {
+	Header Header
+	Dir []int64
+	// Hash directory: bucket offsets indexed by the most significant
+	// Header.DirBits bits of the key hash.
+	r io.ReaderAt
+	size int64
+	closer io.Closer
+	lay layout
+}
+
+// Open opens the named database file for reading.
+func Open(name string) (*File, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	st, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	f, err := NewFile(fd, st.Size())
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	f.closer = fd
+	return f, nil
+}
+
+// NewFile creates a new File reading the database from r.  The size
+// argument gives the total size of the database file.
+func NewFile(r io.ReaderAt, size int64) (*File, error) {
+	f := &File{r: r, size: size}
+	if err := f.readHeader(); err != nil {
+		return nil, err
+	}
+	if err := f.readDir(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Close closes the File.  If the File was created using NewFile directly
+// instead of Open, Close has no effect.
+func (f *File) Close() error {
+	if f.closer != nil {
+		err := f.closer.Close()
+		f.closer = nil
+		return err
+	}
+	return nil
+}
+
+// Read exactly len(buf) bytes at offset off.
+func (f *File) readAt(buf []byte, off int64) error {
+	if off < 0 || off + int64(len(buf)) > f.size {
+		return io.ErrUnexpectedEOF
+	}
+	n, err := f.r.ReadAt(buf, off)
+	if n == len(buf) {
+		return nil
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (f *File) readHeader() error {
+	var buf [4]byte
+	if err := f.readAt(buf[:], 0); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadHeader, err)
+	}
+
+	h := &f.Header
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		h.Magic = order.Uint32(buf[:])
+		switch h.Magic {
+		case MagicOriginal, Magic32:
+			h.OffsetSize = 4
+		case MagicNumsync32:
+			h.OffsetSize = 4
+			h.Numsync = true
+		case Magic64:
+			h.OffsetSize = 8
+		case MagicNumsync64:
+			h.OffsetSize = 8
+			h.Numsync = true
+		default:
+			continue
+		}
+		h.ByteOrder = order
+		break
+	}
+	if h.ByteOrder == nil {
+		return ErrBadMagic
+	}
+	lay := layout{order: h.ByteOrder, off: h.OffsetSize}
+	f.lay = lay
+
+	hsize := lay.headerSize()
+	hdr := make([]byte, hsize)
+	if err := f.readAt(hdr, 0); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadHeader, err)
+	}
+	h.BlockSize = lay.int(hdr[4:])
+	h.Dir = lay.offset(hdr[8:])
+	p := 8 + lay.off
+	h.DirSize = lay.int(hdr[p:])
+	h.DirBits = lay.int(hdr[p+4:])
+	h.BucketSize = lay.int(hdr[p+8:])
+	h.BucketElems = lay.int(hdr[p+12:])
+	h.NextBlock = lay.offset(hdr[lay.align(p+16):])
+
+	availOff := int64(hsize)
+	if h.Numsync {
+		ext := make([]byte, extHeaderSize)
+		if err := f.readAt(ext, int64(hsize)); err != nil {
+			return fmt.Errorf("%w: %v", ErrBadHeader, err)
+		}
+		h.ExtVersion = lay.int(ext)
+		h.NumsyncCount = lay.order.Uint32(ext[4:])
+		availOff += extHeaderSize
+	}
+
+	if h.BlockSize <= 0 ||
+		h.DirBits < 0 || h.DirBits > HashBits ||
+		h.DirSize != lay.off << uint(h.DirBits) ||
+		h.Dir < availOff ||
+		h.Dir + int64(h.DirSize) > f.size ||
+		h.BucketElems <= 0 ||
+		h.BucketSize < lay.bucketTableOff() + h.BucketElems * lay.elemSize() ||
+		h.NextBlock > f.size {
+		return ErrBadHeader
+	}
+
+	// The header avail block occupies the rest of the first block.
+	avail, err := f.readAvailBlock(availOff, h.BlockSize - int(availOff))
+	if err != nil {
+		return err
+	}
+	h.Avail = *avail
+	return nil
+}
+
+func (f *File) readDir() error {
+	h := &f.Header
+	buf := make([]byte, h.DirSize)
+	if err := f.readAt(buf, h.Dir); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadHeader, err)
+	}
+	n := h.DirSize / f.lay.off
+	f.Dir = make([]int64, n)
+	for i := 0; i < n; i++ {
+		addr := f.lay.offset(buf[i*f.lay.off:])
+		if addr < int64(h.BlockSize) || addr + int64(h.BucketSize) > f.size {
+			return fmt.Errorf("%w: entry %d: offset %d", ErrBadDirEntry, i, addr)
+		}
+		f.Dir[i] = addr
+	}
+	return nil
+}
+
+func (f *File) parseAvailTable(buf []byte, n int) []AvailElem {
+	lay := f.lay
+	tab := make([]AvailElem, n)
+	for i := range tab {
+		p := buf[i*lay.availElemSize():]
+		tab[i].Size = lay.int(p)
+		tab[i].Addr = lay.offset(p[lay.off:])
+	}
+	return tab
+}
+
+func (f *File) validAvailElem(e AvailElem) bool {
+	return e.Size >= 0 && e.Addr >= 0 && e.Addr + int64(e.Size) <= f.size
+}
+
+// Read the avail block at addr.  If maxSize is positive, the block may not
+// be larger than that.
+func (f *File) readAvailBlock(addr int64, maxSize int) (*AvailBlock, error) {
+	lay := f.lay
+	toff := lay.availTableOff()
+	head := make([]byte, toff)
+	if err := f.readAt(head, addr); err != nil {
+		return nil, fmt.Errorf("%w at %d: %v", ErrBadAvail, addr, err)
+	}
+	blk := &AvailBlock{
+		Addr: addr,
+		Size: lay.int(head),
+		Count: lay.int(head[4:]),
+		Next: lay.offset(head[8:]),
+	}
+	size := toff + blk.Size * lay.availElemSize()
+	if blk.Size < 0 || blk.Count < 0 || blk.Count > blk.Size ||
+		(maxSize > 0 && size > maxSize) ||
+		blk.Next < 0 || blk.Next > f.size {
+		return nil, fmt.Errorf("%w at %d", ErrBadAvail, addr)
+	}
+	buf := make([]byte, blk.Count * lay.availElemSize())
+	if err := f.readAt(buf, addr + int64(toff)); err != nil {
+		return nil, fmt.Errorf("%w at %d: %v", ErrBadAvail, addr, err)
+	}
+	blk.Table = f.parseAvailTable(buf, blk.Count)
+	for _, e := range blk.Table {
+		if !f.validAvailElem(e) {
+			return nil, fmt.Errorf("%w at %d", ErrBadAvail, addr)
+		}
+	}
+	return blk, nil
+}
+
+// AvailBlocks returns the list of avail blocks, starting with the one
+// stored in the header.
+func (f *File) AvailBlocks() ([]*AvailBlock, error) {
+	hdr := f.Header.Avail
+	list := []*AvailBlock{&hdr}
+	seen := map[int64]bool{hdr.Addr: true}
+	for next := hdr.Next; next != 0; {
+		if seen[next] {
+			return list, fmt.Errorf("%w: loop at %d", ErrBadAvail, next)
+		}
+		seen[next] = true
+		blk, err := f.readAvailBlock(next, 0)
+		if err != nil {
+			return list, err
+		}
+		list = append(list, blk)
+		next = blk.Next
+	}
+	return list, nil
+}
+
+// BucketAddrs returns offsets of all distinct buckets, in directory order.
+func (f *File) BucketAddrs() []int64 {
+	var res []int64
+	for i, addr := range f.Dir {
+		if i == 0 || addr != f.Dir[i-1] {
+			res = append(res, addr)
+		}
+	}
+	return res
+}
+
+// ReadBucket reads the bucket at the given offset.
+func (f *File) ReadBucket(addr int64) (*Bucket, error) {
+	h := &f.Header
+	lay := f.lay
+	buf := make([]byte, h.BucketSize)
+	if err := f.readAt(buf, addr); err != nil {
+		return nil, fmt.Errorf("%w at %d: %v", ErrBadBucket, addr, err)
+	}
+
+	bkt := &Bucket{Addr: addr}
+	avcount := lay.int(buf)
+	bkt.Bits = lay.int(buf[lay.bucketBitsOff():])
+	bkt.Count = lay.int(buf[lay.bucketBitsOff()+4:])
+	if avcount < 0 || avcount > BucketAvail ||
+		bkt.Bits < 0 || bkt.Bits > h.DirBits ||
+		bkt.Count < 0 || bkt.Count > h.BucketElems {
+		return nil, fmt.Errorf("%w at %d", ErrBadBucket, addr)
+	}
+	bkt.Avail = f.parseAvailTable(buf[lay.bucketAvailOff():], avcount)
+	for _, e := range bkt.Avail {
+		if !f.validAvailElem(e) {
+			return nil, fmt.Errorf("%w: bucket at %d", ErrBadAvail, addr)
+		}
+	}
+
+	bkt.Table = make([]BucketElement, h.BucketElems)
+	used := 0
+	for i := range bkt.Table {
+		p := buf[lay.bucketTableOff() + i*lay.elemSize():]
+		e := &bkt.Table[i]
+		e.Hash = int32(lay.order.Uint32(p))
+		copy(e.KeyStart[:], p[4:4+SmallKey])
+		e.DataPointer = lay.offset(p[8:])
+		e.KeySize = lay.int(p[8+lay.off:])
+		e.DataSize = lay.int(p[12+lay.off:])
+		if !e.InUse() {
+			continue
+		}
+		used++
+		if e.Hash < 0 ||
+			e.KeySize < 0 || e.DataSize < 0 ||
+			e.DataPointer < 0 ||
+			e.DataPointer + int64(e.KeySize) + int64(e.DataSize) > f.size {
+			return nil, fmt.Errorf("%w: bucket at %d, slot %d", ErrBadHashEntry, addr, i)
+		}
+	}
+	if used != bkt.Count {
+		return nil, fmt.Errorf("%w at %d: count mismatch", ErrBadBucket, addr)
+	}
+	return bkt, nil
+}
+
+// ReadKey returns the key described by the bucket element e.
+func (f *File) ReadKey(e *BucketElement) ([]byte, error) {
+	buf := make([]byte, e.KeySize)
+	if err := f.readAt(buf, e.DataPointer); err != nil {
+		return nil, fmt.Errorf("%w: record at %d: %v", ErrBadHashEntry, e.DataPointer, err)
+	}
+	return buf, nil
+}
+
+// ReadRecord returns the key and value described by the bucket element e.
+func (f *File) ReadRecord(e *BucketElement) (key, value []byte, err error) {
+	buf := make([]byte, e.KeySize + e.DataSize)
+	if err = f.readAt(buf, e.DataPointer); err != nil {
+		return nil, nil, fmt.Errorf("%w: record at %d: %v", ErrBadHashEntry, e.DataPointer, err)
+	}
+	return buf[:e.KeySize:e.KeySize], buf[e.KeySize:], nil
+}
+
+// Hash computes the hash value of the key, as GDBM does on platforms
+// where char is a signed type (e.g. x86).
+func Hash(key []byte) int32 {
+	return hash(key, true)
+}
+
+func hash(key []byte, signed bool) int32 {
+	value := uint32(0x238F13AF) * uint32(len(key))
+	for i, b := range key {
+		c := uint32(b)
+		if signed {
+			c = uint32(int32(int8(b)))
+		}
+		value = (value + (c << uint(i*5 % 24))) & 0x7FFFFFFF
+	}
+	value = (1103515243 * value + 12345) & 0x7FFFFFFF
+	return int32(value)
+}
+
+// Look up the key in the bucket, assuming the given hash value.
+func (f *File) lookup(key []byte, hval int32) ([]byte, error) {
+	h := &f.Header
+	bkt, err := f.ReadBucket(f.Dir[hval >> uint(HashBits - h.DirBits)])
+	if err != nil {
+		return nil, err
+	}
+	start := int(hval) % h.BucketElems
+	for i := start; ; {
+		e := &bkt.Table[i]
+		if !e.InUse() {
+			break
+		}
+		n := e.KeySize
+		if n > SmallKey {
+			n = SmallKey
+		}
+		if e.Hash == hval && e.KeySize == len(key) &&
+			bytes.Equal(key[:n], e.KeyStart[:n]) {
+			k, v, err := f.ReadRecord(e)
+			if err != nil {
+				return nil, err
+			}
+			if bytes.Equal(k, key) {
+				return v, nil
+			}
+		}
+		i = (i + 1) % h.BucketElems
+		if i == start {
+			break
+		}
+	}
+	return nil, ErrItemNotFound
+}
+
+// Fetch returns the value stored under the given key.  If the key is not
+// found, ErrItemNotFound is returned.
+func (f *File) Fetch(key []byte) ([]byte, error) {
+	v, err := f.lookup(key, hash(key, true))
+	if errors.Is(err, ErrItemNotFound) && hash(key, true) != hash(key, false) {
+		// The file could have been created on a platform where
+		// char is unsigned.
+		v, err = f.lookup(key, hash(key, false))
+	}
+	return v, err
+}
+
+// Exists returns true if the key exists in the database.
+func (f *File) Exists(key []byte) bool {
+	_, err := f.Fetch(key)
+	return err == nil
+}
+
+// Iterator is a function returning the next key at each call.  When all
+// keys have been visited, it returns ErrItemNotFound.
+type Iterator func () ([]byte, error)
+
+// Iterator returns an iterator for visiting all keys in the database.  Keys
+// are visited in the same order as by the gdbm_firstkey/gdbm_nextkey
+// functions of the library.
+func (f *File) Iterator() Iterator {
+	buckets := f.BucketAddrs()
+	var bkt *Bucket
+	elem := 0
+	var err error
+	return func () ([]byte, error) {
+		for err == nil {
+			if bkt == nil {
+				if len(buckets) == 0 {
+					err = ErrItemNotFound
+					break
+				}
+				bkt, err = f.ReadBucket(buckets[0])
+				if err != nil {
+					break
+				}
+				buckets = buckets[1:]
+				elem = 0
+			}
+			for elem < len(bkt.Table) {
+				e := &bkt.Table[elem]
+				elem++
+				if e.InUse() {
+					var key []byte
+					key, err = f.ReadKey(e)
+					if err != nil {
+						return nil, err
+					}
+					return key, nil
+				}
+			}
+			bkt = nil
+		}
+		return nil, err
+	}
+}
+
+// Count returns the number of keys in the database.
+func (f *File) Count() (uint, error) {
+	var n uint
+	for _, addr := range f.BucketAddrs() {
+		bkt, err := f.ReadBucket(addr)
+		if err != nil {
+			return n, err
+		}
+		n += uint(bkt.Count)
+	}
+	return n, nil
+}
@@ -0,0 +1,184 @@
+//go:build cgo
+
+package format_test
+
+import (
+	"testing"
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"github.com/graygnuorg/go-gdbm"
+	"github.com/graygnuorg/go-gdbm/format"
+)
+
+const nkeys = 2000
+
+func key(i int) []byte {
+	if i % 7 == 0 {
+		// Binary key with high-bit bytes.
+		return []byte{0xff, byte(i), 0x80 | byte(i >> 8), 0}
+	}
+	return []byte(fmt.Sprintf("key%d", i))
+}
+
+func value(i int) []byte {
+	return bytes.Repeat([]byte{byte('a' + i % 26)}, i % 100)
+}
+
+func createDatabase(t *testing.T, flags int) string {
+	name := filepath.Join(t.TempDir(), "test.gdbm")
+	db, err := gdbm.OpenConfig(gdbm.DatabaseConfig{FileName: name,
+				   Mode: gdbm.ModeNewdb,
+				   Flags: flags,
+				   BlockSize: 512,
+				   FileMode: 0600})
+	if err != nil {
+		t.Fatal("Can't create the database:", err)
+	}
+	defer db.Close()
+	for i := 0; i < nkeys; i++ {
+		if err := db.Store(key(i), value(i), false); err != nil {
+			t.Fatalf("Can't store key %d: %v", i, err)
+		}
+	}
+	// Delete some keys to populate the avail tables.
+	for i := 0; i < nkeys; i += 5 {
+		if err := db.Delete(key(i)); err != nil {
+			t.Fatalf("Can't delete key %d: %v", i, err)
+		}
+	}
+	return name
+}
+
+func compare(t *testing.T, name string, numsync bool) {
+	db, err := gdbm.Open(name, gdbm.ModeReader)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	f, err := format.Open(name)
+	if err != nil {
+		t.Fatal("format.Open: ", err)
+	}
+	defer f.Close()
+
+	if f.Header.Numsync != numsync {
+		t.Errorf("Numsync: expected %v", numsync)
+	}
+	if ns, err := db.IsNumsync(); err == nil && ns != f.Header.Numsync {
+		t.Errorf("Numsync mismatch: library %v, format %v", ns, f.Header.Numsync)
+	}
+	if bs, err := db.BlockSize(); err == nil && bs != f.Header.BlockSize {
+		t.Errorf("BlockSize mismatch: library %d, format %d", bs, f.Header.BlockSize)
+	}
+
+	// Fetch all keys, including deleted ones.
+	for i := 0; i < nkeys; i++ {
+		expected, experr := db.Fetch(key(i))
+		val, err := f.Fetch(key(i))
+		if experr != nil {
+			if !errors.Is(experr, gdbm.ErrItemNotFound) {
+				t.Fatalf("Fetch %d: %v", i, experr)
+			}
+			if !errors.Is(err, format.ErrItemNotFound) {
+				t.Errorf("Key %d: expected ErrItemNotFound, got %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Key %d: %v", i, err)
+		} else if !bytes.Equal(val, expected) {
+			t.Errorf("Key %d: value mismatch", i)
+		}
+	}
+
+	// Keys must be returned in the same order.
+	next := db.Iterator()
+	fnext := f.Iterator()
+	n := 0
+	for {
+		k, err := next()
+		fk, ferr := fnext()
+		if err != nil {
+			if !errors.Is(err, gdbm.ErrItemNotFound) {
+				t.Fatal("Iterator: ", err)
+			}
+			if !errors.Is(ferr, format.ErrItemNotFound) {
+				t.Errorf("format.Iterator: expected end of iteration, got %q, %v", fk, ferr)
+			}
+			break
+		}
+		if ferr != nil {
+			t.Fatal("format.Iterator: ", ferr)
+		}
+		if !bytes.Equal(k, fk) {
+			t.Fatalf("Key %d: expected %q, got %q", n, k, fk)
+		}
+		n++
+	}
+
+	count, err := f.Count()
+	if err != nil {
+		t.Fatal("Count: ", err)
+	}
+	if expected, err := db.Count(); err == nil && expected != count {
+		t.Errorf("Count: expected %d, got %d", expected, count)
+	}
+	if count != uint(n) {
+		t.Errorf("Count: %d keys iterated, %d counted", n, count)
+	}
+
+	avail, err := f.AvailBlocks()
+	if err != nil {
+		t.Fatal("AvailBlocks: ", err)
+	}
+	total := 0
+	for _, blk := range avail {
+		total += blk.Count
+	}
+	for _, addr := range f.BucketAddrs() {
+		bkt, err := f.ReadBucket(addr)
+		if err != nil {
+			t.Fatal("ReadBucket: ", err)
+		}
+		total += len(bkt.Avail)
+	}
+	if total == 0 {
+		t.Error("No free blocks found after deletions")
+	}
+}
+
+func TestStandard(t *testing.T) {
+	compare(t, createDatabase(t, 0), false)
+}
+
+func TestNumsync(t *testing.T) {
+	if gdbm.OF_NUMSYNC == 0 {
+		t.Skip("numsync format not supported")
+	}
+	compare(t, createDatabase(t, gdbm.OF_NUMSYNC), true)
+}
+
+func TestHash(t *testing.T) {
+	// Values taken from a database created by libgdbm.
+	for _, tc := range []struct {
+		key string
+		hash int32
+	}{
+		{"one", 0x36e6f04d},
+		{"two", 0x7b1f68c4},
+	} {
+		if h := format.Hash([]byte(tc.key)); h != tc.hash {
+			t.Errorf("%s: expected %#x, got %#x", tc.key, tc.hash, h)
+		}
+	}
+}
+
+func TestBadMagic(t *testing.T) {
+	_, err := format.NewFile(bytes.NewReader(make([]byte, 1024)), 1024)
+	if !errors.Is(err, format.ErrBadMagic) {
+		t.Error("Unexpected error: ", err)
+	}
+}
@@ -19,6 +19,9 @@ package gdbm
 /*
 #cgo LDFLAGS: -lgdbm
 #include <stdlib.h>
+#include <stdio.h>
+#include <stdarg.h>
+#include <stdint.h>
 #include <errno.h>
 #include <gdbm.h>
 
@@ -214,6 +217,28 @@ static inline size_t gdbm_recover_duplicate_keys(gdbm_recovery *rcvr) {
 }
 #endif
 
+// Recovery error reporting.  The messages are formatted and passed to the
+// Go function goRecoveryError, along with the handle identifying the
+// recovery in progress.
+extern void goRecoveryError(uintptr_t, char *);
+
+static void recovery_errfun(void *data, char const *fmt, ...)
+{
+    va_list ap;
+    char buf[1024];
+
+    va_start(ap, fmt);
+    vsnprintf(buf, sizeof(buf), fmt, ap);
+    va_end(ap);
+    goRecoveryError((uintptr_t) data, buf);
+}
+
+static inline void set_recovery_errfun(gdbm_recovery *rcvr, uintptr_t handle)
+{
+    rcvr->errfun = recovery_errfun;
+    rcvr->data = (void*) handle;
+}
+
 #if !(GDBM_VERSION_MAJOR > 1 || GDBM_VERSION_MINOR > 21)
 enum gdbm_latest_snapshot_status
   {
@@ -272,8 +297,9 @@ static inline int is_numsync_format(GDBM_FILE db)
 {
 #ifdef GDBM_GETDBFORMAT
     int n;
+    // The library returns the GDBM_NUMSYNC flag for extended databases.
     if (gdbm_setopt(db, GDBM_GETDBFORMAT, &n, sizeof(n)) == 0)
-	return n;
+	return n != 0;
 #else
     gdbm_errno = GO_GDBM_NOT_IMPLEMENTED;
 #endif
@@ -308,8 +334,32 @@ gdbm_load(GDBM_FILE *db, const char *filename, int replace, int meta_flags,
     gdbm_errno = GO_GDBM_NOT_IMPLEMENTED;
     return -1;
 }
+
+int
+gdbm_dump_to_file(GDBM_FILE db, FILE *fp, int format)
+{
+    gdbm_errno = GO_GDBM_NOT_IMPLEMENTED;
+    return -1;
+}
+
+int
+gdbm_load_from_file(GDBM_FILE *db, FILE *fp, int replace, int meta_flags,
+		    unsigned long *line)
+{
+    gdbm_errno = GO_GDBM_NOT_IMPLEMENTED;
+    return -1;
+}
+
+# define GDBM_META_MASK_MODE  0
+# define GDBM_META_MASK_OWNER 0
 #endif
 
+// Open a stdio stream on the file descriptor fd.
+static inline FILE *open_stream(int fd, int write)
+{
+    return fdopen(fd, write ? "w" : "r");
+}
+
 */
 import "C"
 
@@ -320,7 +370,10 @@ import (
 	"strings"
 	"path/filepath"
 	"os"
+	"io"
+	"strconv"
 	"sync"
+	"time"
 )
 
 const (
@@ -411,6 +464,12 @@ func newGdbmError(syserr error) error {
 	return &GdbmError{errorCode: int(C.gdbm_errno), sysError: syserr}
 }
 
+// Returns a GdbmError with the given GDBM error code.  This is useful for
+// reconstructing errors transferred over the network.
+func ErrorFromCode(code int) error {
+	return &GdbmError{errorCode: code}
+}
+
 // Returns a text describing the error.
 func (err *GdbmError) Error() string {
 	switch err.Code() {
@@ -577,6 +636,20 @@ type Database struct {
 	dbf C.GDBM_FILE
 	snapshots *DatabaseSnapshots
 	sync sync.RWMutex
+	index *orderedIndex
+	// Ordered index, if enabled.
+	stats SyncStats
+	// Synchronization statistics.  Protected by sync.
+	syncer *syncer
+	// Background synchronization, if enabled.
+	reorg *reorganizer
+	// Automatic reorganization, if enabled.
+	mode int
+	// Open mode.
+	flags int
+	// Open flags.
+	compact *compaction
+	// Compaction in progress, if any.  Protected by sync.
 }
 
 // The DatabaseConfig structure controls opening the database.
@@ -627,6 +700,78 @@ type DatabaseConfig struct {
 	CrashTolerance bool
 	// Enable crash tolerance support (see
 	// https://www.gnu.org.ua/software/gdbm/manual/Crash-Tolerance.html)
+	Index bool
+	// Maintain an ordered index of keys in the file named by appending
+	// IndexSuffix to the database file name.  See IndexCursor.
+	DumpReader io.Reader
+	// If Mode is ModeLoad and this field is not nil, the dump is read
+	// from it instead of from the file FileName.  In this case, if
+	// FileName is not empty, it names the database file to create (the
+	// dump can then be in any format).  Otherwise, the file name,
+	// permissions and ownership are restored from the dump, which must
+	// be in ASCII format.
+
+	// The fields below tune the opened database.  Zero values leave
+	// the library defaults in effect.
+
+	CacheSize uint
+	// Size of the bucket cache (number of buckets).
+	SyncMode bool
+	// Synchronize the database with its disk file after each write.
+	CentFree bool
+	// Enable central free block pool.
+	CoalesceBlocks bool
+	// Merge adjacent free blocks.
+	MaxMapSize uint64
+	// Maximum size of the memory mapped region, in bytes.
+	Mmap int
+	// Memory mapping:
+	//   MmapDefault - Leave as set by the OF_NOMMAP flag.
+	//   MmapOn      - Enable memory mapping.
+	//   MmapOff     - Disable memory mapping.
+
+	// The fields below set up automatic synchronization of the database
+	// with its disk file, performed by a background goroutine.  It is
+	// not started for databases opened in ModeReader.  See SyncStats.
+
+	SyncEvery uint
+	// Synchronize after this number of writes.
+	SyncInterval time.Duration
+	// Synchronize at this interval, if there were writes since the
+	// last synchronization.
+
+	// The fields below set up automatic reorganization of the database,
+	// performed when its fragmentation (the fraction of the file occupied
+	// by free areas) exceeds a threshold.  It is not enabled for
+	// databases opened in ModeReader.  See MaintenanceTick.
+
+	ReorganizeThreshold float64
+	// Reorganize when fragmentation exceeds this value, e.g. 0.5.
+	// Zero disables automatic reorganization.
+	ReorganizeAfter uint
+	// Evaluate fragmentation in background after this number of
+	// deletes and overwrites (stores with replace set that replaced an
+	// existing key).  Defaults to DefaultReorganizeAfter.
+	ReorganizeIdle time.Duration
+	// If positive, reorganize in background once the database has
+	// not been written to for this long.  Otherwise, reorganization is
+	// performed only by MaintenanceTick.
+
+	Hooks *DatabaseHooks
+	// Callbacks reporting the results of background maintenance.  They
+	// are kept out of DatabaseConfig itself, so that configurations can
+	// be compared using ==.
+}
+
+// DatabaseHooks holds the callbacks of a database.  Nil fields are
+// ignored.
+type DatabaseHooks struct {
+	OnSyncError func(err error)
+	// Called with errors of automatic synchronization.  It runs in the
+	// background goroutine and must not close the database.
+	OnReorganize func(ev ReorganizeEvent)
+	// Called after each automatic reorganization attempt.  When called
+	// from the background goroutine, it must not close the database.
 }
 
 var snapshotSuffix = []string{
@@ -707,20 +852,25 @@ func (s *DatabaseSnapshots) Select() (result string, err error) {
 // OpenConfig opens or creates a database file.  See the comments to the
 // DatabaseConfig structure.
 func OpenConfig(cfg DatabaseConfig) (db *Database, err error) {
-	db = new(Database)
+	db = &Database{mode: cfg.Mode, flags: cfg.Flags}
 	filename := cfg.FileName
 	cfilename := C.CString(filename)
 	defer C.free(unsafe.Pointer(cfilename))
 	if (cfg.Mode == ModeLoad) {
-		res, errno := C.gdbm_load(&db.dbf, cfilename, C.GDBM_REPLACE, 0, nil)
-		if res != 0 {
-			err = newGdbmError(errno)
-			if errors.Is(err, ErrFileOwner) || errors.Is(err, ErrFileMode) {
-				err = nil
-			} else {
-				db = nil
+		if cfg.DumpReader != nil {
+			err = db.openFromReader(cfg)
+		} else {
+			res, errno := C.gdbm_load(&db.dbf, cfilename, C.GDBM_REPLACE, 0, nil)
+			if res != 0 {
+				err = newGdbmError(errno)
+				if errors.Is(err, ErrFileOwner) || errors.Is(err, ErrFileMode) {
+					err = nil
+				}
 			}
 		}
+		if err != nil {
+			return nil, err
+		}
 		if cfg.CrashTolerance {
 			filename, err = db.FileName()
 			if err != nil {
@@ -749,7 +899,7 @@ func OpenConfig(cfg DatabaseConfig) (db *Database, err error) {
 				return nil, &GdbmError{errorCode: GDBM_SNAPSHOT_EXISTS}
 			}
 		}
-		dbf, errno := C.gdbm_open(cfilename, C.int(cfg.BlockSize), C.int(cfg.Mode), C.int(cfg.FileMode), nil)
+		dbf, errno := C.gdbm_open(cfilename, C.int(cfg.BlockSize), C.int(cfg.Mode | cfg.Flags), C.int(cfg.FileMode), nil)
 		if dbf == nil {
 			err = newGdbmError(errno)
 			db = nil
@@ -757,6 +907,26 @@ func OpenConfig(cfg DatabaseConfig) (db *Database, err error) {
 			db.dbf = dbf
 		}
 	}
+	if db != nil {
+		if e := db.configure(cfg); e != nil {
+			db.close()
+			return nil, e
+		}
+	}
+	if db != nil && cfg.Index {
+		name := cfg.FileName
+		var e error
+		if cfg.Mode == ModeLoad {
+			name, e = db.FileName()
+		}
+		if e == nil {
+			e = db.openIndex(name, cfg.Mode == ModeReader)
+		}
+		if e != nil {
+			db.close()
+			return nil, e
+		}
+	}
 	if db != nil && cfg.CrashTolerance {
 		s1 := C.CString(db.snapshots[0])
 		defer C.free(unsafe.Pointer(s1))
@@ -769,6 +939,12 @@ func OpenConfig(cfg DatabaseConfig) (db *Database, err error) {
 			db = nil
 		}
 	}
+	if db != nil && cfg.Mode != ModeReader && (cfg.SyncEvery > 0 || cfg.SyncInterval > 0) {
+		db.startSyncer(cfg)
+	}
+	if db != nil && cfg.Mode != ModeReader && cfg.ReorganizeThreshold > 0 {
+		db.startReorganizer(cfg)
+	}
 	return
 }
 
@@ -788,8 +964,70 @@ func (db *Database) close() {
 	C.gdbm_close(db.dbf)
 }
 
-// Close the database.
+// If not nil, called by replaceFile before reopening the database.  Used
+// in tests.
+var replaceFileHook func()
+
+// Replace the database file with newname and reopen it, preserving the
+// tuning options and crash tolerance setup.  The caller must hold the
+// database lock.  If renaming fails, the database remains open on the
+// old file.  If reopening fails, db.dbf is left nil, so that the database
+// behaves as closed.  Background goroutines check for this, and Close
+// still stops them.  Errors setting up the reopened file are returned as
+// *SwapError.
+func (db *Database) replaceFile(newname string) error {
+	name, err := db.fileName()
+	if err != nil {
+		return err
+	}
+	opts := db.saveOptions()
+	if err := os.Rename(newname, name); err != nil {
+		return err
+	}
+	C.gdbm_close(db.dbf)
+	db.dbf = nil
+	if replaceFileHook != nil {
+		replaceFileHook()
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	dbf, errno := C.gdbm_open(cname, 0, C.int(ModeWriter | db.flags), 0, nil)
+	if dbf == nil {
+		return newGdbmError(errno)
+	}
+	db.dbf = dbf
+	if err := db.restoreOptions(opts); err != nil {
+		return &SwapError{err}
+	}
+	if db.snapshots != nil {
+		db.snapshots.Remove()
+		s1 := C.CString(db.snapshots[0])
+		defer C.free(unsafe.Pointer(s1))
+		s2 := C.CString(db.snapshots[1])
+		defer C.free(unsafe.Pointer(s2))
+		if res, errno := C.gdbm_failure_atomic(db.dbf, s1, s2); res != 0 {
+			return &SwapError{newGdbmError(errno)}
+		}
+	}
+	if db.index != nil {
+		if err := db.index.save(); err != nil {
+			return &SwapError{err}
+		}
+	}
+	return nil
+}
+
+// Close the database.  If the database was opened for writing, the
+// library synchronizes it with its disk file before closing.  Background
+// synchronization and reorganization, if enabled, are stopped first.
 func (db *Database) Close() error {
+	if db.syncer != nil {
+		db.syncer.shutdown()
+	}
+	if db.reorg != nil {
+		db.reorg.shutdown()
+	}
 	db.sync.Lock()
 	defer db.sync.Unlock()
 	if db.dbf == nil {
@@ -803,6 +1041,9 @@ func (db *Database) Close() error {
 		db.snapshots.Remove()
 	}
 	db.dbf = nil
+	if db.index != nil {
+		return db.index.save()
+	}
 	return nil
 }
 
@@ -810,9 +1051,14 @@ func (db *Database) Close() error {
 func (db *Database) Exists(key []byte) (bool) {
 	db.sync.RLock()
 	defer db.sync.RUnlock()
-	if db == nil {
+	if db.dbf == nil {
 		return false
 	}
+	return db.exists(key)
+}
+
+// Return true if the key exists.  The caller must hold the database lock.
+func (db *Database) exists(key []byte) bool {
 	kptr := C.CBytes(key)
 	defer C.free(unsafe.Pointer(kptr))
 	return C.gdbm_exists(db.dbf, C.bytes_to_datum(kptr, C.size_t(len(key)))) == 1
@@ -837,15 +1083,97 @@ func (db *Database) Fetch(key []byte) (value []byte, err error) {
 		return
 	}
 
+	return db.fetch(key)
+}
+
+// Fetch the value of the key.  The caller must hold the database lock.
+func (db *Database) fetch(key []byte) ([]byte, error) {
 	kptr := C.CBytes(key)
 	defer C.free(unsafe.Pointer(kptr))
 	vdat := C.gdbm_fetch(db.dbf, C.bytes_to_datum(kptr, C.size_t(len(key))));
 	if vdat.dptr == nil {
 		return []byte{}, db.lastError()
 	}
-	value = C.GoBytes(unsafe.Pointer(vdat.dptr), vdat.dsize)
 	defer C.free(unsafe.Pointer(vdat.dptr))
-	return
+	return C.GoBytes(unsafe.Pointer(vdat.dptr), vdat.dsize), nil
+}
+
+// A byte to point to when passing empty slices to C.  The library treats
+// a datum with NULL dptr as malformed, even if its size is 0.
+var zeroByte byte
+
+// Returns a pointer to the first byte of buf, suitable for passing to C
+// without copying.  The C code must not retain the pointer.
+func bytesPtr(buf []byte) *C.char {
+	if len(buf) == 0 {
+		return (*C.char)(unsafe.Pointer(&zeroByte))
+	}
+	return (*C.char)(unsafe.Pointer(&buf[0]))
+}
+
+// Look up the key and return the datum allocated by the library.  The
+// caller must free it.
+func (db *Database) fetchDatum(key []byte) (C.datum, error) {
+	db.sync.RLock()
+	defer db.sync.RUnlock()
+	if db.dbf == nil {
+		return C.datum{}, ErrNotOpen
+	}
+	vdat := C.gdbm_fetch(db.dbf, C.bytes_to_datum(unsafe.Pointer(bytesPtr(key)), C.size_t(len(key))))
+	if vdat.dptr == nil {
+		return vdat, db.lastError()
+	}
+	return vdat, nil
+}
+
+// FetchInto looks up the key and appends its value to buf, returning the
+// extended buffer.  If buf has enough capacity, no memory is allocated on
+// the Go side.  On error, buf is returned unchanged.
+//
+// Example:
+//     buf := make([]byte, 0, 1024)
+//     for _, key := range keys {
+//       val, err := db.FetchInto(key, buf[:0])
+//       ...
+//     }
+func (db *Database) FetchInto(key []byte, buf []byte) ([]byte, error) {
+	vdat, err := db.fetchDatum(key)
+	if err != nil {
+		return buf, err
+	}
+	defer C.free(unsafe.Pointer(vdat.dptr))
+	return append(buf, cSlice(vdat)...), nil
+}
+
+// View looks up the key and calls fn with its value.  The value refers to
+// memory owned by the library, which is freed as soon as fn returns, so fn
+// must not retain it or modify it.  The database is not locked while fn
+// runs, so fn is free to call other methods of db.  Returns the error
+// returned by fn, or ErrItemNotFound if the key does not exist (in which
+// case fn is not called).
+//
+// Example:
+//     var n int
+//     err := db.View(key, func(val []byte) error {
+//       n, err = strconv.Atoi(string(val))
+//       return err
+//     })
+func (db *Database) View(key []byte, fn func(value []byte) error) error {
+	vdat, err := db.fetchDatum(key)
+	if err != nil {
+		return err
+	}
+	defer C.free(unsafe.Pointer(vdat.dptr))
+	return fn(cSlice(vdat))
+}
+
+// Returns a slice referring to the memory of the datum.  The array bound
+// is the largest value of dsize, which is a C int.
+func cSlice(d C.datum) []byte {
+	if d.dsize == 0 {
+		return []byte{}
+	}
+	return (*[1 << 31 - 1]byte)(unsafe.Pointer(d.dptr))[:d.dsize:d.dsize]
 }
 
 // Store value for the given key.  The 'replace' parameter controls what to
@@ -860,18 +1188,37 @@ func (db *Database) Store(key []byte, value []byte, replace bool) (err error) {
 		return
 	}
 
+	return db.store(key, value, replace)
+}
+
+// Store the value for the key.  The caller must hold the database lock.
+func (db *Database) store(key []byte, value []byte, replace bool) (err error) {
 	kptr := C.CBytes(key)
 	defer C.free(unsafe.Pointer(kptr))
 	vptr := C.CBytes(value)
 	defer C.free(unsafe.Pointer(vptr))
 	var rflag = C.GDBM_INSERT
+	// Only overwrites of existing keys count towards reorganization.
+	overwrite := false
 	if replace {
 		rflag = C.GDBM_REPLACE
+		if db.reorg != nil {
+			overwrite = db.exists(key)
+		}
 	}
 	res := C.gdbm_store(db.dbf, C.bytes_to_datum(kptr, C.size_t(len(key))),
 		C.bytes_to_datum(vptr, C.ulong(len(value))), C.int(rflag))
 	if res != 0 {
 		err = db.lastError()
+	} else {
+		if db.index != nil {
+			db.index.insert(key)
+		}
+		db.noteWrites(1)
+		if overwrite {
+			db.noteChurn(1)
+		}
+		db.noteDirty(key)
 	}
 	return
 }
@@ -885,11 +1232,23 @@ func (db *Database) Delete(key []byte) (err error) {
 		return
 	}
 
+	return db.delete(key)
+}
+
+// Delete the key.  The caller must hold the database lock.
+func (db *Database) delete(key []byte) (err error) {
 	kptr := C.CBytes(key)
 	defer C.free(unsafe.Pointer(kptr))
 	res := C.gdbm_delete(db.dbf, C.bytes_to_datum(kptr, C.size_t(len(key))))
 	if res != 0 {
 		err = db.lastError()
+	} else {
+		if db.index != nil {
+			db.index.remove(key)
+		}
+		db.noteWrites(1)
+		db.noteChurn(1)
+		db.noteDirty(key)
 	}
 	return
 }
@@ -901,6 +1260,12 @@ func (db *Database) NeedsRecovery() bool {
 	if db.dbf == nil {
 		return false
 	}
+	return db.needsRecovery()
+}
+
+// Return true if the database needs recovery.  The caller must hold the
+// database lock.
+func (db *Database) needsRecovery() bool {
 	return C.gdbm_needs_recovery(db.dbf) != 0
 }
 
@@ -938,12 +1303,13 @@ type DatabaseIterator func () ([]byte, error)
 //      if !errors.Is(err, ErrItemNotFound) {
 //              panic(err)
 //      }
+//
+// The iterator holds no library resources between calls, so it is safe
+// to abandon it at any time.  See also the Cursor method.
 func (db *Database) Iterator() DatabaseIterator {
-	cur := C.gdbm_firstkey(db.dbf)
+	var prev []byte
+	var started bool
 	var err error
-	if cur.dptr == nil {
-		err = lastSequentialError()
-	}
 	return func () ([]byte, error) {
 		db.sync.RLock()
 		defer db.sync.RUnlock()
@@ -955,13 +1321,24 @@ func (db *Database) Iterator() DatabaseIterator {
 			return []byte{}, err
 		}
 
-		defer C.free(unsafe.Pointer(cur.dptr))
-		ret := C.GoBytes(unsafe.Pointer(cur.dptr), cur.dsize)
-		cur = C.gdbm_nextkey(db.dbf, cur)
+		var cur C.datum
+		if !started {
+			started = true
+			cur = C.gdbm_firstkey(db.dbf)
+		} else {
+			kptr := C.CBytes(prev)
+			cur = C.gdbm_nextkey(db.dbf, C.bytes_to_datum(kptr, C.size_t(len(prev))))
+			C.free(kptr)
+		}
 		if cur.dptr == nil {
 			err = lastSequentialError()
+			return []byte{}, err
 		}
-		return ret, nil
+		defer C.free(unsafe.Pointer(cur.dptr))
+		prev = C.GoBytes(unsafe.Pointer(cur.dptr), cur.dsize)
+		// Return a copy, so the caller can't alter the key
+		// used to resume the iteration.
+		return append([]byte{}, prev...), nil
 	}
 }
 
@@ -972,7 +1349,11 @@ func (db *Database) FileName() (string, error) {
 	if db.dbf == nil {
 		return "", ErrNotOpen
 	}
+	return db.fileName()
+}
 
+// Return the database file name.  The caller must hold the database lock.
+func (db *Database) fileName() (string, error) {
 	s := C.get_db_name(db.dbf)
 	if s == nil {
 		return "", db.lastError();
@@ -1017,7 +1398,7 @@ func (db *Database) Dump(cfg DumpConfig) (err error) {
 	db.sync.RLock()
 	defer db.sync.RUnlock()
 	if db.dbf == nil {
-		err = ErrNotOpen
+		return ErrNotOpen
 	}
 
 	flags := C.GDBM_WRCREAT;
@@ -1049,8 +1430,9 @@ func (db *Database) Load(cfg DumpConfig) (err error) {
 	db.sync.Lock()
 	defer db.sync.Unlock()
 	if db.dbf == nil {
-		err = ErrNotOpen
+		return ErrNotOpen
 	}
+	db.abortCompaction()
 
 	flag := C.GDBM_INSERT;
 	if cfg.Rewrite {
@@ -1058,16 +1440,254 @@ func (db *Database) Load(cfg DumpConfig) (err error) {
 	}
 	filename := C.CString(cfg.FileName)
 	defer C.free(unsafe.Pointer(filename))
-	res, errno := C.gdbm_load(&db.dbf, filename, C.int(flag), 0, nil)
+	var line C.ulong
+	before := C.get_db_count(db.dbf)
+	// The handle is passed by a pointer.  Don't pass a pointer into db,
+	// which holds Go pointers that cgo doesn't allow to pass.
+	dbf := db.dbf
+	res, errno := C.gdbm_load(&dbf, filename, C.int(flag), 0, &line)
 	if res != 0 {
 		err = newGdbmError(errno)
 		if errors.Is(err, ErrFileOwner) || errors.Is(err, ErrFileMode) {
 			err = nil
+		} else if line > 0 {
+			err = &LoadError{Line: uint(line), Err: err}
+		}
+	}
+	db.noteLoad(before)
+	if db.index != nil {
+		if e := db.rebuildIndex(); e != nil && err == nil {
+			err = e
 		}
 	}
 	return
 }
 
+// LoadError reports a failure to load a dump.  It wraps the underlying
+// GdbmError, so that it can be matched using errors.Is.
+type LoadError struct {
+	Line uint
+	// Number of the dump line where the error was detected, or 0 if
+	// unknown.
+	Err error
+	// The underlying error.
+}
+
+func (err *LoadError) Error() string {
+	if err.Line > 0 {
+		return "line " + strconv.FormatUint(uint64(err.Line), 10) + ": " + err.Err.Error()
+	}
+	return err.Err.Error()
+}
+
+// Unwrap a LoadError.
+func (err *LoadError) Unwrap() error {
+	return err.Err
+}
+
+// Create a pipe and return a stdio stream for one of its ends (the write
+// end if write is true, the read end otherwise).  The other end is returned
+// as *os.File.
+func pipeStream(write bool) (fp *C.FILE, other *os.File, err error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	mine, other := pr, pw
+	if write {
+		mine, other = pw, pr
+	}
+	// The stream takes ownership of a duplicate descriptor, so that
+	// fclose and os.File.Close don't interfere with each other.
+	fd, err := syscall.Dup(int(mine.Fd()))
+	mine.Close()
+	if err != nil {
+		other.Close()
+		return nil, nil, err
+	}
+	flag := C.int(0)
+	if write {
+		flag = 1
+	}
+	fp, errno := C.open_stream(C.int(fd), flag)
+	if fp == nil {
+		syscall.Close(fd)
+		other.Close()
+		return nil, nil, errno
+	}
+	return fp, other, nil
+}
+
+// DumpTo writes the dump of the database in the given format (AsciiDump
+// or BinaryDump) to w.  The output is identical to that produced by Dump.
+// The database is read-locked until the whole dump is written, so a slow
+// w blocks all writers.  To dump to a network peer, use DumpToTemp.
+func (db *Database) DumpTo(w io.Writer, format int) (err error) {
+	db.sync.RLock()
+	defer db.sync.RUnlock()
+	if db.dbf == nil {
+		return ErrNotOpen
+	}
+
+	fp, pr, err := pipeStream(true)
+	if err != nil {
+		return
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(w, pr)
+		if err != nil {
+			// Drain the pipe so that the writer doesn't block.
+			io.Copy(io.Discard, pr)
+		}
+		pr.Close()
+		done <- err
+	}()
+	res, errno := C.gdbm_dump_to_file(db.dbf, fp, C.int(format))
+	if res != 0 {
+		err = newGdbmError(errno)
+	}
+	if res, errno := C.fclose(fp); res != 0 && err == nil {
+		err = &GdbmError{errorCode: GDBM_FILE_WRITE_ERROR, sysError: errno}
+	}
+	if e := <-done; e != nil && err == nil {
+		err = e
+	}
+	return
+}
+
+// DumpToTemp dumps the database in the given format into a temporary
+// file created in dir (os.TempDir, if empty) and returns the file,
+// positioned at its start.  The file is removed from dir right away, so
+// it disappears when closed.  The database is locked only while the file
+// is written, so copying the dump from it to a slow consumer does not
+// block database writers.
+func (db *Database) DumpToTemp(dir string, format int) (*os.File, error) {
+	f, err := os.CreateTemp(dir, "gdbm-dump")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(f.Name())
+	if err = db.DumpTo(f, format); err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Load the dump from r into *pdbf.  If *pdbf is nil, a new database is
+// created, using the file name from the dump.  The function returns as
+// soon as the loader is done, without waiting for r to be exhausted: if
+// the loader stops early, the goroutine copying r terminates on the next
+// return from r.Read.
+func loadFromReader(pdbf *C.GDBM_FILE, r io.Reader, flag, meta C.int) (err error) {
+	fp, pw, err := pipeStream(false)
+	if err != nil {
+		return
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(pw, r)
+		// Report the result before closing the pipe, so that it is
+		// available by the time the loader sees end of file.
+		done <- err
+		pw.Close()
+	}()
+	var line C.ulong
+	res, errno := C.gdbm_load_from_file(pdbf, fp, flag, meta, &line)
+	if res != 0 {
+		err = newGdbmError(errno)
+		if errors.Is(err, ErrFileOwner) || errors.Is(err, ErrFileMode) {
+			err = nil
+		} else if line > 0 {
+			err = &LoadError{Line: uint(line), Err: err}
+		}
+	}
+	// Closing the stream unblocks the writer, if the loader gave up
+	// before reaching the end of input.
+	C.fclose(fp)
+	// Don't wait for the copier: it may be blocked in r.Read forever.
+	select {
+	case e := <-done:
+		if e != nil && err == nil {
+			err = e
+		}
+	default:
+	}
+	return
+}
+
+// Count the records stored by Load or LoadFrom, given the number of
+// records before the load.  The library doesn't report how many records
+// it stored, so the growth of the record count is used.  Records that
+// replaced existing ones are not counted.  The caller must hold the
+// database lock.
+func (db *Database) noteLoad(before C.uint) {
+	after := C.get_db_count(db.dbf)
+	if C.gdbm_errno == C.GDBM_NO_ERROR && after > before {
+		db.noteWrites(uint(after - before))
+	}
+}
+
+// Handle ModeLoad with non-nil cfg.DumpReader.
+func (db *Database) openFromReader(cfg DatabaseConfig) error {
+	meta := C.int(0)
+	if cfg.FileName != "" {
+		cfilename := C.CString(cfg.FileName)
+		defer C.free(unsafe.Pointer(cfilename))
+		dbf, errno := C.gdbm_open(cfilename, C.int(cfg.BlockSize), C.int(ModeNewdb | cfg.Flags), C.int(cfg.FileMode), nil)
+		if dbf == nil {
+			return newGdbmError(errno)
+		}
+		db.dbf = dbf
+		meta = C.GDBM_META_MASK_MODE | C.GDBM_META_MASK_OWNER
+	}
+	err := loadFromReader(&db.dbf, cfg.DumpReader, C.GDBM_REPLACE, meta)
+	if err != nil && db.dbf != nil {
+		db.close()
+		if cfg.FileName != "" {
+			os.Remove(cfg.FileName)
+		}
+	}
+	return err
+}
+
+// LoadFrom loads the dump from r into the database.  The dump can be
+// in any format.  If replace is true, existing keys will be overwritten
+// with the data from the dump.  If the dump is malformed, a *LoadError
+// is returned, indicating the line where the error was detected.
+//
+// LoadFrom returns as soon as the dump is loaded or an error is detected,
+// even if r has not reached end of file.  In that case the internal
+// goroutine reading from r exits once the pending Read returns.
+func (db *Database) LoadFrom(r io.Reader, replace bool) error {
+	db.sync.Lock()
+	defer db.sync.Unlock()
+	if db.dbf == nil {
+		return ErrNotOpen
+	}
+	db.abortCompaction()
+
+	flag := C.GDBM_INSERT
+	if replace {
+		flag = C.GDBM_REPLACE
+	}
+	before := C.get_db_count(db.dbf)
+	// See Load for why a copy of the handle is passed.
+	dbf := db.dbf
+	err := loadFromReader(&dbf, r, C.int(flag), 0)
+	db.noteLoad(before)
+	if db.index != nil {
+		if e := db.rebuildIndex(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
 // LoadFromFile() loads the data from the named dump file into the database.
 // Existing keys are silently overwritten.
 func (db *Database) LoadFromFile(filename string) error {
@@ -1083,10 +1703,15 @@ func (db *Database) Reorganize() (err error) {
 		return
 	}
 
+	return db.reorganize()
+}
+
+// Reorganize the database.  The caller must hold the database lock.
+func (db *Database) reorganize() error {
 	if C.gdbm_reorganize(db.dbf) != 0 {
-		err = db.lastError()
+		return db.lastError()
 	}
-	return
+	return nil
 }
 
 type RecoveryConfig struct {
@@ -1104,6 +1729,10 @@ type RecoveryConfig struct {
 	// Report failure after this many failed buckets.
 	MaxFailures uint
 	// Report failure after this many failures.
+	ErrorFunc func(msg string)
+	// If not nil, called with the message describing each failure,
+	// as it occurs.  Failures are also reported in the Failures field
+	// of RecoveryStat.
 }
 
 type RecoveryStat struct {
@@ -1119,9 +1748,13 @@ type RecoveryStat struct {
 	// Number of buckets were not recovered.
 	DuplicateKeys uint
 	// Number of duplicated keys.
+	Failures []RecoveryFailure
+	// Failures encountered during recovery, in the order they occurred.
 }
 
-// Recover the database.
+// Recover the database.  On success, returns the recovery statistics.  If
+// the recovery fails, the error is returned along with the statistics
+// gathered before the failure.
 func (db *Database) Recover(cfg RecoveryConfig) (stat *RecoveryStat, err error) {
 	db.sync.Lock()
 	defer db.sync.Unlock()
@@ -1129,6 +1762,7 @@ func (db *Database) Recover(cfg RecoveryConfig) (stat *RecoveryStat, err error)
 		err = ErrNotOpen
 		return
 	}
+	db.abortCompaction()
 
 	var rcv C.gdbm_recovery
 	flags := 0
@@ -1150,22 +1784,32 @@ func (db *Database) Recover(cfg RecoveryConfig) (stat *RecoveryStat, err error)
 	if cfg.Force {
 		flags |= C.GDBM_RCVR_FORCE
 	}
+	stat = new(RecoveryStat)
+	h := newRecoveryHandle(&cfg, stat)
+	defer h.free()
+	C.set_recovery_errfun(&rcv, C.uintptr_t(h))
+	flags |= C.GDBM_RCVR_ERRFUN
 
 	res := C.gdbm_recover(db.dbf, &rcv, C.int(flags))
-	if res != 0 {
-		return nil, db.lastError()
-	}
-
-	if cfg.Backup {
+	if rcv.backup_name != nil {
 		stat.BackupName = C.GoString(rcv.backup_name)
-		defer C.free(unsafe.Pointer(rcv.backup_name))
+		C.free(unsafe.Pointer(rcv.backup_name))
 	}
 	stat.RecoveredKeys  = uint(rcv.recovered_keys)
 	stat.RecoveredBuckets = uint(rcv.recovered_buckets)
 	stat.FailedKeys = uint(rcv.failed_keys)
 	stat.FailedBuckets = uint(rcv.failed_buckets)
 	stat.DuplicateKeys = uint(C.gdbm_recover_duplicate_keys(&rcv))
-
+	if res != 0 {
+		// Return the statistics gathered so far, to let the caller
+		// know what failed.
+		return stat, db.lastError()
+	}
+	if db.index != nil {
+		if err = db.rebuildIndex(); err != nil {
+			return stat, err
+		}
+	}
 	return
 }
 
@@ -1177,9 +1821,24 @@ func (db *Database) Sync() (err error) {
 		err = ErrNotOpen
 		return
 	}
+	return db.syncFile()
+}
 
+// Synchronize the database file and save the index.  The caller must hold
+// the database lock.
+func (db *Database) syncFile() (err error) {
 	if C.int_wrapper(C.GdbmIntFunc(C.gdbm_sync), db.dbf) != 0 {
 		err = db.lastError()
+	} else if db.index != nil {
+		err = db.index.save()
+	}
+	db.stats.Syncs++
+	if err != nil {
+		db.stats.Errors++
+		db.stats.LastError = err
+	} else {
+		db.stats.LastSync = time.Now()
+		db.stats.PendingWrites = 0
 	}
 	return
 }
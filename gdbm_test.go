@@ -6,6 +6,10 @@ import (
 	"errors"
 	"os"
 	"regexp"
+	"bytes"
+	"strings"
+	"io"
+	"time"
 )
 
 var dbname = "junk.gdbm"
@@ -81,6 +85,142 @@ func TestFetch(t *testing.T) {
 	}
 }
 
+func TestFetchInto(t *testing.T) {
+	if ! createDatabase(t) {
+		return
+	}
+
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	buf := make([]byte, 0, 64)
+	for i, k := range keys {
+		val, err := db.FetchInto([]byte(k), buf[:0])
+		if err != nil {
+			t.Errorf("Can't fetch key %d: %s", i, err.Error())
+		} else if string(val) != strconv.Itoa(i) {
+			t.Errorf("Wrong value for %d: %q", i, val)
+		} else if &val[0] != &buf[:1][0] {
+			t.Errorf("Value for %d not stored in the supplied buffer", i)
+		}
+	}
+
+	// Appending
+	val, err := db.FetchInto([]byte("ten"), []byte("val="))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "val=9" {
+		t.Errorf("Wrong value: %q", val)
+	}
+
+	// Unexisting key
+	val, err = db.FetchInto([]byte("zero"), buf[:0])
+	if !errors.Is(err, ErrItemNotFound) {
+		t.Fatal("Unexpected error: ", err)
+	}
+	if len(val) != 0 {
+		t.Errorf("Buffer modified on error: %q", val)
+	}
+}
+
+func TestView(t *testing.T) {
+	if ! createDatabase(t) {
+		return
+	}
+
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	for i, k := range keys {
+		var n int
+		err := db.View([]byte(k), func(val []byte) (err error) {
+			// Make sure the database can be used from the callback.
+			if ! db.Exists([]byte(k)) {
+				t.Errorf("Key %q doesn't exist", k)
+			}
+			n, err = strconv.Atoi(string(val))
+			return
+		})
+		if err != nil {
+			t.Errorf("Can't view key %d: %s", i, err.Error())
+		} else if n != i {
+			t.Errorf("Wrong value for %d: %d", i, n)
+		}
+	}
+
+	// Callback error is passed through
+	myErr := errors.New("my error")
+	if err := db.View([]byte("one"), func([]byte) error { return myErr }); err != myErr {
+		t.Error("Unexpected error: ", err)
+	}
+
+	// Callback is not called for unexisting keys
+	err = db.View([]byte("zero"), func([]byte) error {
+		t.Error("Callback called for unexisting key")
+		return nil
+	})
+	if !errors.Is(err, ErrItemNotFound) {
+		t.Fatal("Unexpected error: ", err)
+	}
+}
+
+func benchmarkFetch(b *testing.B, fetch func(*Database, []byte) error) {
+	db, err := Open(dbname, ModeNewdb)
+	if err != nil {
+		b.Fatal("Can't create the database:", err)
+	}
+	b.Cleanup(func() {
+		db.Close()
+		os.Remove(dbname)
+	})
+	value := bytes.Repeat([]byte{'x'}, 100)
+	for _, k := range keys {
+		if err := db.Store([]byte(k), value, true); err != nil {
+			b.Fatal(err)
+		}
+	}
+	bkeys := make([][]byte, len(keys))
+	for i, k := range keys {
+		bkeys[i] = []byte(k)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := fetch(db, bkeys[i % len(bkeys)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFetch(b *testing.B) {
+	benchmarkFetch(b, func(db *Database, key []byte) error {
+		_, err := db.Fetch(key)
+		return err
+	})
+}
+
+func BenchmarkFetchInto(b *testing.B) {
+	buf := make([]byte, 0, 128)
+	benchmarkFetch(b, func(db *Database, key []byte) (err error) {
+		_, err = db.FetchInto(key, buf[:0])
+		return
+	})
+}
+
+func BenchmarkView(b *testing.B) {
+	benchmarkFetch(b, func(db *Database, key []byte) error {
+		return db.View(key, func([]byte) error { return nil })
+	})
+}
+
 func TestDelete(t *testing.T) {
 	if !createDatabase(t) {
 		return
@@ -301,6 +441,221 @@ func TestModeLoad(t *testing.T) {
 	check_keys(db, t)
 }
 
+// Strip the first line (containing the creation date) from an ASCII dump.
+func stripDumpDate(b []byte) []byte {
+	if n := bytes.IndexByte(b, '\n'); n != -1 {
+		return b[n+1:]
+	}
+	return b
+}
+
+func TestDumpTo(t *testing.T) {
+	if ! createDatabase(t) {
+		return
+	}
+
+	dumpName := "junk.dump"
+	t.Cleanup(func() {
+		os.Remove(dumpName)
+	})
+
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	for _, format := range []int{AsciiDump, BinaryDump} {
+		err = db.Dump(DumpConfig{FileName: dumpName,
+			Format: format,
+			Rewrite: true,
+			FileMode: 0600})
+		if err != nil {
+			if errors.Is(err, ErrNotImplemented) {
+				return
+			}
+			t.Fatal("Dump failed: ", err)
+		}
+		expected, err := os.ReadFile(dumpName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err = db.DumpTo(&buf, format); err != nil {
+			t.Fatal("DumpTo failed: ", err)
+		}
+		result := buf.Bytes()
+		if format == AsciiDump {
+			expected = stripDumpDate(expected)
+			result = stripDumpDate(result)
+		}
+		if !bytes.Equal(expected, result) {
+			t.Errorf("Format %d: DumpTo output differs from Dump", format)
+		}
+	}
+}
+
+func TestDumpToTemp(t *testing.T) {
+	if ! createDatabase(t) {
+		return
+	}
+	db, err := Open(dbname, ModeWriter)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	var expected bytes.Buffer
+	if err = db.DumpTo(&expected, BinaryDump); err != nil {
+		t.Fatal("DumpTo failed: ", err)
+	}
+	dir := t.TempDir()
+	f, err := db.DumpToTemp(dir, BinaryDump)
+	if err != nil {
+		t.Fatal("DumpToTemp failed: ", err)
+	}
+	defer f.Close()
+	if ents, _ := os.ReadDir(dir); len(ents) != 0 {
+		t.Error("temporary file not removed")
+	}
+	// The database is not locked while the dump is read.
+	if err = db.Store([]byte("new"), []byte("value"), false); err != nil {
+		t.Fatal(err)
+	}
+	result, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected.Bytes(), result) {
+		t.Error("DumpToTemp output differs from DumpTo")
+	}
+}
+
+func TestLoadFrom(t *testing.T) {
+	if ! createDatabase(t) {
+		return
+	}
+
+	restoredName := "restored.db"
+	t.Cleanup(func() {
+		os.Remove(restoredName)
+	})
+
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	var buf bytes.Buffer
+	err = db.DumpTo(&buf, AsciiDump)
+	db.Close()
+	if err != nil {
+		if errors.Is(err, ErrNotImplemented) {
+			return
+		}
+		t.Fatal("DumpTo failed: ", err)
+	}
+	dump := buf.String()
+
+	db, err = Open(restoredName, ModeNewdb)
+	if err != nil {
+		t.Fatal("Can't create new database:", err)
+	}
+	defer db.Close()
+	if err = db.LoadFrom(strings.NewReader(dump), false); err != nil {
+		t.Fatal("LoadFrom failed: ", err)
+	}
+	check_keys(db, t)
+
+	// Loading again without replace must fail.
+	err = db.LoadFrom(strings.NewReader(dump), false)
+	if !errors.Is(err, ErrCannotReplace) {
+		t.Error("Unexpected error: ", err)
+	}
+
+	// Malformed input: corrupt the base64 data of the first key.
+	lines := strings.Split(dump, "\n")
+	for i, s := range lines {
+		if strings.HasPrefix(s, "#:len=") {
+			lines[i+1] = "!!!!"
+			break
+		}
+	}
+	err = db.LoadFrom(strings.NewReader(strings.Join(lines, "\n")), true)
+	var lerr *LoadError
+	if !errors.As(err, &lerr) {
+		t.Fatal("Expected LoadError, got ", err)
+	}
+	if lerr.Line == 0 {
+		t.Error("Line number not reported")
+	}
+
+	// Malformed input followed by a reader that never returns: LoadFrom
+	// must not wait for it.
+	block := make(chan struct{})
+	defer close(block)
+	r := io.MultiReader(strings.NewReader(strings.Join(lines, "\n")),
+			    blockingReader(block))
+	res := make(chan error, 1)
+	go func() {
+		res <- db.LoadFrom(r, true)
+	}()
+	select {
+	case err = <-res:
+		if !errors.As(err, &lerr) {
+			t.Error("Expected LoadError, got ", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("LoadFrom blocked on the reader")
+	}
+}
+
+// A reader that blocks until the channel is closed.
+type blockingReader chan struct{}
+
+func (r blockingReader) Read(p []byte) (int, error) {
+	<-r
+	return 0, io.EOF
+}
+
+func TestModeLoadReader(t *testing.T) {
+	if ! createDatabase(t) {
+		return
+	}
+
+	restoredName := "restored.db"
+	t.Cleanup(func() {
+		os.Remove(restoredName)
+	})
+
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	var buf bytes.Buffer
+	err = db.DumpTo(&buf, BinaryDump)
+	db.Close()
+	if err != nil {
+		if errors.Is(err, ErrNotImplemented) {
+			return
+		}
+		t.Fatal("DumpTo failed: ", err)
+	}
+
+	db, err = OpenConfig(DatabaseConfig{FileName: restoredName,
+			     Mode: ModeLoad,
+			     FileMode: 0600,
+			     DumpReader: &buf})
+	if err != nil {
+		t.Fatal("Load failed: ", err)
+	}
+	defer db.Close()
+	if name, err := db.FileName(); err == nil && name != restoredName {
+		t.Errorf("Wrong file name: %s", name)
+	}
+	check_keys(db, t)
+}
+
 func TestErrors(t *testing.T) {
 	os.Remove(dbname)
 	_, err := Open(dbname, ModeReader)
@@ -330,3 +685,34 @@ func TestVersion(t *testing.T) {
 		t.Fatal("Version string ", s, " doesn't match")
 	}
 }
+
+func TestNumsync(t *testing.T) {
+	if OF_NUMSYNC == 0 {
+		return
+	}
+	t.Cleanup(func() {
+		os.Remove(dbname)
+	})
+
+	db, err := OpenConfig(DatabaseConfig{FileName: dbname,
+				Mode: ModeNewdb,
+				Flags: OF_NUMSYNC,
+				FileMode: 0600})
+	if err != nil {
+		t.Fatal("Can't create the database:", err)
+	}
+	defer db.Close()
+	numsync, err := db.IsNumsync()
+	if err != nil {
+		t.Fatal("IsNumsync: ", err)
+	}
+	if !numsync {
+		t.Error("Database not in numsync format")
+	}
+	if err = db.Convert(false); err != nil {
+		t.Fatal("Convert: ", err)
+	}
+	if numsync, err = db.IsNumsync(); err != nil || numsync {
+		t.Error("Database not converted: ", numsync, err)
+	}
+}
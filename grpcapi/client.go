@@ -0,0 +1,273 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"github.com/graygnuorg/go-gdbm"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Client accesses a remote database.  Its methods have the same
+// signatures and error semantics as those of *gdbm.Database.
+type Client struct {
+	rpc GDBMClient
+	conn *grpc.ClientConn
+	// Connection created by Dial, closed by Close.
+	ctx context.Context
+	closed *atomic.Bool
+	// Set by Close.  Shared with the copies made by WithContext.
+}
+
+var _ gdbm.KV = (*Client)(nil)
+
+// NewClient returns a client using the connection cc.  Closing the client
+// does not close the connection.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{rpc: NewGDBMClient(cc), ctx: context.Background(), closed: new(atomic.Bool)}
+}
+
+// Dial connects to the server at target and returns a client for it.
+// The connection is closed when the client is closed.
+func Dial(target string, opts ...grpc.DialOption) (*Client, error) {
+	conn, err := grpc.Dial(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c := NewClient(conn)
+	c.conn = conn
+	return c, nil
+}
+
+// WithContext returns a copy of the client whose calls use ctx.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	nc := *c
+	nc.ctx = ctx
+	return &nc
+}
+
+// RPC returns the underlying gRPC client.
+func (c *Client) RPC() GDBMClient {
+	return c.rpc
+}
+
+// Convert a status error returned by the server to a GDBM error.
+func fromStatus(err error) error {
+	st, ok := status.FromError(err)
+	if !ok || err == nil {
+		return err
+	}
+	for _, d := range st.Details() {
+		if info, ok := d.(*ErrorInfo); ok {
+			return gdbm.ErrorFromCode(int(info.Code))
+		}
+	}
+	switch st.Code() {
+	case codes.NotFound:
+		return gdbm.ErrItemNotFound
+	case codes.AlreadyExists:
+		return gdbm.ErrCannotReplace
+	case codes.PermissionDenied:
+		return gdbm.ErrReaderCantStore
+	}
+	return err
+}
+
+// Fetch returns the value of the key.
+func (c *Client) Fetch(key []byte) ([]byte, error) {
+	if c.closed.Load() {
+		return nil, gdbm.ErrNotOpen
+	}
+	resp, err := c.rpc.Get(c.ctx, &GetRequest{Key: key})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	if resp.Value == nil {
+		return []byte{}, nil
+	}
+	return resp.Value, nil
+}
+
+// Store the value under the key.  See gdbm.Database.Store.
+func (c *Client) Store(key []byte, value []byte, replace bool) error {
+	if c.closed.Load() {
+		return gdbm.ErrNotOpen
+	}
+	_, err := c.rpc.Put(c.ctx, &PutRequest{Key: key, Value: value, Replace: replace})
+	return fromStatus(err)
+}
+
+// Delete the key.
+func (c *Client) Delete(key []byte) error {
+	if c.closed.Load() {
+		return gdbm.ErrNotOpen
+	}
+	_, err := c.rpc.Delete(c.ctx, &DeleteRequest{Key: key})
+	return fromStatus(err)
+}
+
+// Exists returns true if the key exists.  As with gdbm.Database.Exists,
+// errors are reported as false.
+func (c *Client) Exists(key []byte) bool {
+	if c.closed.Load() {
+		return false
+	}
+	resp, err := c.rpc.Exists(c.ctx, &ExistsRequest{Key: key})
+	return err == nil && resp.Exists
+}
+
+// Count returns the number of keys.
+func (c *Client) Count() (uint, error) {
+	if c.closed.Load() {
+		return 0, gdbm.ErrNotOpen
+	}
+	resp, err := c.rpc.Count(c.ctx, &CountRequest{})
+	if err != nil {
+		return 0, fromStatus(err)
+	}
+	return uint(resp.Count), nil
+}
+
+// Iterator returns an iterator over all keys.  As with the local
+// database, it returns ErrItemNotFound after the last key.  The stream
+// is released when the iteration ends or fails.  An iteration that is
+// abandoned before that keeps its stream open until the client context
+// is done or the connection is closed: use IteratorCancel to release it
+// earlier.
+func (c *Client) Iterator() gdbm.DatabaseIterator {
+	next, _ := c.IteratorCancel()
+	return next
+}
+
+// IteratorCancel is like Iterator, but also returns a function that
+// abandons the iteration and releases its stream.  After it is called,
+// the iterator returns context.Canceled.
+func (c *Client) IteratorCancel() (gdbm.DatabaseIterator, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	var stream GDBM_ScanClient
+	var err error
+	return func() ([]byte, error) {
+		if err != nil {
+			return nil, err
+		}
+		if c.closed.Load() {
+			cancel()
+			err = gdbm.ErrNotOpen
+			return nil, err
+		}
+		if e := ctx.Err(); e != nil {
+			err = e
+			return nil, err
+		}
+		if stream == nil {
+			stream, err = c.rpc.Scan(ctx, &ScanRequest{KeysOnly: true})
+			if err != nil {
+				cancel()
+				err = fromStatus(err)
+				return nil, err
+			}
+		}
+		resp, e := stream.Recv()
+		if e != nil {
+			if e == io.EOF {
+				err = gdbm.ErrItemNotFound
+			} else if ctx.Err() != nil && c.ctx.Err() == nil {
+				// Canceled by the caller.
+				err = ctx.Err()
+			} else {
+				err = fromStatus(e)
+			}
+			cancel()
+			return nil, err
+		}
+		if resp.Key == nil {
+			return []byte{}, nil
+		}
+		return resp.Key, nil
+	}, cancel
+}
+
+// Sync synchronizes the remote database with its disk file.
+func (c *Client) Sync() error {
+	if c.closed.Load() {
+		return gdbm.ErrNotOpen
+	}
+	_, err := c.rpc.Sync(c.ctx, &SyncRequest{})
+	return fromStatus(err)
+}
+
+// Reorganize the remote database.
+func (c *Client) Reorganize() error {
+	if c.closed.Load() {
+		return gdbm.ErrNotOpen
+	}
+	_, err := c.rpc.Reorganize(c.ctx, &ReorganizeRequest{})
+	return fromStatus(err)
+}
+
+// DumpTo writes the dump of the remote database to w.  The format is
+// gdbm.AsciiDump or gdbm.BinaryDump.
+func (c *Client) DumpTo(w io.Writer, format int) error {
+	if c.closed.Load() {
+		return gdbm.ErrNotOpen
+	}
+	var req DumpRequest
+	switch format {
+	case gdbm.AsciiDump:
+		req.Format = DumpFormat_DUMP_FORMAT_ASCII
+	case gdbm.BinaryDump:
+		req.Format = DumpFormat_DUMP_FORMAT_BINARY
+	default:
+		return gdbm.ErrUsage
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+	stream, err := c.rpc.Dump(ctx, &req)
+	if err != nil {
+		return fromStatus(err)
+	}
+	for {
+		chunk, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fromStatus(err)
+		}
+		if _, err := w.Write(chunk.Data); err != nil {
+			return err
+		}
+	}
+}
+
+// Close the client.  If it was created by Dial, the connection is closed.
+// After Close, the methods of the client and of its copies made by
+// WithContext return gdbm.ErrNotOpen.
+func (c *Client) Close() error {
+	if !c.closed.CompareAndSwap(false, true) {
+		return gdbm.ErrNotOpen
+	}
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+// Package grpcapi provides a gRPC service for accessing GDBM databases.
+// The service is defined in gdbm.proto.  Server implements it on top
+// of a *gdbm.Database, and Client provides the same methods as
+// *gdbm.Database, so that remote databases can be used in place of
+// local ones.
+//
+// Server example:
+//
+//	db, err := gdbm.Open("data.gdbm", gdbm.ModeWrcreat)
+//	...
+//	s := grpc.NewServer()
+//	grpcapi.RegisterGDBMServer(s, grpcapi.NewServer(db))
+//	l, err := net.Listen("tcp", ":7000")
+//	...
+//	s.Serve(l)
+//
+// Client example:
+//
+//	c, err := grpcapi.Dial("localhost:7000",
+//		grpc.WithTransportCredentials(insecure.NewCredentials()))
+//	...
+//	defer c.Close()
+//	value, err := c.Fetch([]byte("key"))
+//
+// GDBM errors are transferred as gRPC statuses with an ErrorInfo detail
+// carrying the GDBM error code.  The client converts them back, so that
+// errors.Is(err, gdbm.ErrItemNotFound) and the like work as for local
+// databases.
+package grpcapi
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative gdbm.proto
@@ -0,0 +1,494 @@
+// go-gdbm - Go interface to the GNU DBM library.
+// Copyright (C) 2022 Sergey Poznyakoff
+//
+// go-gdbm is free software; you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation; either version 3 of the License, or (at your
+// option) any later version.
+//
+// go-gdbm is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with go-gdbm. If not, see <http://www.gnu.org/licenses/>.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: gdbm.proto
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	GDBM_Get_FullMethodName        = "/gdbm.v1.GDBM/Get"
+	GDBM_Put_FullMethodName        = "/gdbm.v1.GDBM/Put"
+	GDBM_Delete_FullMethodName     = "/gdbm.v1.GDBM/Delete"
+	GDBM_Exists_FullMethodName     = "/gdbm.v1.GDBM/Exists"
+	GDBM_Count_FullMethodName      = "/gdbm.v1.GDBM/Count"
+	GDBM_Scan_FullMethodName       = "/gdbm.v1.GDBM/Scan"
+	GDBM_Sync_FullMethodName       = "/gdbm.v1.GDBM/Sync"
+	GDBM_Reorganize_FullMethodName = "/gdbm.v1.GDBM/Reorganize"
+	GDBM_Dump_FullMethodName       = "/gdbm.v1.GDBM/Dump"
+)
+
+// GDBMClient is the client API for GDBM service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GDBMClient interface {
+	// Fetch the value of a key.
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	// Store a key/value pair.
+	Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error)
+	// Delete a key.
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// Check whether a key exists.
+	Exists(ctx context.Context, in *ExistsRequest, opts ...grpc.CallOption) (*ExistsResponse, error)
+	// Return the number of keys.
+	Count(ctx context.Context, in *CountRequest, opts ...grpc.CallOption) (*CountResponse, error)
+	// Iterate over keys (and, optionally, values).
+	Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (GDBM_ScanClient, error)
+	// Synchronize the database with its disk file.
+	Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (*SyncResponse, error)
+	// Reorganize the database.
+	Reorganize(ctx context.Context, in *ReorganizeRequest, opts ...grpc.CallOption) (*ReorganizeResponse, error)
+	// Stream the database dump.
+	Dump(ctx context.Context, in *DumpRequest, opts ...grpc.CallOption) (GDBM_DumpClient, error)
+}
+
+type gDBMClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGDBMClient(cc grpc.ClientConnInterface) GDBMClient {
+	return &gDBMClient{cc}
+}
+
+func (c *gDBMClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, GDBM_Get_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gDBMClient) Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error) {
+	out := new(PutResponse)
+	err := c.cc.Invoke(ctx, GDBM_Put_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gDBMClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, GDBM_Delete_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gDBMClient) Exists(ctx context.Context, in *ExistsRequest, opts ...grpc.CallOption) (*ExistsResponse, error) {
+	out := new(ExistsResponse)
+	err := c.cc.Invoke(ctx, GDBM_Exists_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gDBMClient) Count(ctx context.Context, in *CountRequest, opts ...grpc.CallOption) (*CountResponse, error) {
+	out := new(CountResponse)
+	err := c.cc.Invoke(ctx, GDBM_Count_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gDBMClient) Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (GDBM_ScanClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GDBM_ServiceDesc.Streams[0], GDBM_Scan_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gDBMScanClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GDBM_ScanClient interface {
+	Recv() (*ScanResponse, error)
+	grpc.ClientStream
+}
+
+type gDBMScanClient struct {
+	grpc.ClientStream
+}
+
+func (x *gDBMScanClient) Recv() (*ScanResponse, error) {
+	m := new(ScanResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *gDBMClient) Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (*SyncResponse, error) {
+	out := new(SyncResponse)
+	err := c.cc.Invoke(ctx, GDBM_Sync_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gDBMClient) Reorganize(ctx context.Context, in *ReorganizeRequest, opts ...grpc.CallOption) (*ReorganizeResponse, error) {
+	out := new(ReorganizeResponse)
+	err := c.cc.Invoke(ctx, GDBM_Reorganize_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gDBMClient) Dump(ctx context.Context, in *DumpRequest, opts ...grpc.CallOption) (GDBM_DumpClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GDBM_ServiceDesc.Streams[1], GDBM_Dump_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gDBMDumpClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GDBM_DumpClient interface {
+	Recv() (*DumpChunk, error)
+	grpc.ClientStream
+}
+
+type gDBMDumpClient struct {
+	grpc.ClientStream
+}
+
+func (x *gDBMDumpClient) Recv() (*DumpChunk, error) {
+	m := new(DumpChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GDBMServer is the server API for GDBM service.
+// All implementations must embed UnimplementedGDBMServer
+// for forward compatibility
+type GDBMServer interface {
+	// Fetch the value of a key.
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	// Store a key/value pair.
+	Put(context.Context, *PutRequest) (*PutResponse, error)
+	// Delete a key.
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// Check whether a key exists.
+	Exists(context.Context, *ExistsRequest) (*ExistsResponse, error)
+	// Return the number of keys.
+	Count(context.Context, *CountRequest) (*CountResponse, error)
+	// Iterate over keys (and, optionally, values).
+	Scan(*ScanRequest, GDBM_ScanServer) error
+	// Synchronize the database with its disk file.
+	Sync(context.Context, *SyncRequest) (*SyncResponse, error)
+	// Reorganize the database.
+	Reorganize(context.Context, *ReorganizeRequest) (*ReorganizeResponse, error)
+	// Stream the database dump.
+	Dump(*DumpRequest, GDBM_DumpServer) error
+	mustEmbedUnimplementedGDBMServer()
+}
+
+// UnimplementedGDBMServer must be embedded to have forward compatible implementations.
+type UnimplementedGDBMServer struct {
+}
+
+func (UnimplementedGDBMServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedGDBMServer) Put(context.Context, *PutRequest) (*PutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Put not implemented")
+}
+func (UnimplementedGDBMServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedGDBMServer) Exists(context.Context, *ExistsRequest) (*ExistsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Exists not implemented")
+}
+func (UnimplementedGDBMServer) Count(context.Context, *CountRequest) (*CountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Count not implemented")
+}
+func (UnimplementedGDBMServer) Scan(*ScanRequest, GDBM_ScanServer) error {
+	return status.Errorf(codes.Unimplemented, "method Scan not implemented")
+}
+func (UnimplementedGDBMServer) Sync(context.Context, *SyncRequest) (*SyncResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Sync not implemented")
+}
+func (UnimplementedGDBMServer) Reorganize(context.Context, *ReorganizeRequest) (*ReorganizeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Reorganize not implemented")
+}
+func (UnimplementedGDBMServer) Dump(*DumpRequest, GDBM_DumpServer) error {
+	return status.Errorf(codes.Unimplemented, "method Dump not implemented")
+}
+func (UnimplementedGDBMServer) mustEmbedUnimplementedGDBMServer() {}
+
+// UnsafeGDBMServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GDBMServer will
+// result in compilation errors.
+type UnsafeGDBMServer interface {
+	mustEmbedUnimplementedGDBMServer()
+}
+
+func RegisterGDBMServer(s grpc.ServiceRegistrar, srv GDBMServer) {
+	s.RegisterService(&GDBM_ServiceDesc, srv)
+}
+
+func _GDBM_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GDBMServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GDBM_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GDBMServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GDBM_Put_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PutRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GDBMServer).Put(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GDBM_Put_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GDBMServer).Put(ctx, req.(*PutRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GDBM_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GDBMServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GDBM_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GDBMServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GDBM_Exists_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExistsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GDBMServer).Exists(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GDBM_Exists_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GDBMServer).Exists(ctx, req.(*ExistsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GDBM_Count_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GDBMServer).Count(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GDBM_Count_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GDBMServer).Count(ctx, req.(*CountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GDBM_Scan_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ScanRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GDBMServer).Scan(m, &gDBMScanServer{stream})
+}
+
+type GDBM_ScanServer interface {
+	Send(*ScanResponse) error
+	grpc.ServerStream
+}
+
+type gDBMScanServer struct {
+	grpc.ServerStream
+}
+
+func (x *gDBMScanServer) Send(m *ScanResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _GDBM_Sync_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SyncRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GDBMServer).Sync(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GDBM_Sync_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GDBMServer).Sync(ctx, req.(*SyncRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GDBM_Reorganize_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReorganizeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GDBMServer).Reorganize(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GDBM_Reorganize_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GDBMServer).Reorganize(ctx, req.(*ReorganizeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GDBM_Dump_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DumpRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GDBMServer).Dump(m, &gDBMDumpServer{stream})
+}
+
+type GDBM_DumpServer interface {
+	Send(*DumpChunk) error
+	grpc.ServerStream
+}
+
+type gDBMDumpServer struct {
+	grpc.ServerStream
+}
+
+func (x *gDBMDumpServer) Send(m *DumpChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// GDBM_ServiceDesc is the grpc.ServiceDesc for GDBM service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GDBM_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gdbm.v1.GDBM",
+	HandlerType: (*GDBMServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _GDBM_Get_Handler,
+		},
+		{
+			MethodName: "Put",
+			Handler:    _GDBM_Put_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _GDBM_Delete_Handler,
+		},
+		{
+			MethodName: "Exists",
+			Handler:    _GDBM_Exists_Handler,
+		},
+		{
+			MethodName: "Count",
+			Handler:    _GDBM_Count_Handler,
+		},
+		{
+			MethodName: "Sync",
+			Handler:    _GDBM_Sync_Handler,
+		},
+		{
+			MethodName: "Reorganize",
+			Handler:    _GDBM_Reorganize_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Scan",
+			Handler:       _GDBM_Scan_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Dump",
+			Handler:       _GDBM_Dump_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "gdbm.proto",
+}
@@ -0,0 +1,260 @@
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+	"github.com/graygnuorg/go-gdbm"
+	"github.com/graygnuorg/go-gdbm/kvtest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Methods shared by *gdbm.Database and *Client.
+type database interface {
+	Fetch(key []byte) ([]byte, error)
+	Store(key []byte, value []byte, replace bool) error
+	Delete(key []byte) error
+	Exists(key []byte) bool
+	Count() (uint, error)
+	Iterator() gdbm.DatabaseIterator
+	Sync() error
+	Reorganize() error
+	DumpTo(w io.Writer, format int) error
+	Close() error
+}
+
+var (
+	_ database = (*gdbm.Database)(nil)
+	_ database = (*Client)(nil)
+)
+
+// Start a server for db and return a client connected to it.
+func startServer(t *testing.T, db *gdbm.Database) *Client {
+	l := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	RegisterGDBMServer(s, NewServer(db))
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+
+	c, err := Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return l.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClient(t *testing.T) {
+	c := startServer(t, kvtest.OpenDatabase(t, kvtest.Numbered(10), gdbm.ModeNewdb))
+
+	value, err := c.Fetch([]byte("key1"))
+	if err != nil || string(value) != "1" {
+		t.Errorf("Fetch returned %q, %v", value, err)
+	}
+	if _, err = c.Fetch([]byte("nokey")); !errors.Is(err, gdbm.ErrItemNotFound) {
+		t.Errorf("Fetch of missing key returned %v", err)
+	}
+
+	if err = c.Store([]byte("key1"), []byte("x"), false); !errors.Is(err, gdbm.ErrCannotReplace) {
+		t.Errorf("Store without replace returned %v", err)
+	}
+	if err = c.Store([]byte("key1"), []byte("x"), true); err != nil {
+		t.Errorf("Store returned %v", err)
+	}
+	if err = c.Store([]byte("empty"), []byte{}, false); err != nil {
+		t.Errorf("Store returned %v", err)
+	}
+	if value, err = c.Fetch([]byte("empty")); err != nil || value == nil || len(value) != 0 {
+		t.Errorf("Fetch of empty value returned %q, %v", value, err)
+	}
+
+	if !c.Exists([]byte("key2")) || c.Exists([]byte("nokey")) {
+		t.Error("Exists returned wrong results")
+	}
+	if err = c.Delete([]byte("key2")); err != nil {
+		t.Errorf("Delete returned %v", err)
+	}
+	if err = c.Delete([]byte("key2")); !errors.Is(err, gdbm.ErrItemNotFound) {
+		t.Errorf("Delete of missing key returned %v", err)
+	}
+
+	if n, err := c.Count(); err != nil || n != 10 {
+		t.Errorf("Count returned %d, %v", n, err)
+	}
+	if err = c.Sync(); err != nil {
+		t.Errorf("Sync returned %v", err)
+	}
+	if err = c.Reorganize(); err != nil {
+		t.Errorf("Reorganize returned %v", err)
+	}
+}
+
+func TestIterator(t *testing.T) {
+	c := startServer(t, kvtest.OpenDatabase(t, kvtest.Numbered(10), gdbm.ModeNewdb))
+	var keys []string
+	next := c.Iterator()
+	var err error
+	var key []byte
+	for key, err = next(); err == nil; key, err = next() {
+		keys = append(keys, string(key))
+	}
+	if !errors.Is(err, gdbm.ErrItemNotFound) {
+		t.Fatalf("iteration ended with %v", err)
+	}
+	if _, err = next(); !errors.Is(err, gdbm.ErrItemNotFound) {
+		t.Errorf("exhausted iterator returned %v", err)
+	}
+	sort.Strings(keys)
+	if len(keys) != 10 || keys[0] != "key0" || keys[9] != "key9" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+}
+
+func TestIteratorCancel(t *testing.T) {
+	c := startServer(t, kvtest.OpenDatabase(t, kvtest.Numbered(10), gdbm.ModeNewdb))
+	next, cancel := c.IteratorCancel()
+	if _, err := next(); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := next(); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled iterator returned %v", err)
+	}
+	// The client remains usable.
+	if n, err := c.Count(); err != nil || n != 10 {
+		t.Errorf("Count returned %d, %v", n, err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	c := startServer(t, kvtest.OpenDatabase(t, kvtest.Numbered(10), gdbm.ModeNewdb))
+	c.Store([]byte("other"), []byte("x"), true)
+	stream, err := c.RPC().Scan(context.Background(), &ScanRequest{Prefix: []byte("key")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(resp.Value) != string(resp.Key[3:]) {
+			t.Errorf("wrong value %q for %q", resp.Value, resp.Key)
+		}
+		n++
+	}
+	if n != 10 {
+		t.Errorf("expected 10 records, got %d", n)
+	}
+}
+
+func TestDump(t *testing.T) {
+	db := kvtest.OpenDatabase(t, kvtest.Numbered(10), gdbm.ModeNewdb)
+	c := startServer(t, db)
+	for _, format := range []int{gdbm.AsciiDump, gdbm.BinaryDump} {
+		var local, remote bytes.Buffer
+		if err := db.DumpTo(&local, format); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.DumpTo(&remote, format); err != nil {
+			t.Fatal(err)
+		}
+		// The ASCII dump contains a timestamp; compare only sizes.
+		if local.Len() != remote.Len() {
+			t.Errorf("format %d: local dump is %d bytes, remote %d", format, local.Len(), remote.Len())
+		}
+	}
+	if err := c.DumpTo(io.Discard, 100); !errors.Is(err, gdbm.ErrUsage) {
+		t.Errorf("DumpTo with bad format returned %v", err)
+	}
+}
+
+// Dump stream that blocks until released.
+type stalledStream struct {
+	GDBM_DumpServer
+	started chan struct{}
+	release chan struct{}
+	once sync.Once
+}
+
+func (s *stalledStream) Send(*DumpChunk) error {
+	s.once.Do(func() { close(s.started) })
+	<-s.release
+	return nil
+}
+
+func TestDumpStalledClient(t *testing.T) {
+	db := kvtest.OpenDatabase(t, kvtest.Numbered(10), gdbm.ModeNewdb)
+	stream := &stalledStream{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- NewServer(db).Dump(&DumpRequest{}, stream)
+	}()
+	<-stream.started
+
+	// Writers are not blocked by the stalled client.
+	stored := make(chan error, 1)
+	go func() {
+		stored <- db.Store([]byte("new"), []byte("value"), false)
+	}()
+	select {
+	case err := <-stored:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Store blocked by a stalled dump")
+	}
+	close(stream.release)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	c := startServer(t, kvtest.OpenDatabase(t, kvtest.Numbered(10), gdbm.ModeReader))
+	err := c.Store([]byte("key1"), []byte("x"), true)
+	if !errors.Is(err, gdbm.ErrReaderCantStore) {
+		t.Errorf("Store returned %v", err)
+	}
+	_, err = c.RPC().Put(context.Background(), &PutRequest{Key: []byte("key1")})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Put returned %v", err)
+	}
+	_, err = c.RPC().Get(context.Background(), &GetRequest{Key: []byte("nokey")})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Get returned %v", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	kvtest.Run(t, func(t *testing.T, records map[string]string, readOnly bool) gdbm.KV {
+		mode := gdbm.ModeNewdb
+		if readOnly {
+			mode = gdbm.ModeReader
+		}
+		db := kvtest.OpenDatabase(t, records, mode)
+		return startServer(t, db)
+	})
+}
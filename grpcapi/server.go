@@ -0,0 +1,177 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"github.com/graygnuorg/go-gdbm"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements GDBMServer for a database.
+type Server struct {
+	UnimplementedGDBMServer
+	db *gdbm.Database
+}
+
+// NewServer returns a server for the database.
+func NewServer(db *gdbm.Database) *Server {
+	return &Server{db: db}
+}
+
+// Returns the gRPC status code corresponding to the GDBM error code.
+func statusCode(code int) codes.Code {
+	switch code {
+	case gdbm.GDBM_ITEM_NOT_FOUND:
+		return codes.NotFound
+	case gdbm.GDBM_CANNOT_REPLACE:
+		return codes.AlreadyExists
+	case gdbm.GDBM_READER_CANT_STORE,
+		gdbm.GDBM_READER_CANT_DELETE,
+		gdbm.GDBM_READER_CANT_REORGANIZE:
+		return codes.PermissionDenied
+	case gdbm.GDBM_NOT_OPEN, gdbm.GDBM_NEED_RECOVERY:
+		return codes.FailedPrecondition
+	case gdbm.GDBM_NOT_IMPLEMENTED:
+		return codes.Unimplemented
+	}
+	return codes.Internal
+}
+
+// Convert the error to a gRPC status error.
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	var gerr *gdbm.GdbmError
+	if errors.As(err, &gerr) {
+		st := status.New(statusCode(gerr.Code()), err.Error())
+		if dst, e := st.WithDetails(&ErrorInfo{Code: int32(gerr.Code())}); e == nil {
+			st = dst
+		}
+		return st.Err()
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+func (s *Server) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+	value, err := s.db.Fetch(req.Key)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &GetResponse{Value: value}, nil
+}
+
+func (s *Server) Put(ctx context.Context, req *PutRequest) (*PutResponse, error) {
+	if err := s.db.Store(req.Key, req.Value, req.Replace); err != nil {
+		return nil, toStatus(err)
+	}
+	return &PutResponse{}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, req *DeleteRequest) (*DeleteResponse, error) {
+	if err := s.db.Delete(req.Key); err != nil {
+		return nil, toStatus(err)
+	}
+	return &DeleteResponse{}, nil
+}
+
+func (s *Server) Exists(ctx context.Context, req *ExistsRequest) (*ExistsResponse, error) {
+	return &ExistsResponse{Exists: s.db.Exists(req.Key)}, nil
+}
+
+func (s *Server) Count(ctx context.Context, req *CountRequest) (*CountResponse, error) {
+	n, err := s.db.Count()
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &CountResponse{Count: uint64(n)}, nil
+}
+
+func (s *Server) Scan(req *ScanRequest, stream GDBM_ScanServer) error {
+	c := s.db.CursorContext(stream.Context())
+	defer c.Close()
+	for c.Next() {
+		key := c.Key()
+		if !bytes.HasPrefix(key, req.Prefix) {
+			continue
+		}
+		resp := &ScanResponse{Key: key}
+		if !req.KeysOnly {
+			if resp.Value = c.Value(); resp.Value == nil {
+				break
+			}
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+	return toStatus(c.Err())
+}
+
+func (s *Server) Sync(ctx context.Context, req *SyncRequest) (*SyncResponse, error) {
+	if err := s.db.Sync(); err != nil {
+		return nil, toStatus(err)
+	}
+	return &SyncResponse{}, nil
+}
+
+func (s *Server) Reorganize(ctx context.Context, req *ReorganizeRequest) (*ReorganizeResponse, error) {
+	if err := s.db.Reorganize(); err != nil {
+		return nil, toStatus(err)
+	}
+	return &ReorganizeResponse{}, nil
+}
+
+// Writer sending its data as dump chunks.
+type chunkWriter struct {
+	stream GDBM_DumpServer
+}
+
+func (w chunkWriter) Write(p []byte) (int, error) {
+	if err := w.stream.Send(&DumpChunk{Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *Server) Dump(req *DumpRequest, stream GDBM_DumpServer) error {
+	format := gdbm.AsciiDump
+	switch req.Format {
+	case DumpFormat_DUMP_FORMAT_ASCII:
+	case DumpFormat_DUMP_FORMAT_BINARY:
+		format = gdbm.BinaryDump
+	default:
+		return status.Error(codes.InvalidArgument, "unknown dump format")
+	}
+	// Don't hold the database lock while sending the dump to a
+	// possibly slow client.
+	f, err := s.db.DumpToTemp("", format)
+	if err != nil {
+		return toStatus(err)
+	}
+	defer f.Close()
+	_, err = io.Copy(chunkWriter{stream}, f)
+	return err
+}
@@ -0,0 +1,664 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"github.com/graygnuorg/go-gdbm/format"
+)
+
+// Suffix appended to the database file name to obtain the name of its
+// index file.
+const IndexSuffix = ".idx"
+
+// Magic string starting index files.
+const indexMagic = "GDBMIDX2"
+
+var (
+	ErrNoIndex = errors.New("gdbm: database has no index")
+	// Returned by index operations if the database was opened
+	// without the Index option.
+	ErrBadIndex = errors.New("gdbm: malformed index file")
+	// The index file is corrupted.
+)
+
+// State of the database file recorded in the index file.
+type indexStamp struct {
+	Size int64
+	Mtime int64
+	Ctime int64
+	// Size, modification and status change times (ns) of the
+	// database file.  Unlike mtime, ctime can't be reset, so it
+	// detects rewrites that preserve the size and modification time.
+	Inode uint64
+	// Inode number: changes if the file is replaced.
+	Numsync uint32
+	// Synchronization counter of databases in extended format, 0
+	// otherwise.
+}
+
+// Ordered index of database keys.  The index is kept in memory and saved
+// to the index file by Sync and Close.
+//
+// The index file consists of a snapshot of the index, followed by a
+// journal.  Each save appends to the journal a group of records listing
+// the keys added and removed since the previous save, so that its cost
+// is proportional to the number of changes.  The snapshot is rewritten
+// when the journal grows larger than it.  Snapshot and journal groups
+// carry the stamp of the database file at the moment of saving.  If the
+// last stamp doesn't match when opening the database, the database was
+// modified without updating the index, which is then rebuilt.
+type orderedIndex struct {
+	dbname string
+	// Name of the database file.
+	filename string
+	// Name of the index file.
+	keys *keySet
+	// Indexed keys.
+	readOnly bool
+	// Don't save the index.
+	changes map[string]bool
+	// Keys added (true) or removed (false) since the last save.
+	rewrite bool
+	// The snapshot must be rewritten on the next save.
+	stamp indexStamp
+	// Stamp recorded in the index file.
+	snapshot int64
+	// Size of the snapshot in the index file.
+	end int64
+	// Size of the valid data in the index file, including the journal.
+}
+
+// Add key to the index, unless it is already there.
+func (idx *orderedIndex) insert(key []byte) {
+	if idx.keys.insert(append([]byte{}, key...)) {
+		idx.changes[string(key)] = true
+	}
+}
+
+// Remove key from the index.
+func (idx *orderedIndex) remove(key []byte) {
+	if idx.keys.remove(key) {
+		idx.changes[string(key)] = false
+	}
+}
+
+// Return true if the index was modified since it was last saved.
+func (idx *orderedIndex) modified() bool {
+	return idx.rewrite || len(idx.changes) > 0
+}
+
+// Return the keys of the database, sorted.  The caller must hold the
+// database lock.
+func (db *Database) sortedKeys() ([][]byte, error) {
+	var keys [][]byte
+	err := db.eachKey(func(key []byte) error {
+		keys = append(keys, append([]byte{}, key...))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortKeys(keys)
+	return keys, nil
+}
+
+// Regenerate the index from the database.  The caller must hold the
+// database lock.
+func (db *Database) rebuildIndex() error {
+	keys := newKeySet()
+	err := db.eachKey(func(key []byte) error {
+		keys.insert(append([]byte{}, key...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	db.index.keys = keys
+	db.index.changes = make(map[string]bool)
+	db.index.rewrite = true
+	return nil
+}
+
+// Open the index of the database file dbname.  The index is loaded from
+// the index file, if it is up to date, and rebuilt otherwise.
+func (db *Database) openIndex(dbname string, readOnly bool) error {
+	db.index = &orderedIndex{
+		dbname: dbname,
+		filename: dbname + IndexSuffix,
+		readOnly: readOnly,
+		keys: newKeySet(),
+		changes: make(map[string]bool),
+	}
+	stamp, _, err := db.index.currentStamp()
+	if err != nil {
+		return err
+	}
+	if err := db.index.load(); err == nil && db.index.stamp == stamp {
+		return nil
+	}
+	return db.rebuildIndex()
+}
+
+// Return the current stamp and permissions of the database file.
+func (idx *orderedIndex) currentStamp() (indexStamp, os.FileMode, error) {
+	fi, err := os.Stat(idx.dbname)
+	if err != nil {
+		return indexStamp{}, 0, err
+	}
+	stamp := indexStamp{
+		Size: fi.Size(),
+		Mtime: fi.ModTime().UnixNano(),
+	}
+	stamp.Ctime, stamp.Inode = statIdentity(fi)
+	// Unreadable headers are left for the library to diagnose.
+	if f, err := format.Open(idx.dbname); err == nil {
+		if f.Header.Numsync {
+			stamp.Numsync = f.Header.NumsyncCount
+		}
+		f.Close()
+	}
+	return stamp, fi.Mode().Perm(), nil
+}
+
+// Read the index file.  A journal group that is truncated or fails the
+// checksum is assumed to be the result of an interrupted save: it and
+// anything following it are ignored.
+func (idx *orderedIndex) load() error {
+	data, err := os.ReadFile(idx.filename)
+	if err != nil {
+		return err
+	}
+	if len(data) < len(indexMagic) || string(data[:len(indexMagic)]) != indexMagic {
+		return ErrBadIndex
+	}
+	r := bytes.NewReader(data[len(indexMagic):])
+	var hdr struct {
+		Stamp indexStamp
+		Count uint64
+	}
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		return ErrBadIndex
+	}
+	if hdr.Count > uint64(r.Len()) {
+		return ErrBadIndex
+	}
+	keys := newKeySet()
+	var prev []byte
+	for i := uint64(0); i < hdr.Count; i++ {
+		key, err := readIndexKey(r)
+		if err != nil {
+			return err
+		}
+		if i > 0 && bytes.Compare(prev, key) >= 0 {
+			return ErrBadIndex
+		}
+		keys.insert(key)
+		prev = key
+	}
+	snapshot := len(data) - r.Len()
+	if r.Len() < 4 || crc32.ChecksumIEEE(data[:snapshot]) != binary.BigEndian.Uint32(data[snapshot:]) {
+		return ErrBadIndex
+	}
+	snapshot += 4
+
+	stamp := hdr.Stamp
+	end := snapshot
+	for len(data) - end >= 8 {
+		n := binary.BigEndian.Uint32(data[end:])
+		if uint64(n) > uint64(len(data) - end - 8) {
+			break
+		}
+		group := data[end+4 : end+4+int(n)]
+		if crc32.ChecksumIEEE(group) != binary.BigEndian.Uint32(data[end+4+int(n):]) {
+			break
+		}
+		if stamp, err = replayIndexGroup(keys, group); err != nil {
+			return err
+		}
+		end += 8 + int(n)
+	}
+
+	idx.keys = keys
+	idx.changes = make(map[string]bool)
+	idx.rewrite = false
+	idx.stamp = stamp
+	idx.snapshot = int64(snapshot)
+	idx.end = int64(end)
+	return nil
+}
+
+// Read a length-prefixed key.
+func readIndexKey(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return nil, ErrBadIndex
+	}
+	key := make([]byte, n)
+	r.Read(key)
+	return key, nil
+}
+
+// Apply the changes from a journal group to keys and return the stamp
+// recorded in it.
+func replayIndexGroup(keys *keySet, group []byte) (stamp indexStamp, err error) {
+	r := bytes.NewReader(group)
+	count, err := binary.ReadUvarint(r)
+	if err != nil || count > uint64(r.Len()) {
+		return stamp, ErrBadIndex
+	}
+	for i := uint64(0); i < count; i++ {
+		op, err := r.ReadByte()
+		if err != nil {
+			return stamp, ErrBadIndex
+		}
+		key, err := readIndexKey(r)
+		if err != nil {
+			return stamp, err
+		}
+		switch op {
+		case '+':
+			keys.insert(key)
+		case '-':
+			keys.remove(key)
+		default:
+			return stamp, ErrBadIndex
+		}
+	}
+	if binary.Read(r, binary.BigEndian, &stamp) != nil || r.Len() != 0 {
+		return stamp, ErrBadIndex
+	}
+	return stamp, nil
+}
+
+// Save the index, if it is modified or out of date with respect to the
+// database file.  This must be called after synchronizing or closing the
+// database, so that the stamp recorded in the index is final.
+func (idx *orderedIndex) save() error {
+	if idx.readOnly {
+		return nil
+	}
+	stamp, perm, err := idx.currentStamp()
+	if err != nil {
+		return err
+	}
+	if !idx.modified() && idx.stamp == stamp {
+		return nil
+	}
+	if idx.rewrite || idx.end - idx.snapshot >= idx.snapshot {
+		return idx.writeSnapshot(stamp, perm)
+	}
+	return idx.appendChanges(stamp, perm)
+}
+
+// Write the index file anew.  The file is replaced atomically.
+func (idx *orderedIndex) writeSnapshot(stamp indexStamp, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(idx.filename), filepath.Base(idx.filename) + ".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	h := crc32.NewIEEE()
+	w := bufio.NewWriter(io.MultiWriter(f, h))
+	w.WriteString(indexMagic)
+	binary.Write(w, binary.BigEndian, stamp)
+	binary.Write(w, binary.BigEndian, uint64(idx.keys.len()))
+	var lenbuf [binary.MaxVarintLen64]byte
+	for n := idx.keys.first(); n != nil; n = n.next[0] {
+		l := binary.PutUvarint(lenbuf[:], uint64(len(n.key)))
+		w.Write(lenbuf[:l])
+		w.Write(n.key)
+	}
+	err = w.Flush()
+	if err == nil {
+		err = binary.Write(f, binary.BigEndian, h.Sum32())
+	}
+	var size int64
+	if err == nil {
+		size, err = f.Seek(0, io.SeekCurrent)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), idx.filename)
+	}
+	if err != nil {
+		return err
+	}
+	idx.changes = make(map[string]bool)
+	idx.rewrite = false
+	idx.stamp = stamp
+	idx.snapshot = size
+	idx.end = size
+	return nil
+}
+
+// Append the changes since the last save to the journal.  A group is
+// encoded as its length, the number of changes, the changes themselves
+// (an operation byte followed by the length-prefixed key), the stamp and
+// the checksum.
+func (idx *orderedIndex) appendChanges(stamp indexStamp, perm os.FileMode) error {
+	f, err := os.OpenFile(idx.filename, os.O_WRONLY, 0)
+	if err != nil {
+		// The index file is missing or inaccessible: try to create it
+		// anew.
+		return idx.writeSnapshot(stamp, perm)
+	}
+	var group bytes.Buffer
+	group.Write(make([]byte, 4))
+	var buf [binary.MaxVarintLen64]byte
+	group.Write(buf[:binary.PutUvarint(buf[:], uint64(len(idx.changes)))])
+	for key, present := range idx.changes {
+		op := byte('-')
+		if present {
+			op = '+'
+		}
+		group.WriteByte(op)
+		group.Write(buf[:binary.PutUvarint(buf[:], uint64(len(key)))])
+		group.WriteString(key)
+	}
+	binary.Write(&group, binary.BigEndian, stamp)
+	b := group.Bytes()
+	binary.BigEndian.PutUint32(b, uint32(len(b) - 4))
+	binary.Write(&group, binary.BigEndian, crc32.ChecksumIEEE(b[4:]))
+
+	// Discard whatever follows the valid data, e.g. a group left
+	// incomplete by a failed save, so that the new group is not
+	// hidden behind it.
+	err = f.Truncate(idx.end)
+	if err == nil {
+		_, err = f.WriteAt(group.Bytes(), idx.end)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		idx.rewrite = true
+		return err
+	}
+	idx.changes = make(map[string]bool)
+	idx.stamp = stamp
+	idx.end += int64(group.Len())
+	return nil
+}
+
+// HasIndex returns true if the database maintains an ordered index.
+func (db *Database) HasIndex() bool {
+	return db.index != nil
+}
+
+// RebuildIndex regenerates the ordered index by iterating over all keys
+// in the database.  The new index is saved to the index file by the
+// next Sync or Close.
+func (db *Database) RebuildIndex() error {
+	db.sync.Lock()
+	defer db.sync.Unlock()
+	if db.dbf == nil {
+		return ErrNotOpen
+	}
+	if db.index == nil {
+		return ErrNoIndex
+	}
+	return db.rebuildIndex()
+}
+
+// IndexError describes inconsistencies between the ordered index and the
+// database found by CheckIndex.
+type IndexError struct {
+	Missing [][]byte
+	// Database keys absent from the index.
+	Extra [][]byte
+	// Index keys absent from the database.
+}
+
+func (err *IndexError) Error() string {
+	return "gdbm: index is inconsistent: " + strconv.Itoa(len(err.Missing)) +
+		" keys missing, " + strconv.Itoa(len(err.Extra)) + " extra keys"
+}
+
+// CheckIndex verifies that the ordered index contains exactly the keys
+// of the database.  If it does not, an *IndexError is returned.  Use
+// RebuildIndex to repair the index.
+func (db *Database) CheckIndex() error {
+	db.sync.RLock()
+	defer db.sync.RUnlock()
+	if db.dbf == nil {
+		return ErrNotOpen
+	}
+	if db.index == nil {
+		return ErrNoIndex
+	}
+	keys, err := db.sortedKeys()
+	if err != nil {
+		return err
+	}
+	var ierr IndexError
+	i, n := 0, db.index.keys.first()
+	for i < len(keys) || n != nil {
+		switch {
+		case n == nil:
+			ierr.Missing = append(ierr.Missing, keys[i])
+			i++
+		case i == len(keys):
+			ierr.Extra = append(ierr.Extra, n.key)
+			n = n.next[0]
+		default:
+			switch c := bytes.Compare(keys[i], n.key); {
+			case c < 0:
+				ierr.Missing = append(ierr.Missing, keys[i])
+				i++
+			case c > 0:
+				ierr.Extra = append(ierr.Extra, n.key)
+				n = n.next[0]
+			default:
+				i++
+				n = n.next[0]
+			}
+		}
+	}
+	if ierr.Missing != nil || ierr.Extra != nil {
+		return &ierr
+	}
+	return nil
+}
+
+// IndexCursor iterates over database keys in ascending order, using the
+// ordered index.  Unlike Cursor, it can move in both directions and be
+// positioned at an arbitrary key.  The database may be modified while
+// iterating: the cursor remembers its current key and locates the next
+// or previous one in the index on each move.
+//
+// Example:
+//	c, err := db.IndexCursor()
+//	if err != nil {
+//		panic(err)
+//	}
+//	for ok := c.Seek([]byte("b")); ok; ok = c.Next() {
+//		do_something(c.Key(), c.Value())
+//	}
+//	if err := c.Err(); err != nil {
+//		panic(err)
+//	}
+type IndexCursor struct {
+	db *Database
+	key []byte
+	value []byte
+	fetched bool
+	pos int
+	// Cursor position relative to the keys: one of the constants below.
+	err error
+}
+
+// Positions of IndexCursor.
+const (
+	indexUnpositioned = iota
+	indexOnKey
+	indexBeforeFirst
+	indexAfterLast
+)
+
+// IndexCursor returns a new cursor over the ordered index.  The cursor is
+// not positioned: Next moves it to the first key and Prev to the last one.
+func (db *Database) IndexCursor() (*IndexCursor, error) {
+	db.sync.RLock()
+	defer db.sync.RUnlock()
+	if db.dbf == nil {
+		return nil, ErrNotOpen
+	}
+	if db.index == nil {
+		return nil, ErrNoIndex
+	}
+	return &IndexCursor{db: db}, nil
+}
+
+// Position the cursor at the index node returned by fn.  If it returns
+// nil, the cursor is set to the returned position and false is returned.
+// Returns false as well if an error occurred.
+func (c *IndexCursor) move(fn func(keys *keySet) (*keySetNode, int)) bool {
+	if c.err != nil {
+		return false
+	}
+	db := c.db
+	db.sync.RLock()
+	defer db.sync.RUnlock()
+	c.key = nil
+	c.value = nil
+	c.fetched = false
+	if db.dbf == nil {
+		c.err = ErrNotOpen
+		c.pos = indexUnpositioned
+		return false
+	}
+	n, pos := fn(db.index.keys)
+	if n == nil {
+		c.pos = pos
+		return false
+	}
+	c.key = append([]byte{}, n.key...)
+	c.pos = indexOnKey
+	return true
+}
+
+// Seek positions the cursor at the first key greater than or equal to
+// key.  Returns false if there is no such key.
+func (c *IndexCursor) Seek(key []byte) bool {
+	return c.move(func(keys *keySet) (*keySetNode, int) {
+		return keys.ceil(key), indexAfterLast
+	})
+}
+
+// First positions the cursor at the smallest key.
+func (c *IndexCursor) First() bool {
+	return c.move(func(keys *keySet) (*keySetNode, int) {
+		return keys.first(), indexAfterLast
+	})
+}
+
+// Last positions the cursor at the largest key.
+func (c *IndexCursor) Last() bool {
+	return c.move(func(keys *keySet) (*keySetNode, int) {
+		return keys.last(), indexBeforeFirst
+	})
+}
+
+// Next moves the cursor to the next key.  If the cursor is not
+// positioned, it moves to the first key.  Returns false when there are no
+// more keys.
+func (c *IndexCursor) Next() bool {
+	cur, pos := c.key, c.pos
+	return c.move(func(keys *keySet) (*keySetNode, int) {
+		switch pos {
+		case indexUnpositioned, indexBeforeFirst:
+			return keys.first(), indexAfterLast
+		case indexAfterLast:
+			return nil, indexAfterLast
+		}
+		return keys.higher(cur), indexAfterLast
+	})
+}
+
+// Prev moves the cursor to the previous key.  If the cursor is not
+// positioned, it moves to the last key.  Returns false when there are no
+// more keys.
+func (c *IndexCursor) Prev() bool {
+	cur, pos := c.key, c.pos
+	return c.move(func(keys *keySet) (*keySetNode, int) {
+		switch pos {
+		case indexUnpositioned, indexAfterLast:
+			return keys.last(), indexBeforeFirst
+		case indexBeforeFirst:
+			return nil, indexBeforeFirst
+		}
+		return keys.lower(cur), indexBeforeFirst
+	})
+}
+
+// Returns the key at the current cursor position, or nil if the cursor
+// is not positioned on a key.
+func (c *IndexCursor) Key() []byte {
+	return c.key
+}
+
+// Returns the value associated with the current key.  The value is fetched
+// on the first call and cached.  On error, nil is returned and Err reports
+// the error.
+func (c *IndexCursor) Value() []byte {
+	if c.key == nil {
+		return nil
+	}
+	if !c.fetched {
+		value, err := c.db.Fetch(c.key)
+		if err != nil {
+			c.err = err
+			return nil
+		}
+		c.value = value
+		c.fetched = true
+	}
+	return c.value
+}
+
+// Returns the error that stopped the iteration, if any.
+func (c *IndexCursor) Err() error {
+	return c.err
+}
+
+// Close the cursor.  It is safe to call Close several times.
+func (c *IndexCursor) Close() error {
+	c.key = nil
+	c.value = nil
+	c.pos = indexUnpositioned
+	return nil
+}
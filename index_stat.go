@@ -0,0 +1,35 @@
+//go:build linux || openbsd || dragonfly || solaris
+
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+
+package gdbm
+
+import (
+	"os"
+	"syscall"
+)
+
+// Return the inode change time and inode number of the file described by
+// fi.
+func statIdentity(fi os.FileInfo) (ctime int64, inode uint64) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		ctime = st.Ctim.Nano()
+		inode = uint64(st.Ino)
+	}
+	return
+}
@@ -0,0 +1,31 @@
+//go:build !(linux || openbsd || dragonfly || solaris || darwin || freebsd || netbsd)
+
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+
+package gdbm
+
+import (
+	"os"
+)
+
+// Inode change time and number are not available on this system, so the
+// index stamp relies on the file size, modification time and numsync
+// counter only.
+func statIdentity(fi os.FileInfo) (ctime int64, inode uint64) {
+	return
+}
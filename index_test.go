@@ -0,0 +1,340 @@
+package gdbm
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func openIndexed(t *testing.T, mode int) *Database {
+	t.Helper()
+	db, err := OpenConfig(DatabaseConfig{FileName: dbname, Mode: mode, FileMode: 0666, Index: true})
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	return db
+}
+
+// Walk the index cursor forward from its current position.
+func walkIndex(c *IndexCursor, first bool, next func() bool) string {
+	var res []string
+	for ok := first; ok; ok = next() {
+		res = append(res, string(c.Key()))
+	}
+	return strings.Join(res, " ")
+}
+
+func TestIndexCursor(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	t.Cleanup(func() { os.Remove(dbname + IndexSuffix) })
+	db := openIndexed(t, ModeWriter)
+	defer db.Close()
+
+	c, err := db.IndexCursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	const all = "eight five four nine one seven six ten three two"
+	if s := walkIndex(c, c.Next(), c.Next); s != all {
+		t.Errorf("forward: %s", s)
+	}
+	if c.Next() {
+		t.Error("Next succeeded after the end")
+	}
+	if s := walkIndex(c, c.Prev(), c.Prev); s != "two three ten six seven one nine four five eight" {
+		t.Errorf("backward: %s", s)
+	}
+	if s := walkIndex(c, c.Seek([]byte("o")), c.Next); s != "one seven six ten three two" {
+		t.Errorf("seek: %s", s)
+	}
+	if s := walkIndex(c, c.Seek([]byte("seven")), c.Prev); s != "seven one nine four five eight" {
+		t.Errorf("seek backward: %s", s)
+	}
+	if c.Seek([]byte("z")) {
+		t.Error("Seek past the last key succeeded")
+	}
+	if !c.First() || string(c.Key()) != "eight" || string(c.Value()) != "7" {
+		t.Errorf("First: %q=%q", c.Key(), c.Value())
+	}
+	if !c.Last() || string(c.Key()) != "two" || string(c.Value()) != "1" {
+		t.Errorf("Last: %q=%q", c.Key(), c.Value())
+	}
+
+	// Modifications are reflected in the index, also while iterating.
+	c.Seek([]byte("one"))
+	db.Delete([]byte("seven"))
+	db.Store([]byte("pi"), []byte("3.14"), false)
+	if s := walkIndex(c, c.Next(), c.Next); s != "pi six ten three two" {
+		t.Errorf("after modification: %s", s)
+	}
+	b := db.NewBatch()
+	b.Delete([]byte("two"))
+	b.Put([]byte("a"), []byte("a"), false)
+	b.Delete([]byte("missing"))
+	b.Commit()
+	if !c.First() || string(c.Key()) != "a" || !c.Last() || string(c.Key()) != "three" {
+		t.Error("index not updated by batch")
+	}
+	if err := c.Err(); err != nil {
+		t.Error(err)
+	}
+	if err := db.CheckIndex(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIndexPersistence(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	t.Cleanup(func() { os.Remove(dbname + IndexSuffix) })
+	db := openIndexed(t, ModeWriter)
+	db.Store([]byte("eleven"), []byte("10"), false)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dbname + IndexSuffix); err != nil {
+		t.Fatal("index file not created:", err)
+	}
+
+	db = openIndexed(t, ModeReader)
+	if db.index.keys.len() != 11 || db.index.modified() {
+		t.Errorf("index not loaded from file: %d keys, modified=%v", db.index.keys.len(), db.index.modified())
+	}
+	db.Close()
+
+	// Modify the database without the index: it must be rebuilt.
+	db, err := Open(dbname, ModeWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Delete([]byte("one"))
+	db.Close()
+	db = openIndexed(t, ModeReader)
+	defer db.Close()
+	if !db.index.rewrite {
+		t.Error("stale index not rebuilt")
+	}
+	if err := db.CheckIndex(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIndexJournal(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	t.Cleanup(func() { os.Remove(dbname + IndexSuffix) })
+	db := openIndexed(t, ModeWriter)
+	if err := db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := db.index.snapshot
+
+	// Changes are appended to the journal, leaving the snapshot intact.
+	db.Store([]byte("eleven"), []byte("11"), false)
+	db.Delete([]byte("one"))
+	if err := db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if db.index.snapshot != snapshot || db.index.end <= snapshot {
+		t.Errorf("changes not journaled: snapshot %d, was %d, end %d", db.index.snapshot, snapshot, db.index.end)
+	}
+	end := db.index.end
+	db.Close()
+
+	// A torn group at the end of the journal is ignored.
+	f, err := os.OpenFile(dbname + IndexSuffix, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 1, '+'})
+	f.Close()
+
+	db = openIndexed(t, ModeWriter)
+	if db.index.modified() || db.index.end != end {
+		t.Errorf("journal not loaded: modified=%v, end %d, expected %d", db.index.modified(), db.index.end, end)
+	}
+	if err := db.CheckIndex(); err != nil {
+		t.Error(err)
+	}
+
+	// The next save overwrites the torn group.
+	db.Store([]byte("twelve"), []byte("12"), false)
+	db.Close()
+	db = openIndexed(t, ModeReader)
+	defer db.Close()
+	if db.index.modified() {
+		t.Error("index not loaded from file")
+	}
+	if err := db.CheckIndex(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIndexStaleSameSize(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	t.Cleanup(func() { os.Remove(dbname + IndexSuffix) })
+	openIndexed(t, ModeWriter).Close()
+	st, err := os.Stat(dbname)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Modify the database without the index, keeping its size and
+	// modification time.
+	db, err := Open(dbname, ModeWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Delete([]byte("one"))
+	db.Close()
+	if err := os.Chtimes(dbname, st.ModTime(), st.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if nst, err := os.Stat(dbname); err != nil || nst.Size() != st.Size() {
+		t.Skip("database size changed")
+	}
+
+	db = openIndexed(t, ModeReader)
+	defer db.Close()
+	if !db.index.rewrite {
+		t.Error("stale index not rebuilt")
+	}
+	if err := db.CheckIndex(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestKeySet(t *testing.T) {
+	s := newKeySet()
+	present := make(map[string]bool)
+	for i := 0; i < 2000; i++ {
+		key := []byte(strconv.Itoa(rand.Intn(500)))
+		if rand.Intn(3) == 0 {
+			if s.remove(key) != present[string(key)] {
+				t.Fatalf("remove(%s) returned wrong result", key)
+			}
+			delete(present, string(key))
+		} else {
+			if s.insert(key) == present[string(key)] {
+				t.Fatalf("insert(%s) returned wrong result", key)
+			}
+			present[string(key)] = true
+		}
+	}
+	var expected []string
+	for k := range present {
+		expected = append(expected, k)
+	}
+	sort.Strings(expected)
+	if s.len() != len(expected) {
+		t.Fatalf("len returned %d, expected %d", s.len(), len(expected))
+	}
+	i := 0
+	for n := s.first(); n != nil; n = n.next[0] {
+		if string(n.key) != expected[i] {
+			t.Fatalf("key %d: expected %s, got %s", i, expected[i], n.key)
+		}
+		i++
+	}
+	if n := s.last(); n == nil || string(n.key) != expected[len(expected)-1] {
+		t.Error("last returned wrong key")
+	}
+	for _, k := range expected {
+		j := sort.SearchStrings(expected, k)
+		if n := s.ceil([]byte(k)); n == nil || string(n.key) != k {
+			t.Errorf("ceil(%s) failed", k)
+		}
+		if n := s.higher([]byte(k)); (n == nil) != (j == len(expected) - 1) ||
+			(n != nil && string(n.key) != expected[j+1]) {
+			t.Errorf("higher(%s) failed", k)
+		}
+		if n := s.lower([]byte(k)); (n == nil) != (j == 0) ||
+			(n != nil && string(n.key) != expected[j-1]) {
+			t.Errorf("lower(%s) failed", k)
+		}
+	}
+}
+
+func TestIndexCheck(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	t.Cleanup(func() { os.Remove(dbname + IndexSuffix) })
+	db := openIndexed(t, ModeWriter)
+	defer db.Close()
+
+	db.index.remove([]byte("one"))
+	db.index.insert([]byte("bogus"))
+	err := db.CheckIndex()
+	var ierr *IndexError
+	if !errors.As(err, &ierr) {
+		t.Fatalf("CheckIndex returned %v", err)
+	}
+	if len(ierr.Missing) != 1 || string(ierr.Missing[0]) != "one" ||
+		len(ierr.Extra) != 1 || string(ierr.Extra[0]) != "bogus" {
+		t.Errorf("wrong result: %v", ierr)
+	}
+	if err := db.RebuildIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CheckIndex(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIndexCorrupted(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	t.Cleanup(func() { os.Remove(dbname + IndexSuffix) })
+	db := openIndexed(t, ModeWriter)
+	db.Close()
+	data, err := os.ReadFile(dbname + IndexSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(dbname + IndexSuffix, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.index.load(); !errors.Is(err, ErrBadIndex) {
+		t.Errorf("load returned %v", err)
+	}
+	db = openIndexed(t, ModeReader)
+	defer db.Close()
+	if err := db.CheckIndex(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNoIndex(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.HasIndex() {
+		t.Error("HasIndex returned true")
+	}
+	if _, err := db.IndexCursor(); err != ErrNoIndex {
+		t.Errorf("IndexCursor returned %v", err)
+	}
+	if err := db.RebuildIndex(); err != ErrNoIndex {
+		t.Errorf("RebuildIndex returned %v", err)
+	}
+}
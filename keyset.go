@@ -0,0 +1,157 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+import (
+	"bytes"
+	"math/rand"
+)
+
+// Maximum height of the keySet skip list.  With the branching factor of
+// 4, it suffices for any realistic number of keys.
+const keySetMaxLevel = 24
+
+type keySetNode struct {
+	key []byte
+	next []*keySetNode
+	// Successors at each level of the list.
+}
+
+// Ordered set of keys, implemented as a skip list.  Insertion, removal
+// and lookup take logarithmic time on average.
+type keySet struct {
+	head keySetNode
+	// Sentinel node preceding the first key.
+	level int
+	// Number of levels in use.
+	count int
+	// Number of keys.
+}
+
+func newKeySet() *keySet {
+	return &keySet{
+		head: keySetNode{next: make([]*keySetNode, keySetMaxLevel)},
+		level: 1,
+	}
+}
+
+// Number of keys in the set.
+func (s *keySet) len() int {
+	return s.count
+}
+
+// Find the last node with the key less than key at each level and
+// store it in update, unless it is nil.  Returns the node found at the
+// bottom level (the head, if all keys are greater or equal).
+func (s *keySet) search(key []byte, update []*keySetNode) *keySetNode {
+	x := &s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && bytes.Compare(x.next[i].key, key) < 0 {
+			x = x.next[i]
+		}
+		if update != nil {
+			update[i] = x
+		}
+	}
+	return x
+}
+
+// Add key to the set.  The set retains the slice.  Returns false if the
+// key is already there.
+func (s *keySet) insert(key []byte) bool {
+	var update [keySetMaxLevel]*keySetNode
+	x := s.search(key, update[:]).next[0]
+	if x != nil && bytes.Equal(x.key, key) {
+		return false
+	}
+	level := 1
+	for level < keySetMaxLevel && rand.Uint32() & 3 == 0 {
+		level++
+	}
+	for ; s.level < level; s.level++ {
+		update[s.level] = &s.head
+	}
+	n := &keySetNode{key: key, next: make([]*keySetNode, level)}
+	for i := 0; i < level; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+	s.count++
+	return true
+}
+
+// Remove key from the set.  Returns false if the key is not there.
+func (s *keySet) remove(key []byte) bool {
+	var update [keySetMaxLevel]*keySetNode
+	x := s.search(key, update[:]).next[0]
+	if x == nil || !bytes.Equal(x.key, key) {
+		return false
+	}
+	for i := range x.next {
+		update[i].next[i] = x.next[i]
+	}
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+	s.count--
+	return true
+}
+
+// Return the node with the smallest key, or nil if the set is empty.
+func (s *keySet) first() *keySetNode {
+	return s.head.next[0]
+}
+
+// Return the node with the largest key, or nil if the set is empty.
+func (s *keySet) last() *keySetNode {
+	x := &s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil {
+			x = x.next[i]
+		}
+	}
+	if x == &s.head {
+		return nil
+	}
+	return x
+}
+
+// Return the node with the smallest key greater than or equal to key,
+// or nil if there is none.
+func (s *keySet) ceil(key []byte) *keySetNode {
+	return s.search(key, nil).next[0]
+}
+
+// Return the node with the smallest key greater than key, or nil if
+// there is none.
+func (s *keySet) higher(key []byte) *keySetNode {
+	x := s.ceil(key)
+	if x != nil && bytes.Equal(x.key, key) {
+		x = x.next[0]
+	}
+	return x
+}
+
+// Return the node with the largest key less than key, or nil if there
+// is none.
+func (s *keySet) lower(key []byte) *keySetNode {
+	x := s.search(key, nil)
+	if x == &s.head {
+		return nil
+	}
+	return x
+}
@@ -0,0 +1,47 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+// KV is the basic key/value store interface implemented by Database.
+// Code depending on KV instead of *Database can be used with other
+// implementations, such as the in-memory store from the memkv package.
+//
+// Implementations must follow the error semantics of Database:
+//
+//   - Fetch and Delete return ErrItemNotFound for missing keys.
+//   - Fetch returns an empty, non-nil slice for empty values.
+//   - Store with replace set to false returns ErrCannotReplace if the
+//     key exists.
+//   - In read-only mode, Store returns ErrReaderCantStore and Delete
+//     returns ErrReaderCantDelete.
+//   - After Close, all methods return ErrNotOpen, and Exists returns
+//     false.
+//   - The iterator returns ErrItemNotFound after the last key.
+//
+// The kvtest package provides tests checking these requirements.
+type KV interface {
+	Fetch(key []byte) ([]byte, error)
+	Store(key []byte, value []byte, replace bool) error
+	Delete(key []byte) error
+	Exists(key []byte) bool
+	Count() (uint, error)
+	Iterator() DatabaseIterator
+	Sync() error
+	Close() error
+}
+
+var _ KV = (*Database)(nil)
@@ -0,0 +1,17 @@
+package gdbm_test
+
+import (
+	"testing"
+	"github.com/graygnuorg/go-gdbm"
+	"github.com/graygnuorg/go-gdbm/kvtest"
+)
+
+func TestKVConformance(t *testing.T) {
+	kvtest.Run(t, func(t *testing.T, records map[string]string, readOnly bool) gdbm.KV {
+		mode := gdbm.ModeNewdb
+		if readOnly {
+			mode = gdbm.ModeReader
+		}
+		return kvtest.OpenDatabase(t, records, mode)
+	})
+}
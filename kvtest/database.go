@@ -0,0 +1,62 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+
+package kvtest
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+	"github.com/graygnuorg/go-gdbm"
+)
+
+// OpenDatabase creates a GDBM database in a temporary directory, stores
+// the records in it and returns it open in the given mode.  Unless mode
+// is gdbm.ModeNewdb, the database is closed and reopened.  It is closed
+// again when the test finishes.
+func OpenDatabase(t *testing.T, records map[string]string, mode int) *gdbm.Database {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "junk.gdbm")
+	db, err := gdbm.Open(name, gdbm.ModeNewdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range records {
+		if err := db.Store([]byte(k), []byte(v), false); err != nil {
+			db.Close()
+			t.Fatal(err)
+		}
+	}
+	if mode != gdbm.ModeNewdb {
+		db.Close()
+		if db, err = gdbm.Open(name, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// Numbered returns n records with keys "key0", "key1", ... and values
+// "0", "1", and so on.
+func Numbered(n int) map[string]string {
+	records := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		records["key" + strconv.Itoa(i)] = strconv.Itoa(i)
+	}
+	return records
+}
@@ -0,0 +1,283 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+// Package kvtest implements conformance tests for gdbm.KV
+// implementations, and fixtures for tests of code using gdbm.Database.
+//
+// Example:
+//
+//	func TestConformance(t *testing.T) {
+//		kvtest.Run(t, func(t *testing.T, records map[string]string, readOnly bool) gdbm.KV {
+//			db := mystore.New()
+//			for k, v := range records {
+//				db.Store([]byte(k), []byte(v), true)
+//			}
+//			if readOnly {
+//				db.SetReadOnly(true)
+//			}
+//			return db
+//		})
+//	}
+package kvtest
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"github.com/graygnuorg/go-gdbm"
+)
+
+// Opener returns a new store containing the given records.  If readOnly
+// is true, the store must refuse modifications.  Run closes the returned
+// store, so the opener should not do it, but may register other cleanup
+// functions with t.Cleanup.
+type Opener func(t *testing.T, records map[string]string, readOnly bool) gdbm.KV
+
+// Records the tests start with.
+var records = map[string]string{
+	"one": "1",
+	"two": "2",
+	"three": "3",
+	"four": "4",
+	"five": "5",
+	"empty": "",
+}
+
+// Run runs the conformance tests as subtests of t.
+func Run(t *testing.T, open Opener) {
+	tests := []struct {
+		name string
+		readOnly bool
+		fn func(*testing.T, gdbm.KV)
+	}{
+		{"Fetch", false, testFetch},
+		{"Store", false, testStore},
+		{"Delete", false, testDelete},
+		{"Exists", false, testExists},
+		{"Count", false, testCount},
+		{"Iterator", false, testIterator},
+		{"Sync", false, testSync},
+		{"ReadOnly", true, testReadOnly},
+		{"Closed", false, testClosed},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db := open(t, records, tc.readOnly)
+			defer db.Close()
+			tc.fn(t, db)
+		})
+	}
+}
+
+func expectError(t *testing.T, op string, err, expected error) {
+	t.Helper()
+	if !errors.Is(err, expected) {
+		t.Errorf("%s: expected %v, got %v", op, expected, err)
+	}
+}
+
+func expectValue(t *testing.T, db gdbm.KV, key, expected string) {
+	t.Helper()
+	value, err := db.Fetch([]byte(key))
+	if err != nil {
+		t.Errorf("Fetch(%q): %v", key, err)
+	} else if string(value) != expected {
+		t.Errorf("Fetch(%q): expected %q, got %q", key, expected, value)
+	}
+}
+
+func testFetch(t *testing.T, db gdbm.KV) {
+	for k, v := range records {
+		expectValue(t, db, k, v)
+	}
+	value, err := db.Fetch([]byte("empty"))
+	if err == nil && value == nil {
+		t.Error("Fetch returned nil for empty value")
+	}
+	_, err = db.Fetch([]byte("missing"))
+	expectError(t, "Fetch of missing key", err, gdbm.ErrItemNotFound)
+
+	// Modifying the returned value must not affect the store.
+	value, _ = db.Fetch([]byte("one"))
+	if len(value) > 0 {
+		value[0] = 'x'
+	}
+	expectValue(t, db, "one", "1")
+}
+
+func testStore(t *testing.T, db gdbm.KV) {
+	err := db.Store([]byte("one"), []byte("uno"), false)
+	expectError(t, "Store without replace", err, gdbm.ErrCannotReplace)
+	expectValue(t, db, "one", "1")
+
+	if err = db.Store([]byte("one"), []byte("uno"), true); err != nil {
+		t.Errorf("Store with replace: %v", err)
+	}
+	expectValue(t, db, "one", "uno")
+
+	value := []byte("6")
+	if err = db.Store([]byte("six"), value, false); err != nil {
+		t.Errorf("Store of new key: %v", err)
+	}
+	// The store must not retain the value.
+	value[0] = 'x'
+	expectValue(t, db, "six", "6")
+
+	if err = db.Store([]byte("seven"), nil, false); err != nil {
+		t.Errorf("Store of nil value: %v", err)
+	}
+	expectValue(t, db, "seven", "")
+}
+
+func testDelete(t *testing.T, db gdbm.KV) {
+	if err := db.Delete([]byte("two")); err != nil {
+		t.Errorf("Delete: %v", err)
+	}
+	_, err := db.Fetch([]byte("two"))
+	expectError(t, "Fetch of deleted key", err, gdbm.ErrItemNotFound)
+	err = db.Delete([]byte("two"))
+	expectError(t, "Delete of deleted key", err, gdbm.ErrItemNotFound)
+	err = db.Delete([]byte("missing"))
+	expectError(t, "Delete of missing key", err, gdbm.ErrItemNotFound)
+}
+
+func testExists(t *testing.T, db gdbm.KV) {
+	for k := range records {
+		if !db.Exists([]byte(k)) {
+			t.Errorf("Exists(%q) returned false", k)
+		}
+	}
+	if db.Exists([]byte("missing")) {
+		t.Error("Exists returned true for missing key")
+	}
+}
+
+func testCount(t *testing.T, db gdbm.KV) {
+	expectCount := func(expected int) {
+		t.Helper()
+		n, err := db.Count()
+		if err != nil {
+			t.Errorf("Count: %v", err)
+		} else if n != uint(expected) {
+			t.Errorf("Count: expected %d, got %d", expected, n)
+		}
+	}
+	expectCount(len(records))
+	db.Store([]byte("six"), []byte("6"), true)
+	expectCount(len(records) + 1)
+	db.Delete([]byte("one"))
+	expectCount(len(records))
+}
+
+func testIterator(t *testing.T, db gdbm.KV) {
+	var keys []string
+	next := db.Iterator()
+	var err error
+	var key []byte
+	for key, err = next(); err == nil; key, err = next() {
+		keys = append(keys, string(key))
+	}
+	expectError(t, "end of iteration", err, gdbm.ErrItemNotFound)
+	_, err = next()
+	expectError(t, "exhausted iterator", err, gdbm.ErrItemNotFound)
+
+	var expected []string
+	for k := range records {
+		expected = append(expected, k)
+	}
+	sort.Strings(keys)
+	sort.Strings(expected)
+	if len(keys) != len(expected) {
+		t.Fatalf("iterator returned %v, expected %v", keys, expected)
+	}
+	for i := range keys {
+		if keys[i] != expected[i] {
+			t.Fatalf("iterator returned %v, expected %v", keys, expected)
+		}
+	}
+
+	if db.Delete([]byte("one")) != nil || db.Delete([]byte("two")) != nil {
+		t.Fatal("Delete failed")
+	}
+	next = db.Iterator()
+	n := 0
+	for _, err = next(); err == nil; _, err = next() {
+		n++
+	}
+	if n != len(records) - 2 {
+		t.Errorf("iterator returned %d keys after deletion, expected %d", n, len(records) - 2)
+	}
+
+	db.Close()
+	_, err = db.Iterator()()
+	expectError(t, "iterator over closed store", err, gdbm.ErrNotOpen)
+}
+
+func testSync(t *testing.T, db gdbm.KV) {
+	db.Store([]byte("six"), []byte("6"), true)
+	if err := db.Sync(); err != nil {
+		t.Errorf("Sync: %v", err)
+	}
+	expectValue(t, db, "six", "6")
+}
+
+func testReadOnly(t *testing.T, db gdbm.KV) {
+	for k, v := range records {
+		expectValue(t, db, k, v)
+	}
+	err := db.Store([]byte("six"), []byte("6"), true)
+	expectError(t, "Store of new key", err, gdbm.ErrReaderCantStore)
+	err = db.Store([]byte("one"), []byte("uno"), true)
+	expectError(t, "Store with replace", err, gdbm.ErrReaderCantStore)
+	err = db.Store([]byte("one"), []byte("uno"), false)
+	expectError(t, "Store without replace", err, gdbm.ErrReaderCantStore)
+	err = db.Delete([]byte("one"))
+	expectError(t, "Delete", err, gdbm.ErrReaderCantDelete)
+	err = db.Delete([]byte("missing"))
+	expectError(t, "Delete of missing key", err, gdbm.ErrReaderCantDelete)
+
+	expectValue(t, db, "one", "1")
+	if db.Exists([]byte("six")) {
+		t.Error("Store modified a read-only store")
+	}
+	if n, err := db.Count(); err != nil || n != uint(len(records)) {
+		t.Errorf("Count returned %d, %v", n, err)
+	}
+}
+
+func testClosed(t *testing.T, db gdbm.KV) {
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	_, err := db.Fetch([]byte("one"))
+	expectError(t, "Fetch", err, gdbm.ErrNotOpen)
+	err = db.Store([]byte("one"), []byte("1"), true)
+	expectError(t, "Store", err, gdbm.ErrNotOpen)
+	err = db.Delete([]byte("one"))
+	expectError(t, "Delete", err, gdbm.ErrNotOpen)
+	if db.Exists([]byte("one")) {
+		t.Error("Exists returned true")
+	}
+	_, err = db.Count()
+	expectError(t, "Count", err, gdbm.ErrNotOpen)
+	_, err = db.Iterator()()
+	expectError(t, "Iterator", err, gdbm.ErrNotOpen)
+	err = db.Sync()
+	expectError(t, "Sync", err, gdbm.ErrNotOpen)
+	err = db.Close()
+	expectError(t, "second Close", err, gdbm.ErrNotOpen)
+}
@@ -0,0 +1,179 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+// Package memkv provides an in-memory implementation of gdbm.KV.  It
+// returns the same errors as gdbm.Database, which makes it suitable for
+// replacing databases in unit tests.
+//
+// Example:
+//
+//	db := memkv.New()
+//	db.Store([]byte("key"), []byte("value"), false)
+//	db.SetReadOnly(true)
+//	process(db)		// process accepts gdbm.KV
+package memkv
+
+import (
+	"sync"
+	"github.com/graygnuorg/go-gdbm"
+)
+
+// DB is an in-memory key/value store.  It is safe for concurrent use.
+type DB struct {
+	sync sync.RWMutex
+	data map[string][]byte
+	// Stored records; nil if the store is closed.
+	readOnly bool
+}
+
+var _ gdbm.KV = (*DB)(nil)
+
+// New returns an empty store, open for reading and writing.
+func New() *DB {
+	return &DB{data: make(map[string][]byte)}
+}
+
+// SetReadOnly switches the store to or from read-only mode.  In
+// read-only mode, Store and Delete fail, as they do for databases open
+// with gdbm.ModeReader.
+func (db *DB) SetReadOnly(readOnly bool) {
+	db.sync.Lock()
+	db.readOnly = readOnly
+	db.sync.Unlock()
+}
+
+// Fetch returns the value of the key.
+func (db *DB) Fetch(key []byte) ([]byte, error) {
+	db.sync.RLock()
+	defer db.sync.RUnlock()
+	if db.data == nil {
+		return nil, gdbm.ErrNotOpen
+	}
+	value, ok := db.data[string(key)]
+	if !ok {
+		return []byte{}, gdbm.ErrItemNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+// Store the value under the key.  If replace is false and the key exists,
+// ErrCannotReplace is returned.
+func (db *DB) Store(key []byte, value []byte, replace bool) error {
+	db.sync.Lock()
+	defer db.sync.Unlock()
+	if db.data == nil {
+		return gdbm.ErrNotOpen
+	}
+	if db.readOnly {
+		return gdbm.ErrReaderCantStore
+	}
+	if _, ok := db.data[string(key)]; ok && !replace {
+		return gdbm.ErrCannotReplace
+	}
+	db.data[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+// Delete the key.
+func (db *DB) Delete(key []byte) error {
+	db.sync.Lock()
+	defer db.sync.Unlock()
+	if db.data == nil {
+		return gdbm.ErrNotOpen
+	}
+	if db.readOnly {
+		return gdbm.ErrReaderCantDelete
+	}
+	if _, ok := db.data[string(key)]; !ok {
+		return gdbm.ErrItemNotFound
+	}
+	delete(db.data, string(key))
+	return nil
+}
+
+// Exists returns true if the key exists.
+func (db *DB) Exists(key []byte) bool {
+	db.sync.RLock()
+	defer db.sync.RUnlock()
+	_, ok := db.data[string(key)]
+	return ok
+}
+
+// Count returns the number of keys.
+func (db *DB) Count() (uint, error) {
+	db.sync.RLock()
+	defer db.sync.RUnlock()
+	if db.data == nil {
+		return 0, gdbm.ErrNotOpen
+	}
+	return uint(len(db.data)), nil
+}
+
+// Iterator returns an iterator over all keys, in unspecified order.  The
+// set of keys is taken on the first call.  Keys deleted after that are
+// skipped, and keys added are not visited.
+func (db *DB) Iterator() gdbm.DatabaseIterator {
+	var keys []string
+	var started bool
+	var err error
+	return func() ([]byte, error) {
+		db.sync.RLock()
+		defer db.sync.RUnlock()
+		if db.data == nil {
+			err = gdbm.ErrNotOpen
+		}
+		if err != nil {
+			return []byte{}, err
+		}
+		if !started {
+			started = true
+			keys = make([]string, 0, len(db.data))
+			for k := range db.data {
+				keys = append(keys, k)
+			}
+		}
+		for len(keys) > 0 {
+			k := keys[0]
+			keys = keys[1:]
+			if _, ok := db.data[k]; ok {
+				return []byte(k), nil
+			}
+		}
+		err = gdbm.ErrItemNotFound
+		return []byte{}, err
+	}
+}
+
+// Sync does nothing, except returning ErrNotOpen if the store is closed.
+func (db *DB) Sync() error {
+	db.sync.RLock()
+	defer db.sync.RUnlock()
+	if db.data == nil {
+		return gdbm.ErrNotOpen
+	}
+	return nil
+}
+
+// Close the store and discard its contents.
+func (db *DB) Close() error {
+	db.sync.Lock()
+	defer db.sync.Unlock()
+	if db.data == nil {
+		return gdbm.ErrNotOpen
+	}
+	db.data = nil
+	return nil
+}
@@ -0,0 +1,20 @@
+package memkv
+
+import (
+	"testing"
+	"github.com/graygnuorg/go-gdbm"
+	"github.com/graygnuorg/go-gdbm/kvtest"
+)
+
+func TestConformance(t *testing.T) {
+	kvtest.Run(t, func(t *testing.T, records map[string]string, readOnly bool) gdbm.KV {
+		db := New()
+		for k, v := range records {
+			if err := db.Store([]byte(k), []byte(v), false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		db.SetReadOnly(readOnly)
+		return db
+	})
+}
@@ -0,0 +1,432 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+/*
+#include <stdlib.h>
+#include <gdbm.h>
+
+// Placeholder for gdbm_setopt options that are not defined in a
+// particular GDBM version.
+#define GO_GDBM_OPT_UNDEFINED -1
+
+#ifndef GDBM_SETCACHESIZE
+# define GDBM_SETCACHESIZE GO_GDBM_OPT_UNDEFINED
+#endif
+#ifndef GDBM_GETCACHESIZE
+# define GDBM_GETCACHESIZE GO_GDBM_OPT_UNDEFINED
+#endif
+#ifndef GDBM_SETSYNCMODE
+# define GDBM_SETSYNCMODE GO_GDBM_OPT_UNDEFINED
+#endif
+#ifndef GDBM_GETSYNCMODE
+# define GDBM_GETSYNCMODE GO_GDBM_OPT_UNDEFINED
+#endif
+#ifndef GDBM_SETCENTFREE
+# define GDBM_SETCENTFREE GO_GDBM_OPT_UNDEFINED
+#endif
+#ifndef GDBM_GETCENTFREE
+# define GDBM_GETCENTFREE GO_GDBM_OPT_UNDEFINED
+#endif
+#ifndef GDBM_SETCOALESCEBLKS
+# define GDBM_SETCOALESCEBLKS GO_GDBM_OPT_UNDEFINED
+#endif
+#ifndef GDBM_GETCOALESCEBLKS
+# define GDBM_GETCOALESCEBLKS GO_GDBM_OPT_UNDEFINED
+#endif
+#ifndef GDBM_SETMAXMAPSIZE
+# define GDBM_SETMAXMAPSIZE GO_GDBM_OPT_UNDEFINED
+#endif
+#ifndef GDBM_GETMAXMAPSIZE
+# define GDBM_GETMAXMAPSIZE GO_GDBM_OPT_UNDEFINED
+#endif
+#ifndef GDBM_SETMMAP
+# define GDBM_SETMMAP GO_GDBM_OPT_UNDEFINED
+#endif
+#ifndef GDBM_GETMMAP
+# define GDBM_GETMMAP GO_GDBM_OPT_UNDEFINED
+#endif
+#ifndef GDBM_GETFLAGS
+# define GDBM_GETFLAGS GO_GDBM_OPT_UNDEFINED
+#endif
+#ifndef GDBM_GETBLOCKSIZE
+# define GDBM_GETBLOCKSIZE GO_GDBM_OPT_UNDEFINED
+#endif
+
+// Options of type int.
+static inline int setopt_int(GDBM_FILE db, int opt, int val)
+{
+    return gdbm_setopt(db, opt, &val, sizeof(val));
+}
+
+static inline int getopt_int(GDBM_FILE db, int opt, int *val)
+{
+    return gdbm_setopt(db, opt, val, sizeof(*val));
+}
+
+// Options of type size_t.
+static inline int setopt_size(GDBM_FILE db, int opt, size_t val)
+{
+    return gdbm_setopt(db, opt, &val, sizeof(val));
+}
+
+static inline int getopt_size(GDBM_FILE db, int opt, size_t *val)
+{
+    return gdbm_setopt(db, opt, val, sizeof(*val));
+}
+
+// Bucket cache statistics appeared in GDBM 1.20.
+static inline int get_cache_stats(GDBM_FILE db, size_t *access_count,
+				  size_t *cache_hits, size_t *cache_count)
+{
+#if GDBM_VERSION_MAJOR > 1 || GDBM_VERSION_MINOR >= 20
+    gdbm_get_cache_stats(db, access_count, cache_hits, cache_count, NULL, 0);
+    return 0;
+#else
+    return -1;
+#endif
+}
+*/
+import "C"
+
+func optDefined(opt C.int) bool {
+	return opt != C.GO_GDBM_OPT_UNDEFINED
+}
+
+func (db *Database) setIntOption(opt C.int, val int) error {
+	db.sync.Lock()
+	defer db.sync.Unlock()
+	if db.dbf == nil {
+		return ErrNotOpen
+	}
+	if !optDefined(opt) {
+		return ErrNotImplemented
+	}
+	if C.setopt_int(db.dbf, opt, C.int(val)) != 0 {
+		return db.lastError()
+	}
+	return nil
+}
+
+func (db *Database) getIntOption(opt C.int) (int, error) {
+	db.sync.RLock()
+	defer db.sync.RUnlock()
+	if db.dbf == nil {
+		return 0, ErrNotOpen
+	}
+	if !optDefined(opt) {
+		return 0, ErrNotImplemented
+	}
+	var val C.int
+	if C.getopt_int(db.dbf, opt, &val) != 0 {
+		return 0, db.lastError()
+	}
+	return int(val), nil
+}
+
+func (db *Database) setSizeOption(opt C.int, val uint64) error {
+	db.sync.Lock()
+	defer db.sync.Unlock()
+	if db.dbf == nil {
+		return ErrNotOpen
+	}
+	if !optDefined(opt) {
+		return ErrNotImplemented
+	}
+	if C.setopt_size(db.dbf, opt, C.size_t(val)) != 0 {
+		return db.lastError()
+	}
+	return nil
+}
+
+func (db *Database) getSizeOption(opt C.int) (uint64, error) {
+	db.sync.RLock()
+	defer db.sync.RUnlock()
+	if db.dbf == nil {
+		return 0, ErrNotOpen
+	}
+	if !optDefined(opt) {
+		return 0, ErrNotImplemented
+	}
+	var val C.size_t
+	if C.getopt_size(db.dbf, opt, &val) != 0 {
+		return 0, db.lastError()
+	}
+	return uint64(val), nil
+}
+
+func (db *Database) setBoolOption(opt C.int, val bool) error {
+	n := 0
+	if val {
+		n = 1
+	}
+	return db.setIntOption(opt, n)
+}
+
+func (db *Database) getBoolOption(opt C.int) (bool, error) {
+	n, err := db.getIntOption(opt)
+	return n != 0, err
+}
+
+// Set the size of the bucket cache (number of buckets).
+func (db *Database) SetCacheSize(n uint) error {
+	return db.setSizeOption(C.GDBM_SETCACHESIZE, uint64(n))
+}
+
+// Return the size of the bucket cache.
+func (db *Database) CacheSize() (uint, error) {
+	n, err := db.getSizeOption(C.GDBM_GETCACHESIZE)
+	return uint(n), err
+}
+
+// Turn automatic synchronization on or off.  When on, the database is
+// synchronized with its disk file after each modification.
+func (db *Database) SetSyncMode(on bool) error {
+	return db.setBoolOption(C.GDBM_SETSYNCMODE, on)
+}
+
+// Return true if automatic synchronization is on.
+func (db *Database) SyncMode() (bool, error) {
+	return db.getBoolOption(C.GDBM_GETSYNCMODE)
+}
+
+// Return true if automatic synchronization is on.  If it can't be told,
+// return false.  The caller must hold the database lock.
+func (db *Database) syncMode() (bool, error) {
+	if !optDefined(C.GDBM_GETSYNCMODE) || !optDefined(C.GDBM_SETSYNCMODE) {
+		return false, nil
+	}
+	var n C.int
+	if C.getopt_int(db.dbf, C.GDBM_GETSYNCMODE, &n) != 0 {
+		return false, db.lastError()
+	}
+	return n != 0, nil
+}
+
+// Turn automatic synchronization off, if it is on.  Returns true if it
+// was on.  The caller must hold the database lock.
+func (db *Database) suspendSyncMode() (bool, error) {
+	if on, err := db.syncMode(); !on {
+		return false, err
+	}
+	if C.setopt_int(db.dbf, C.GDBM_SETSYNCMODE, 0) != 0 {
+		return false, db.lastError()
+	}
+	return true, nil
+}
+
+// Turn automatic synchronization back on after suspendSyncMode.  The
+// caller must hold the database lock.
+func (db *Database) resumeSyncMode() error {
+	if C.setopt_int(db.dbf, C.GDBM_SETSYNCMODE, 1) != 0 {
+		return db.lastError()
+	}
+	return nil
+}
+
+// Enable or disable central free block pool.  When enabled, blocks freed
+// by deletions are returned to the global pool, instead of being kept in
+// the bucket they belonged to.
+func (db *Database) SetCentFree(on bool) error {
+	return db.setBoolOption(C.GDBM_SETCENTFREE, on)
+}
+
+// Return true if central free block pool is enabled.
+func (db *Database) CentFree() (bool, error) {
+	return db.getBoolOption(C.GDBM_GETCENTFREE)
+}
+
+// Enable or disable merging of adjacent free blocks.
+func (db *Database) SetCoalesceBlocks(on bool) error {
+	return db.setBoolOption(C.GDBM_SETCOALESCEBLKS, on)
+}
+
+// Return true if merging of adjacent free blocks is enabled.
+func (db *Database) CoalesceBlocks() (bool, error) {
+	return db.getBoolOption(C.GDBM_GETCOALESCEBLKS)
+}
+
+// Set the maximum size (in bytes) of the memory mapped region.
+func (db *Database) SetMaxMapSize(size uint64) error {
+	return db.setSizeOption(C.GDBM_SETMAXMAPSIZE, size)
+}
+
+// Return the maximum size of the memory mapped region.
+func (db *Database) MaxMapSize() (uint64, error) {
+	return db.getSizeOption(C.GDBM_GETMAXMAPSIZE)
+}
+
+// Enable or disable memory mapping of the database file.
+func (db *Database) SetMmap(on bool) error {
+	return db.setBoolOption(C.GDBM_SETMMAP, on)
+}
+
+// Return true if the database file is memory mapped.
+func (db *Database) Mmap() (bool, error) {
+	return db.getBoolOption(C.GDBM_GETMMAP)
+}
+
+// Return the block size of the database.
+func (db *Database) BlockSize() (int, error) {
+	return db.getIntOption(C.GDBM_GETBLOCKSIZE)
+}
+
+// Return the flags the database was opened with: the open mode (ModeReader,
+// ModeWriter, etc) ORed with OF_ flags.
+func (db *Database) Flags() (int, error) {
+	return db.getIntOption(C.GDBM_GETFLAGS)
+}
+
+// CacheStats describes the usage of the bucket cache.
+type CacheStats struct {
+	Accesses uint
+	// Total number of bucket accesses.
+	Hits uint
+	// Number of accesses satisfied from the cache.
+	Buckets uint
+	// Number of buckets currently in cache.
+}
+
+// Return bucket cache usage statistics.
+func (db *Database) CacheStats() (stat *CacheStats, err error) {
+	db.sync.RLock()
+	defer db.sync.RUnlock()
+	if db.dbf == nil {
+		err = ErrNotOpen
+		return
+	}
+
+	var accesses, hits, count C.size_t
+	if C.get_cache_stats(db.dbf, &accesses, &hits, &count) != 0 {
+		err = ErrNotImplemented
+		return
+	}
+	stat = &CacheStats{
+		Accesses: uint(accesses),
+		Hits: uint(hits),
+		Buckets: uint(count),
+	}
+	return
+}
+
+// Values of the Mmap field of DatabaseConfig.
+const (
+	MmapDefault = iota
+	// Leave memory mapping as set by the OF_NOMMAP flag.
+	MmapOn
+	// Enable memory mapping.
+	MmapOff
+	// Disable memory mapping.
+)
+
+// Apply tuning options from cfg to the freshly opened database.
+func (db *Database) configure(cfg DatabaseConfig) (err error) {
+	if cfg.CacheSize > 0 {
+		if err = db.SetCacheSize(cfg.CacheSize); err != nil {
+			return
+		}
+	}
+	if cfg.SyncMode {
+		if err = db.SetSyncMode(true); err != nil {
+			return
+		}
+	}
+	if cfg.CentFree {
+		if err = db.SetCentFree(true); err != nil {
+			return
+		}
+	}
+	if cfg.CoalesceBlocks {
+		if err = db.SetCoalesceBlocks(true); err != nil {
+			return
+		}
+	}
+	if cfg.MaxMapSize > 0 {
+		if err = db.SetMaxMapSize(cfg.MaxMapSize); err != nil {
+			return
+		}
+	}
+	switch cfg.Mmap {
+	case MmapOn:
+		err = db.SetMmap(true)
+	case MmapOff:
+		err = db.SetMmap(false)
+	}
+	return
+}
+
+// Options preserved when the database file is reopened.
+var preservedOptions = []struct {
+	get, set C.int
+	size bool
+	// True if the option value is of type size_t.
+}{
+	{C.GDBM_GETCACHESIZE, C.GDBM_SETCACHESIZE, true},
+	{C.GDBM_GETSYNCMODE, C.GDBM_SETSYNCMODE, false},
+	{C.GDBM_GETCENTFREE, C.GDBM_SETCENTFREE, false},
+	{C.GDBM_GETCOALESCEBLKS, C.GDBM_SETCOALESCEBLKS, false},
+	{C.GDBM_GETMAXMAPSIZE, C.GDBM_SETMAXMAPSIZE, true},
+	{C.GDBM_GETMMAP, C.GDBM_SETMMAP, false},
+}
+
+// Saved option value.
+type savedOption struct {
+	set C.int
+	size bool
+	val C.size_t
+}
+
+// Return the current values of the preserved options.  The caller must
+// hold the database lock.
+func (db *Database) saveOptions() (opts []savedOption) {
+	for _, o := range preservedOptions {
+		if !optDefined(o.get) || !optDefined(o.set) {
+			continue
+		}
+		so := savedOption{set: o.set, size: o.size}
+		if o.size {
+			if C.getopt_size(db.dbf, o.get, &so.val) != 0 {
+				continue
+			}
+		} else {
+			var n C.int
+			if C.getopt_int(db.dbf, o.get, &n) != 0 {
+				continue
+			}
+			so.val = C.size_t(n)
+		}
+		opts = append(opts, so)
+	}
+	return
+}
+
+// Apply options saved by saveOptions.  The caller must hold the database
+// lock.
+func (db *Database) restoreOptions(opts []savedOption) error {
+	for _, o := range opts {
+		var res C.int
+		if o.size {
+			res = C.setopt_size(db.dbf, o.set, o.val)
+		} else {
+			res = C.setopt_int(db.dbf, o.set, C.int(o.val))
+		}
+		if res != 0 {
+			return db.lastError()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package gdbm
+
+import (
+	"testing"
+	"errors"
+	"os"
+)
+
+func TestOptions(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+
+	db, err := Open(dbname, ModeWriter)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	err = db.SetSyncMode(true)
+	if errors.Is(err, ErrNotImplemented) {
+		return
+	}
+	if err != nil {
+		t.Fatal("SetSyncMode: ", err)
+	}
+	if on, err := db.SyncMode(); err != nil || !on {
+		t.Error("SyncMode: ", on, err)
+	}
+
+	if err = db.SetCoalesceBlocks(true); err != nil {
+		t.Fatal("SetCoalesceBlocks: ", err)
+	}
+	if on, err := db.CoalesceBlocks(); err != nil || !on {
+		t.Error("CoalesceBlocks: ", on, err)
+	}
+
+	// Some GDBM versions don't report the actual centfree state,
+	// so check only that the calls succeed.
+	if err = db.SetCentFree(true); err != nil {
+		t.Fatal("SetCentFree: ", err)
+	}
+	if _, err := db.CentFree(); err != nil {
+		t.Error("CentFree: ", err)
+	}
+
+	if err = db.SetMmap(false); err != nil {
+		t.Fatal("SetMmap: ", err)
+	}
+	if on, err := db.Mmap(); err != nil || on {
+		t.Error("Mmap: ", on, err)
+	}
+
+	if bs, err := db.BlockSize(); err != nil || bs <= 0 {
+		t.Error("BlockSize: ", bs, err)
+	}
+
+	if flags, err := db.Flags(); err != nil {
+		t.Error("Flags: ", err)
+	} else if flags & 0x7 != ModeWriter {
+		t.Errorf("Flags: unexpected open mode in %#x", flags)
+	}
+
+	// Make sure the database is still usable.
+	check_keys(db, t)
+}
+
+func TestConfigOptions(t *testing.T) {
+	t.Cleanup(func() {
+		os.Remove(dbname)
+	})
+
+	db, err := OpenConfig(DatabaseConfig{FileName: dbname,
+				Mode: ModeNewdb,
+				FileMode: 0600,
+				CacheSize: 32,
+				SyncMode: true,
+				CoalesceBlocks: true})
+	if err != nil {
+		if errors.Is(err, ErrNotImplemented) {
+			return
+		}
+		t.Fatal("Can't create the database:", err)
+	}
+	defer db.Close()
+
+	if n, err := db.CacheSize(); err != nil {
+		if !errors.Is(err, ErrNotImplemented) {
+			t.Error("CacheSize: ", err)
+		}
+	} else if n != 32 {
+		t.Error("CacheSize: expected 32, got ", n)
+	}
+	if on, err := db.SyncMode(); err != nil || !on {
+		t.Error("SyncMode: ", on, err)
+	}
+	if on, err := db.CoalesceBlocks(); err != nil || !on {
+		t.Error("CoalesceBlocks: ", on, err)
+	}
+
+	if err = db.Store([]byte("key"), []byte("value"), false); err != nil {
+		t.Fatal("Store: ", err)
+	}
+	if _, err = db.Fetch([]byte("key")); err != nil {
+		t.Fatal("Fetch: ", err)
+	}
+
+	stat, err := db.CacheStats()
+	if err != nil {
+		if !errors.Is(err, ErrNotImplemented) {
+			t.Error("CacheStats: ", err)
+		}
+	} else if stat.Accesses == 0 || stat.Buckets == 0 {
+		t.Errorf("CacheStats: unexpected values: %+v", *stat)
+	}
+}
+
+func TestConfigMmap(t *testing.T) {
+	t.Cleanup(func() {
+		os.Remove(dbname)
+	})
+
+	for _, tc := range []struct {
+		flags int
+		mmap int
+		expect bool
+	}{
+		{OF_NOMMAP, MmapOn, true},
+		{0, MmapOff, false},
+		{OF_NOMMAP, MmapDefault, false},
+	} {
+		db, err := OpenConfig(DatabaseConfig{FileName: dbname,
+					Mode: ModeNewdb,
+					Flags: tc.flags,
+					FileMode: 0600,
+					Mmap: tc.mmap})
+		if err != nil {
+			if errors.Is(err, ErrNotImplemented) {
+				return
+			}
+			t.Fatal("Can't create the database:", err)
+		}
+		on, err := db.Mmap()
+		db.Close()
+		if err != nil {
+			if errors.Is(err, ErrNotImplemented) {
+				return
+			}
+			t.Fatal("Mmap: ", err)
+		}
+		if on != tc.expect {
+			t.Errorf("flags %d, Mmap %d: expected %v, got %v", tc.flags, tc.mmap, tc.expect, on)
+		}
+	}
+}
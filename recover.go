@@ -0,0 +1,151 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+// #include <stdint.h>
+import "C"
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Kinds of recovery failures.
+const (
+	RecoveryOtherFailure = iota
+	// Failure not recognized by the parser; see Message.
+	RecoveryBucketFailure
+	// A bucket could not be read.  All its keys are lost.
+	RecoveryKeyFailure
+	// A key/value pair could not be read.
+	RecoveryDuplicateKey
+	// A duplicate key was ignored.
+	RecoveryStoreFailure
+	// A key/value pair could not be stored in the recovered database.
+)
+
+// RecoveryFailure describes a failure encountered during recovery.
+type RecoveryFailure struct {
+	Kind int
+	// Kind of the failure: one of the Recovery*Failure constants or
+	// RecoveryDuplicateKey.
+	Bucket int
+	// Index of the bucket in the hash directory, or -1 if unknown.
+	Element int
+	// Index of the element in the bucket hash table, or -1 if unknown.
+	Offset int64
+	// File offset of the key/value pair, or -1 if unknown.
+	Size int
+	// Size of the key/value pair, or -1 if unknown.
+	Reason string
+	// Description of the error that caused the failure, if any.
+	Message string
+	// Message reported by the library.
+}
+
+// Recovery message formats used by the library, in the order of
+// RecoveryBucketFailure, RecoveryKeyFailure, RecoveryDuplicateKey and
+// RecoveryStoreFailure.
+var recoveryFormats = []string{
+	RecoveryBucketFailure: "can't read bucket #%d",
+	RecoveryKeyFailure: "can't read key pair %d:%d (%d:%d)",
+	RecoveryDuplicateKey: "ignoring duplicate key %d:%d (%d:%d)",
+	RecoveryStoreFailure: "fatal: can't store element %d:%d (%d:%d)",
+}
+
+// Parse a message reported by the library during recovery.
+func parseRecoveryFailure(msg string) RecoveryFailure {
+	f := RecoveryFailure{
+		Kind: RecoveryOtherFailure,
+		Bucket: -1,
+		Element: -1,
+		Offset: -1,
+		Size: -1,
+		Message: msg,
+	}
+	for kind, format := range recoveryFormats {
+		if format == "" {
+			continue
+		}
+		prefix := format[:strings.Index(format, "%")]
+		if !strings.HasPrefix(msg, prefix) {
+			continue
+		}
+		r := f
+		var err error
+		if kind == RecoveryBucketFailure {
+			_, err = fmt.Sscanf(msg, format, &r.Bucket)
+		} else {
+			_, err = fmt.Sscanf(msg, format, &r.Bucket, &r.Element, &r.Offset, &r.Size)
+		}
+		if err == nil {
+			r.Kind = kind
+			if i := strings.Index(msg[len(prefix):], ": "); i != -1 {
+				r.Reason = msg[len(prefix)+i+2:]
+			}
+			return r
+		}
+	}
+	return f
+}
+
+// A recovery in progress.
+type recoveryState struct {
+	cfg *RecoveryConfig
+	stat *RecoveryStat
+}
+
+// Recoveries in progress, indexed by handles passed to the library.
+var recoveries = struct {
+	sync.Mutex
+	m map[uintptr]*recoveryState
+	next uintptr
+}{m: make(map[uintptr]*recoveryState)}
+
+type recoveryHandle uintptr
+
+// Register a recovery and return its handle.
+func newRecoveryHandle(cfg *RecoveryConfig, stat *RecoveryStat) recoveryHandle {
+	recoveries.Lock()
+	defer recoveries.Unlock()
+	recoveries.next++
+	recoveries.m[recoveries.next] = &recoveryState{cfg: cfg, stat: stat}
+	return recoveryHandle(recoveries.next)
+}
+
+// Unregister the recovery.
+func (h recoveryHandle) free() {
+	recoveries.Lock()
+	delete(recoveries.m, uintptr(h))
+	recoveries.Unlock()
+}
+
+//export goRecoveryError
+func goRecoveryError(h C.uintptr_t, msg *C.char) {
+	recoveries.Lock()
+	st := recoveries.m[uintptr(h)]
+	recoveries.Unlock()
+	if st == nil {
+		return
+	}
+	s := C.GoString(msg)
+	st.stat.Failures = append(st.stat.Failures, parseRecoveryFailure(s))
+	if st.cfg.ErrorFunc != nil {
+		st.cfg.ErrorFunc(s)
+	}
+}
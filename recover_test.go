@@ -0,0 +1,219 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+import (
+	"bytes"
+	"github.com/graygnuorg/go-gdbm/format"
+	"os"
+	"testing"
+)
+
+// Overwrite len(data) bytes of the database file at offset off.
+func corruptDatabase(t *testing.T, off int64, data []byte) {
+	fd, err := os.OpenFile(dbname, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	if _, err := fd.WriteAt(data, off); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Returns the layout of the test database.
+func inspectDatabase(t *testing.T) *format.File {
+	f, err := format.Open(dbname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestParseRecoveryFailure(t *testing.T) {
+	for _, tc := range []struct{
+		msg string
+		expect RecoveryFailure
+	}{
+		{
+			"can't read bucket #3: Malformed bucket header",
+			RecoveryFailure{Kind: RecoveryBucketFailure, Bucket: 3, Element: -1, Offset: -1, Size: -1, Reason: "Malformed bucket header"},
+		},
+		{
+			"can't read key pair 1:17 (4096:12): Malformed data",
+			RecoveryFailure{Kind: RecoveryKeyFailure, Bucket: 1, Element: 17, Offset: 4096, Size: 12, Reason: "Malformed data"},
+		},
+		{
+			"ignoring duplicate key 0:2 (512:8)",
+			RecoveryFailure{Kind: RecoveryDuplicateKey, Bucket: 0, Element: 2, Offset: 512, Size: 8},
+		},
+		{
+			"fatal: can't store element 5:6 (1024:9): Cannot write",
+			RecoveryFailure{Kind: RecoveryStoreFailure, Bucket: 5, Element: 6, Offset: 1024, Size: 9, Reason: "Cannot write"},
+		},
+		{
+			"something else",
+			RecoveryFailure{Kind: RecoveryOtherFailure, Bucket: -1, Element: -1, Offset: -1, Size: -1},
+		},
+	} {
+		tc.expect.Message = tc.msg
+		if f := parseRecoveryFailure(tc.msg); f != tc.expect {
+			t.Errorf("%q: got %+v, expected %+v", tc.msg, f, tc.expect)
+		}
+	}
+}
+
+func TestRecoverBadBucket(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	f := inspectDatabase(t)
+	addrs := f.BucketAddrs()
+	if len(addrs) == 0 {
+		t.Fatal("no buckets")
+	}
+	// Garbage in the bucket avail count.
+	corruptDatabase(t, addrs[0], []byte{0xff, 0xff, 0xff, 0x7f})
+
+	db, err := Open(dbname, ModeWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var messages []string
+	stat, err := db.Recover(RecoveryConfig{
+		Force: true,
+		ErrorFunc: func(msg string) {
+			messages = append(messages, msg)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.FailedBuckets == 0 {
+		t.Errorf("expected failed buckets, got %+v", stat)
+	}
+	if len(stat.Failures) == 0 {
+		t.Fatal("no failures reported")
+	}
+	if len(messages) != len(stat.Failures) {
+		t.Errorf("ErrorFunc called %d times, expected %d", len(messages), len(stat.Failures))
+	}
+	for i, f := range stat.Failures {
+		if f.Kind != RecoveryBucketFailure {
+			t.Errorf("failure %d: unexpected kind: %+v", i, f)
+		}
+		if f.Message != messages[i] {
+			t.Errorf("failure %d: message %q, expected %q", i, f.Message, messages[i])
+		}
+		if f.Reason == "" {
+			t.Errorf("failure %d: no reason: %+v", i, f)
+		}
+	}
+}
+
+func TestRecoverBadKey(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	f := inspectDatabase(t)
+	addr := f.BucketAddrs()[0]
+	b, err := f.ReadBucket(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Point the data of the first element in use beyond the end of
+	// file.
+	elem := -1
+	for i := range b.Table {
+		if b.Table[i].InUse() {
+			elem = i
+			break
+		}
+	}
+	if elem == -1 {
+		t.Fatal("empty bucket")
+	}
+	e := b.Table[elem]
+	key, err := f.ReadKey(&e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := f.Header
+	buf := make([]byte, h.BucketSize)
+	fd, err := os.Open(dbname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fd.ReadAt(buf, addr)
+	fd.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ptr := make([]byte, h.OffsetSize)
+	bad := make([]byte, h.OffsetSize)
+	badptr := int64(1 << 30)
+	if h.OffsetSize == 8 {
+		h.ByteOrder.PutUint64(ptr, uint64(e.DataPointer))
+		h.ByteOrder.PutUint64(bad, uint64(badptr))
+	} else {
+		h.ByteOrder.PutUint32(ptr, uint32(e.DataPointer))
+		h.ByteOrder.PutUint32(bad, uint32(badptr))
+	}
+	off := bytes.Index(buf, ptr)
+	if off == -1 {
+		t.Fatal("data pointer not found in bucket")
+	}
+	corruptDatabase(t, addr + int64(off), bad)
+
+	db, err := Open(dbname, ModeWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var messages []string
+	stat, err := db.Recover(RecoveryConfig{
+		Force: true,
+		ErrorFunc: func(msg string) {
+			messages = append(messages, msg)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.FailedKeys != 1 {
+		t.Errorf("expected 1 failed key, got %+v", stat)
+	}
+	if len(stat.Failures) != 1 || len(messages) != 1 {
+		t.Fatalf("expected 1 failure, got %+v (messages %q)", stat.Failures, messages)
+	}
+	r := stat.Failures[0]
+	if r.Kind != RecoveryKeyFailure || r.Element != elem ||
+		r.Offset != badptr || r.Size != e.KeySize + e.DataSize ||
+		r.Message != messages[0] || r.Reason == "" {
+		t.Errorf("unexpected failure record: %+v", r)
+	}
+	if db.Exists(key) {
+		t.Errorf("key %q survived recovery", key)
+	}
+	if n, _ := db.Count(); n != uint(len(keys) - 1) {
+		t.Errorf("expected %d keys after recovery, got %d", len(keys) - 1, n)
+	}
+}
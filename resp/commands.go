@@ -0,0 +1,327 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"strconv"
+	"strings"
+	"github.com/graygnuorg/go-gdbm"
+)
+
+// Client session.
+type session struct {
+	srv *Server
+	r *bufio.Reader
+	w *bufio.Writer
+	cursors map[uint64]*scanCursor
+	// Active SCAN cursors.
+	nextCursor uint64
+	// ID of the next cursor to create.
+}
+
+// SCAN cursor state.
+type scanCursor struct {
+	last []byte
+	// Last key visited by the previous SCAN call.  The next call resumes
+	// the iteration after it.
+}
+
+type command struct {
+	handler func(sess *session, args [][]byte)
+	arity int
+	// Number of arguments, including the command name.  Negative
+	// value means at least -arity arguments.
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"GET": {(*session).cmdGet, 2},
+		"SET": {(*session).cmdSet, -3},
+		"SETNX": {(*session).cmdSetnx, 3},
+		"DEL": {(*session).cmdDel, -2},
+		"EXISTS": {(*session).cmdExists, -2},
+		"DBSIZE": {(*session).cmdDbsize, 1},
+		"SCAN": {(*session).cmdScan, -2},
+		"SAVE": {(*session).cmdSave, 1},
+		"BGREWRITEAOF": {(*session).cmdBgrewriteaof, 1},
+		"PING": {(*session).cmdPing, -1},
+		"ECHO": {(*session).cmdEcho, 2},
+		"COMMAND": {(*session).cmdCommand, -1},
+	}
+}
+
+// Execute a command.  Returns true if the connection must be closed.
+func (sess *session) dispatch(args [][]byte) bool {
+	name := strings.ToUpper(string(args[0]))
+	if name == "QUIT" {
+		sess.writeStatus("OK")
+		return true
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		sess.writeError("ERR unknown command '" + string(args[0]) + "'")
+		return false
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || len(args) < -cmd.arity {
+		sess.writeError("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+		return false
+	}
+	cmd.handler(sess, args)
+	return false
+}
+
+// Reply with the error returned by the database.
+func (sess *session) writeDBError(err error) {
+	if errors.Is(err, gdbm.ErrReaderCantStore) {
+		sess.writeError("READONLY " + err.Error())
+	} else {
+		sess.writeError("ERR " + err.Error())
+	}
+}
+
+func (sess *session) cmdGet(args [][]byte) {
+	value, err := sess.srv.DB.Fetch(args[1])
+	if err != nil {
+		if errors.Is(err, gdbm.ErrItemNotFound) {
+			sess.writeNull()
+		} else {
+			sess.writeDBError(err)
+		}
+		return
+	}
+	sess.writeBulk(value)
+}
+
+func (sess *session) cmdSet(args [][]byte) {
+	replace := true
+	for _, opt := range args[3:] {
+		if strings.ToUpper(string(opt)) == "NX" {
+			replace = false
+		} else {
+			sess.writeError("ERR syntax error")
+			return
+		}
+	}
+	err := sess.srv.DB.Store(args[1], args[2], replace)
+	if err != nil {
+		if errors.Is(err, gdbm.ErrCannotReplace) {
+			sess.writeNull()
+		} else {
+			sess.writeDBError(err)
+		}
+		return
+	}
+	sess.writeStatus("OK")
+}
+
+func (sess *session) cmdSetnx(args [][]byte) {
+	err := sess.srv.DB.Store(args[1], args[2], false)
+	if err != nil {
+		if errors.Is(err, gdbm.ErrCannotReplace) {
+			sess.writeInt(0)
+		} else {
+			sess.writeDBError(err)
+		}
+		return
+	}
+	sess.writeInt(1)
+}
+
+func (sess *session) cmdDel(args [][]byte) {
+	var n int64
+	for _, key := range args[1:] {
+		err := sess.srv.DB.Delete(key)
+		if err == nil {
+			n++
+		} else if !errors.Is(err, gdbm.ErrItemNotFound) {
+			sess.writeDBError(err)
+			return
+		}
+	}
+	sess.writeInt(n)
+}
+
+func (sess *session) cmdExists(args [][]byte) {
+	var n int64
+	for _, key := range args[1:] {
+		if sess.srv.DB.Exists(key) {
+			n++
+		}
+	}
+	sess.writeInt(n)
+}
+
+func (sess *session) cmdDbsize(args [][]byte) {
+	n, err := sess.srv.DB.Count()
+	if err != nil {
+		sess.writeDBError(err)
+		return
+	}
+	sess.writeInt(int64(n))
+}
+
+func (sess *session) cmdSave(args [][]byte) {
+	if err := sess.srv.DB.Sync(); err != nil {
+		sess.writeDBError(err)
+		return
+	}
+	sess.writeStatus("OK")
+}
+
+func (sess *session) cmdBgrewriteaof(args [][]byte) {
+	if err := sess.srv.DB.Reorganize(); err != nil {
+		sess.writeDBError(err)
+		return
+	}
+	sess.writeStatus("OK")
+}
+
+func (sess *session) cmdPing(args [][]byte) {
+	switch len(args) {
+	case 1:
+		sess.writeStatus("PONG")
+	case 2:
+		sess.writeBulk(args[1])
+	default:
+		sess.writeError("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (sess *session) cmdEcho(args [][]byte) {
+	sess.writeBulk(args[1])
+}
+
+// Clients such as redis-cli query the command table on startup.  Reply
+// with an empty list.
+func (sess *session) cmdCommand(args [][]byte) {
+	sess.writeArrayHeader(0)
+}
+
+const (
+	defaultScanCount = 10
+	maxCursors = 64
+	// Maximum number of SCAN iterations in progress per connection.
+	// When it is reached, starting a new iteration abandons the oldest
+	// one.
+)
+
+// SCAN cursor [MATCH pattern] [COUNT count]
+//
+// Cursor 0 starts a new iteration.  Other cursor values refer to
+// iterations in progress within the same connection.
+func (sess *session) cmdScan(args [][]byte) {
+	id, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		sess.writeError("ERR invalid cursor")
+		return
+	}
+	var pattern []byte
+	count := defaultScanCount
+	for i := 2; i < len(args); i += 2 {
+		if i + 1 == len(args) {
+			sess.writeError("ERR syntax error")
+			return
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil || count < 1 {
+				sess.writeError("ERR value is out of range, must be positive")
+				return
+			}
+		default:
+			sess.writeError("ERR syntax error")
+			return
+		}
+	}
+
+	var sc *scanCursor
+	var cursor *gdbm.Cursor
+	if id == 0 {
+		if len(sess.cursors) == maxCursors {
+			sess.dropOldestCursor()
+		}
+		sess.nextCursor++
+		id = sess.nextCursor
+		sc = &scanCursor{}
+		sess.cursors[id] = sc
+		cursor = sess.srv.DB.Cursor()
+	} else if sc = sess.cursors[id]; sc == nil {
+		sess.writeError("ERR invalid cursor")
+		return
+	} else {
+		cursor = sess.srv.DB.CursorAfter(sc.last)
+	}
+	defer cursor.Close()
+
+	// Visit up to count keys, returning those that match the pattern.
+	var keys [][]byte
+	for n := 0; n < count && cursor.Next(); n++ {
+		key := cursor.Key()
+		if pattern == nil || globMatch(pattern, key) {
+			keys = append(keys, key)
+		}
+		sc.last = key
+	}
+
+	// Check whether the iteration is over.  The key read here is
+	// visited again by the next call.
+	more := cursor.Err() == nil && cursor.Next()
+	if err := cursor.Err(); err != nil {
+		delete(sess.cursors, id)
+		sess.writeScanError(err)
+		return
+	}
+	if !more {
+		delete(sess.cursors, id)
+		id = 0
+	}
+
+	sess.writeArrayHeader(2)
+	sess.writeBulk([]byte(strconv.FormatUint(id, 10)))
+	sess.writeArrayHeader(len(keys))
+	for _, key := range keys {
+		sess.writeBulk(key)
+	}
+}
+
+// Reports an error that ended a SCAN iteration.  The iteration resumes
+// after the last key visited, so if that key has been deleted in the
+// meantime, its position is lost.
+func (sess *session) writeScanError(err error) {
+	if errors.Is(err, gdbm.ErrItemNotFound) {
+		sess.writeError("ERR cursor position lost: key deleted during SCAN")
+	} else {
+		sess.writeDBError(err)
+	}
+}
+
+func (sess *session) dropOldestCursor() {
+	var oldest uint64
+	for id := range sess.cursors {
+		if oldest == 0 || id < oldest {
+			oldest = id
+		}
+	}
+	delete(sess.cursors, oldest)
+}
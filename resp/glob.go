@@ -0,0 +1,107 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package resp
+
+// Report whether s matches the glob pattern.  The syntax is that of the
+// Redis KEYS and SCAN commands:
+//
+//   *       matches any sequence of bytes, including '/'
+//   ?       matches any single byte
+//   [...]   matches any byte from the set; a leading '^' negates the set,
+//           and a-z denotes a range
+//   \c      matches the byte c literally
+//
+// Malformed patterns are not an error: an unterminated set extends to
+// the end of the pattern.
+func globMatch(pattern, s []byte) bool {
+	p, i := 0, 0
+	// Positions to resume from after the most recent '*'.
+	starP, starI := -1, 0
+	for i < len(s) {
+		if p < len(pattern) {
+			if pattern[p] == '*' {
+				starP, starI = p, i
+				p++
+				continue
+			}
+			if n, ok := matchByte(pattern[p:], s[i]); ok {
+				p += n
+				i++
+				continue
+			}
+		}
+		// Mismatch: let the last '*' absorb one more byte.
+		if starP < 0 {
+			return false
+		}
+		starI++
+		p, i = starP + 1, starI
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// Match the byte c against the first element of the pattern (which must
+// not be '*').  Return the length of that element and the match result.
+func matchByte(pattern []byte, c byte) (int, bool) {
+	switch pattern[0] {
+	case '?':
+		return 1, true
+	case '\\':
+		if len(pattern) > 1 {
+			return 2, pattern[1] == c
+		}
+	case '[':
+		return matchSet(pattern, c)
+	}
+	return 1, pattern[0] == c
+}
+
+// Match c against the set that starts the pattern.
+func matchSet(pattern []byte, c byte) (int, bool) {
+	i := 1
+	negate := i < len(pattern) && pattern[i] == '^'
+	if negate {
+		i++
+	}
+	match := false
+	for ; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == ']':
+			return i + 1, match != negate
+		case pattern[i] == '\\' && i + 1 < len(pattern):
+			i++
+			if pattern[i] == c {
+				match = true
+			}
+		case i + 2 < len(pattern) && pattern[i+1] == '-':
+			lo, hi := pattern[i], pattern[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				match = true
+			}
+			i += 2
+		case pattern[i] == c:
+			match = true
+		}
+	}
+	return i, match != negate
+}
@@ -0,0 +1,153 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package resp
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+)
+
+const (
+	maxArgs = 1024 * 1024
+	// Maximum number of arguments in a command.
+	maxBulkLen = 512 * 1024 * 1024
+	// Maximum length of a bulk string.
+	maxInlineLen = 64 * 1024
+	// Maximum length of an inline command.
+)
+
+// Malformed request.
+type protocolError string
+
+func (e protocolError) Error() string {
+	return string(e)
+}
+
+// Read a line terminated by CRLF (or LF, for inline commands).
+func (sess *session) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := sess.r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxInlineLen {
+			return nil, protocolError("too big inline request")
+		}
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
+
+// Parse the integer following the type byte of a RESP header line.  The
+// value must be in the range [-1, max]; -1 denotes a null element.
+func parseLength(line []byte, max int) (int, error) {
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < -1 || n > max {
+		return 0, protocolError("invalid length")
+	}
+	return n, nil
+}
+
+// Read a command: either a RESP array of bulk strings or an inline command.
+func (sess *session) readCommand() ([][]byte, error) {
+	line, err := sess.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return bytes.Fields(line), nil
+	}
+
+	n, err := parseLength(line, maxArgs)
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		// Null or empty array: an empty command, which is ignored.
+		return nil, nil
+	}
+	args := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := sess.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, protocolError("expected '$', got '" + string(line[:min(len(line), 1)]) + "'")
+		}
+		size, err := parseLength(line, maxBulkLen)
+		if err != nil || size < 0 {
+			return nil, protocolError("invalid bulk length")
+		}
+		buf := make([]byte, size + 2)
+		if _, err := io.ReadFull(sess.r, buf); err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, protocolError("bulk string not terminated by CRLF")
+		}
+		args = append(args, buf[:size])
+	}
+	return args, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (sess *session) writeStatus(s string) {
+	sess.w.WriteByte('+')
+	sess.w.WriteString(s)
+	sess.w.WriteString("\r\n")
+}
+
+func (sess *session) writeError(s string) {
+	sess.w.WriteByte('-')
+	sess.w.WriteString(s)
+	sess.w.WriteString("\r\n")
+}
+
+func (sess *session) writeInt(n int64) {
+	sess.w.WriteByte(':')
+	sess.w.WriteString(strconv.FormatInt(n, 10))
+	sess.w.WriteString("\r\n")
+}
+
+func (sess *session) writeBulk(b []byte) {
+	sess.w.WriteByte('$')
+	sess.w.WriteString(strconv.Itoa(len(b)))
+	sess.w.WriteString("\r\n")
+	sess.w.Write(b)
+	sess.w.WriteString("\r\n")
+}
+
+func (sess *session) writeNull() {
+	sess.w.WriteString("$-1\r\n")
+}
+
+func (sess *session) writeArrayHeader(n int) {
+	sess.w.WriteByte('*')
+	sess.w.WriteString(strconv.Itoa(n))
+	sess.w.WriteString("\r\n")
+}
@@ -0,0 +1,208 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+// Package resp serves a GDBM database over the network using the Redis
+// serialization protocol (RESP2), so that redis-cli and standard Redis
+// client libraries can be used to access it.
+//
+// The following commands are supported:
+//
+//	GET key                   Fetch
+//	SET key value [NX]        Store (with NX, replace=false)
+//	SETNX key value           Store with replace=false
+//	DEL key [key ...]         Delete
+//	EXISTS key [key ...]      Exists
+//	DBSIZE                    Count
+//	SCAN cursor [MATCH pattern] [COUNT count]
+//	                          Iterate over keys
+//	SAVE                      Sync
+//	BGREWRITEAOF              Reorganize
+//	PING [message], ECHO message, QUIT, COMMAND
+//
+// Example:
+//
+//	db, err := gdbm.Open("data.gdbm", gdbm.ModeWrcreat)
+//	...
+//	srv := resp.NewServer(db)
+//	log.Fatal(srv.ListenAndServe("localhost:6379"))
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"github.com/graygnuorg/go-gdbm"
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Close
+// is called.
+var ErrServerClosed = errors.New("resp: server closed")
+
+// Server serves a GDBM database over RESP.
+type Server struct {
+	DB *gdbm.Database
+	// The database to serve.
+	ErrorLog *log.Logger
+	// Logger for connection errors.  If nil, the standard logger is
+	// used.
+
+	mu sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns map[net.Conn]struct{}
+	closed bool
+	wg sync.WaitGroup
+}
+
+// NewServer returns a server for the database.
+func NewServer(db *gdbm.Database) *Server {
+	return &Server{DB: db}
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and serves connections.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on the listener l and serves each of them in
+// a separate goroutine.  It always returns a non-nil error and closes l.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+		if !s.track(c) {
+			c.Close()
+			return ErrServerClosed
+		}
+		go s.serveConn(c)
+	}
+}
+
+// Register the connection.  Returns false if the server is closed.
+func (s *Server) track(c net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+	}
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+// Close stops all listeners, closes active connections and waits for
+// their handlers to finish.  The database is not closed.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Server) serveConn(c net.Conn) {
+	sess := &session{
+		srv: s,
+		r: bufio.NewReader(c),
+		w: bufio.NewWriter(c),
+		cursors: make(map[uint64]*scanCursor),
+	}
+	defer func() {
+		c.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	for {
+		args, err := sess.readCommand()
+		if err != nil {
+			var perr protocolError
+			if errors.As(err, &perr) {
+				sess.writeError("ERR Protocol error: " + string(perr))
+				sess.w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := sess.dispatch(args)
+		// Flush unless more pipelined commands are pending.
+		if quit || sess.r.Buffered() == 0 {
+			if err := sess.w.Flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"github.com/graygnuorg/go-gdbm"
+	"github.com/graygnuorg/go-gdbm/kvtest"
+)
+
+// Minimal RESP client.
+type client struct {
+	t *testing.T
+	conn net.Conn
+	r *bufio.Reader
+}
+
+func (c *client) send(args ...string) {
+	var sb strings.Builder
+	sb.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		sb.WriteString("$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n")
+	}
+	if _, err := io.WriteString(c.conn, sb.String()); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// Read a reply.  Status replies are returned as strings prefixed with
+// "+", errors with "-", integers as int64, bulk strings as strings, null
+// as nil and arrays as []interface{}.
+func (c *client) reply() interface{} {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '+', '-':
+		return line
+	case ':':
+		n, _ := strconv.ParseInt(line[1:], 10, 64)
+		return n
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil
+		}
+		buf := make([]byte, n + 2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			c.t.Fatal(err)
+		}
+		return string(buf[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		res := make([]interface{}, n)
+		for i := range res {
+			res[i] = c.reply()
+		}
+		return res
+	}
+	c.t.Fatalf("Bad reply: %q", line)
+	return nil
+}
+
+func (c *client) do(args ...string) interface{} {
+	c.send(args...)
+	return c.reply()
+}
+
+func (c *client) expect(expected interface{}, args ...string) {
+	c.t.Helper()
+	if res := c.do(args...); !reflect.DeepEqual(res, expected) {
+		c.t.Errorf("%v: expected %#v, got %#v", args, expected, res)
+	}
+}
+
+func startServer(t *testing.T, mode int) (*gdbm.Database, string) {
+	db := kvtest.OpenDatabase(t, nil, mode)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(db)
+	done := make(chan error)
+	go func() {
+		done <- srv.Serve(l)
+	}()
+	t.Cleanup(func() {
+		srv.Close()
+		if err := <-done; !errors.Is(err, ErrServerClosed) {
+			t.Error("Serve returned ", err)
+		}
+	})
+	return db, l.Addr().String()
+}
+
+func dial(t *testing.T, addr string) *client {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func TestCommands(t *testing.T) {
+	_, addr := startServer(t, gdbm.ModeNewdb)
+	c := dial(t, addr)
+
+	c.expect("+PONG", "PING")
+	c.expect("hi", "ping", "hi")
+	c.expect(nil, "GET", "a")
+	c.expect("+OK", "SET", "a", "1")
+	c.expect("1", "GET", "a")
+	c.expect("+OK", "set", "a", "2")
+	c.expect(nil, "SET", "a", "3", "NX")
+	c.expect("2", "GET", "a")
+	c.expect(int64(0), "SETNX", "a", "4")
+	c.expect(int64(1), "SETNX", "b", "5")
+	c.expect("+OK", "SET", "bin", "\x00\r\n\xff")
+	c.expect("\x00\r\n\xff", "GET", "bin")
+	c.expect(int64(2), "EXISTS", "a", "b", "c")
+	c.expect(int64(3), "DBSIZE")
+	c.expect(int64(2), "DEL", "a", "bin", "c")
+	c.expect(int64(1), "DBSIZE")
+	c.expect("+OK", "SAVE")
+	c.expect("+OK", "BGREWRITEAOF")
+	c.expect("5", "GET", "b")
+
+	c.expect("-ERR unknown command 'FROB'", "FROB")
+	c.expect("-ERR wrong number of arguments for 'get' command", "GET")
+	c.expect("-ERR syntax error", "SET", "a", "1", "XX")
+	c.expect("-ERR invalid cursor", "SCAN", "42")
+
+	// Inline commands and pipelining
+	if _, err := io.WriteString(c.conn, "SET x 10\r\nGET x\nEXISTS x\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []interface{}{"+OK", "10", int64(1)} {
+		if res := c.reply(); !reflect.DeepEqual(res, expected) {
+			t.Errorf("Expected %#v, got %#v", expected, res)
+		}
+	}
+
+	c.expect("+OK", "QUIT")
+	if _, err := c.r.ReadByte(); err != io.EOF {
+		t.Error("Connection not closed after QUIT")
+	}
+}
+
+func TestScan(t *testing.T) {
+	db, addr := startServer(t, gdbm.ModeNewdb)
+	var expected []string
+	for i := 0; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		db.Store([]byte(key), []byte("x"), true)
+		if strings.HasPrefix(key, "key1") {
+			expected = append(expected, key)
+		}
+	}
+	sort.Strings(expected)
+
+	c := dial(t, addr)
+	scan := func(args ...string) []string {
+		var keys []string
+		cursor := "0"
+		for i := 0; ; i++ {
+			res := c.do(append([]string{"SCAN", cursor}, args...)...).([]interface{})
+			cursor = res[0].(string)
+			for _, k := range res[1].([]interface{}) {
+				keys = append(keys, k.(string))
+			}
+			if cursor == "0" {
+				break
+			}
+			if i > 100 {
+				t.Fatal("SCAN doesn't terminate")
+			}
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	if keys := scan(); len(keys) != 100 {
+		t.Errorf("SCAN returned %d keys", len(keys))
+	}
+	if keys := scan("MATCH", "key1*", "COUNT", "7"); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected %v, got %v", expected, keys)
+	}
+	if keys := scan("COUNT", "1000"); len(keys) != 100 {
+		t.Errorf("SCAN returned %d keys", len(keys))
+	}
+	c.expect("-ERR syntax error", "SCAN", "0", "COUNT")
+	c.expect("-ERR value is out of range, must be positive", "SCAN", "0", "COUNT", "0")
+}
+
+func TestScanDelete(t *testing.T) {
+	db, addr := startServer(t, gdbm.ModeNewdb)
+	for i := 0; i < 20; i++ {
+		db.Store([]byte("key" + strconv.Itoa(i)), []byte("x"), true)
+	}
+	c := dial(t, addr)
+
+	// Deleting keys already returned, except the last one, doesn't
+	// disturb the iteration.
+	seen := make(map[string]bool)
+	cursor := "0"
+	for i := 0; ; i++ {
+		res := c.do("SCAN", cursor, "COUNT", "3").([]interface{})
+		cursor = res[0].(string)
+		keys := res[1].([]interface{})
+		for j, k := range keys {
+			key := k.(string)
+			if seen[key] {
+				t.Errorf("Key %s returned twice", key)
+			}
+			seen[key] = true
+			if j == len(keys) - 1 {
+				continue
+			}
+			if err := db.Delete([]byte(key)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if cursor == "0" {
+			break
+		}
+		if i > 20 {
+			t.Fatal("SCAN doesn't terminate")
+		}
+	}
+	if len(seen) != 20 {
+		t.Errorf("SCAN returned %d keys", len(seen))
+	}
+
+	// Deleting the key that follows the ones returned so far doesn't
+	// end the iteration early.
+	for i := 0; i < 20; i++ {
+		db.Store([]byte("key" + strconv.Itoa(i)), []byte("x"), true)
+	}
+	res := c.do("SCAN", "0", "COUNT", "3").([]interface{})
+	keys := res[1].([]interface{})
+	next := db.CursorAfter([]byte(keys[len(keys)-1].(string)))
+	if !next.Next() {
+		t.Fatal(next.Err())
+	}
+	deleted := next.Key()
+	next.Close()
+	if err := db.Delete(deleted); err != nil {
+		t.Fatal(err)
+	}
+	n := len(keys)
+	for cursor = res[0].(string); cursor != "0"; {
+		res := c.do("SCAN", cursor, "COUNT", "3").([]interface{})
+		cursor = res[0].(string)
+		for _, k := range res[1].([]interface{}) {
+			if k.(string) == string(deleted) {
+				t.Errorf("Deleted key %s returned", deleted)
+			}
+			n++
+		}
+	}
+	if n != 19 {
+		t.Errorf("SCAN returned %d keys", n)
+	}
+
+	// Deleting the key the cursor is positioned at is reported.
+	db.Store(deleted, []byte("x"), true)
+	res = c.do("SCAN", "0", "COUNT", "3").([]interface{})
+	keys = res[1].([]interface{})
+	if err := db.Delete([]byte(keys[len(keys)-1].(string))); err != nil {
+		t.Fatal(err)
+	}
+	c.expect("-ERR cursor position lost: key deleted during SCAN", "SCAN", res[0].(string))
+	c.expect("-ERR invalid cursor", "SCAN", res[0].(string))
+}
+
+func TestGlobMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, s string
+		match bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "a/b", true},
+		{"a*c", "a/b/c", true},
+		{"a*c", "a/b/d", false},
+		{"a*b*c", "axxbyybzc", true},
+		{"a?c", "a/c", true},
+		{"a?c", "ac", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[b-a]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"h[\\]]llo", "h]llo", true},
+		{"h[ab", "ha", true},
+		{"a\\*", "a*", true},
+		{"a\\*", "ab", false},
+		{"a\\", "a\\", true},
+	} {
+		if res := globMatch([]byte(tc.pattern), []byte(tc.s)); res != tc.match {
+			t.Errorf("%q ~ %q: expected %v, got %v", tc.pattern, tc.s, tc.match, res)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	_, addr := startServer(t, gdbm.ModeReader)
+	c := dial(t, addr)
+	res, _ := c.do("SET", "a", "1").(string)
+	if !strings.HasPrefix(res, "-READONLY ") {
+		t.Errorf("Unexpected reply: %q", res)
+	}
+	c.expect(nil, "GET", "a")
+}
+
+func TestProtocolError(t *testing.T) {
+	_, addr := startServer(t, gdbm.ModeNewdb)
+	c := dial(t, addr)
+	io.WriteString(c.conn, "*1\r\n+GET\r\n")
+	res, _ := c.reply().(string)
+	if !strings.HasPrefix(res, "-ERR Protocol error") {
+		t.Errorf("Unexpected reply: %q", res)
+	}
+	if _, err := c.r.ReadByte(); err != io.EOF {
+		t.Error("Connection not closed after protocol error")
+	}
+}
+
+func TestNullCommand(t *testing.T) {
+	_, addr := startServer(t, gdbm.ModeNewdb)
+	c := dial(t, addr)
+	io.WriteString(c.conn, "*-1\r\n*0\r\n")
+	c.expect("+PONG", "PING")
+
+	for _, req := range []string{"*-2\r\n", "*1\r\n$-1\r\n", "*1\r\n$-5\r\n"} {
+		c = dial(t, addr)
+		io.WriteString(c.conn, req)
+		res, _ := c.reply().(string)
+		if !strings.HasPrefix(res, "-ERR Protocol error") {
+			t.Errorf("%q: unexpected reply: %q", req, res)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+// Package rest implements an HTTP gateway to a GDBM database.
+//
+// The following endpoints are served:
+//
+//	GET /keys/{key}     Return the value (404 if not found).
+//	HEAD /keys/{key}    Check if the key exists (200 or 404).
+//	PUT /keys/{key}     Store the request body as the value.  With
+//	                    "If-None-Match: *", existing keys are not
+//	                    replaced (412).
+//	DELETE /keys/{key}  Delete the key (404 if not found).
+//	GET /keys           List keys, in pages (see below).
+//	GET /stats          Return database statistics in JSON.
+//	GET /dump           Stream the database dump (ASCII by default,
+//	                    binary with ?format=binary).
+//
+// Keys in URLs are percent-encoded, so that arbitrary byte strings can
+// be used.
+//
+// GET /keys returns a JSON object:
+//
+//	{"keys": ["one", "two", ...], "next": "TOKEN"}
+//
+// The "next" member is present if there are more keys.  To obtain the
+// next page, pass its value in the "token" query parameter.  Other
+// parameters are "limit" (page size, default 100), "prefix" (return only
+// keys with this prefix) and "encoding" (set to "base64" to return keys
+// encoded in base64).
+//
+// Example:
+//
+//	db, err := gdbm.Open("data.gdbm", gdbm.ModeReader)
+//	...
+//	http.Handle("/db/", http.StripPrefix("/db", rest.NewHandler(db, true)))
+package rest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"github.com/graygnuorg/go-gdbm"
+)
+
+const (
+	DefaultPageSize = 100
+	// Number of keys returned by GET /keys, unless "limit" is given.
+	MaxPageSize = 10000
+	// Maximum allowed value of "limit".
+)
+
+// Handler serves HTTP requests to a database.
+type Handler struct {
+	db *gdbm.Database
+	readOnly bool
+	MaxValueSize int64
+	// Maximum size of a value accepted by PUT.  Zero means no limit.
+}
+
+// NewHandler returns a handler for the database.  If readOnly is true,
+// requests that modify the database are refused with status 405.
+func NewHandler(db *gdbm.Database, readOnly bool) *Handler {
+	return &Handler{db: db, readOnly: readOnly}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+	switch {
+	case path == "/keys":
+		if !allow(w, r, http.MethodGet, http.MethodHead) {
+			return
+		}
+		h.list(w, r)
+	case strings.HasPrefix(path, "/keys/"):
+		key, err := url.PathUnescape(path[len("/keys/"):])
+		if err != nil {
+			http.Error(w, "malformed key", http.StatusBadRequest)
+			return
+		}
+		h.serveKey(w, r, []byte(key))
+	case path == "/stats":
+		if !allow(w, r, http.MethodGet, http.MethodHead) {
+			return
+		}
+		h.stats(w, r)
+	case path == "/dump":
+		if !allow(w, r, http.MethodGet) {
+			return
+		}
+		h.dump(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Check if the request method is allowed.  If not, reply with 405.
+func allow(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+// Reply with the status corresponding to the database error.
+func dbError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, gdbm.ErrItemNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, gdbm.ErrCannotReplace):
+		status = http.StatusPreconditionFailed
+	case errors.Is(err, gdbm.ErrReaderCantStore),
+		errors.Is(err, gdbm.ErrReaderCantDelete):
+		status = http.StatusMethodNotAllowed
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func (h *Handler) serveKey(w http.ResponseWriter, r *http.Request, key []byte) {
+	methods := []string{http.MethodGet, http.MethodHead}
+	if !h.readOnly {
+		methods = append(methods, http.MethodPut, http.MethodDelete)
+	}
+	if !allow(w, r, methods...) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		if h.db.Exists(key) {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+
+	case http.MethodGet:
+		err := h.db.View(key, func(value []byte) error {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+			w.Write(value)
+			return nil
+		})
+		if err != nil {
+			dbError(w, err)
+		}
+
+	case http.MethodPut:
+		body := io.Reader(r.Body)
+		if h.MaxValueSize > 0 {
+			body = http.MaxBytesReader(w, r.Body, h.MaxValueSize)
+		}
+		value, err := io.ReadAll(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		replace := r.Header.Get("If-None-Match") != "*"
+		if err := h.db.Store(key, value, replace); err != nil {
+			dbError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		if err := h.db.Delete(key); err != nil {
+			dbError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// Response to GET /keys.
+type keyList struct {
+	Keys []string `json:"keys"`
+	Next string `json:"next,omitempty"`
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := DefaultPageSize
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > MaxPageSize {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	encode := func(key []byte) string { return string(key) }
+	switch q.Get("encoding") {
+	case "":
+	case "base64":
+		encode = base64.StdEncoding.EncodeToString
+	default:
+		http.Error(w, "invalid encoding", http.StatusBadRequest)
+		return
+	}
+	prefix := []byte(q.Get("prefix"))
+
+	var c *gdbm.Cursor
+	if token := q.Get("token"); token != "" {
+		key, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusBadRequest)
+			return
+		}
+		c = h.db.CursorAfterContext(r.Context(), key)
+	} else {
+		c = h.db.CursorContext(r.Context())
+	}
+	defer c.Close()
+
+	res := keyList{Keys: []string{}}
+	var last []byte
+	for c.Next() {
+		key := c.Key()
+		if !bytes.HasPrefix(key, prefix) {
+			continue
+		}
+		if len(res.Keys) == limit {
+			// There are more keys: the last returned key serves
+			// as the resume token.
+			res.Next = base64.RawURLEncoding.EncodeToString(last)
+			break
+		}
+		res.Keys = append(res.Keys, encode(key))
+		last = key
+	}
+	if err := c.Err(); err != nil {
+		if errors.Is(err, gdbm.ErrItemNotFound) {
+			// The key the token refers to was deleted.
+			http.Error(w, "resume token expired", http.StatusGone)
+		} else {
+			dbError(w, err)
+		}
+		return
+	}
+	writeJSON(w, res)
+}
+
+// Response to GET /stats.
+type stats struct {
+	Count uint `json:"count"`
+	Numsync bool `json:"numsync"`
+}
+
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	var st stats
+	var err error
+	if st.Count, err = h.db.Count(); err != nil {
+		dbError(w, err)
+		return
+	}
+	if st.Numsync, err = h.db.IsNumsync(); err != nil && !errors.Is(err, gdbm.ErrNotImplemented) {
+		dbError(w, err)
+		return
+	}
+	writeJSON(w, st)
+}
+
+func (h *Handler) dump(w http.ResponseWriter, r *http.Request) {
+	format := gdbm.AsciiDump
+	ctype := "text/plain; charset=utf-8"
+	switch r.URL.Query().Get("format") {
+	case "", "ascii":
+	case "binary":
+		format = gdbm.BinaryDump
+		ctype = "application/octet-stream"
+	default:
+		http.Error(w, "invalid format", http.StatusBadRequest)
+		return
+	}
+	// Don't hold the database lock while sending the dump to a
+	// possibly slow client.
+	f, err := h.db.DumpToTemp("", format)
+	if err != nil {
+		dbError(w, err)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", ctype)
+	io.Copy(w, f)
+}
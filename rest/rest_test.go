@@ -0,0 +1,257 @@
+package rest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"github.com/graygnuorg/go-gdbm"
+	"github.com/graygnuorg/go-gdbm/kvtest"
+)
+
+func request(t *testing.T, srv *httptest.Server, method, path string, body io.Reader, hdr ...string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL + path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i + 1 < len(hdr); i += 2 {
+		req.Header.Set(hdr[i], hdr[i+1])
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(data)
+}
+
+func expectStatus(t *testing.T, resp *http.Response, status int) {
+	t.Helper()
+	if resp.StatusCode != status {
+		t.Errorf("%s %s: expected status %d, got %d", resp.Request.Method, resp.Request.URL.Path, status, resp.StatusCode)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(kvtest.OpenDatabase(t, kvtest.Numbered(25), gdbm.ModeNewdb), false))
+	defer srv.Close()
+
+	resp, body := request(t, srv, "GET", "/keys/key1", nil)
+	expectStatus(t, resp, http.StatusOK)
+	if body != "1" || resp.Header.Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("GET returned %q (%s)", body, resp.Header.Get("Content-Type"))
+	}
+	resp, _ = request(t, srv, "GET", "/keys/nokey", nil)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	resp, _ = request(t, srv, "HEAD", "/keys/key2", nil)
+	expectStatus(t, resp, http.StatusOK)
+	resp, _ = request(t, srv, "HEAD", "/keys/nokey", nil)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	// Binary key
+	resp, _ = request(t, srv, "PUT", "/keys/a%2Fb%00c", strings.NewReader("binary"))
+	expectStatus(t, resp, http.StatusNoContent)
+	resp, body = request(t, srv, "GET", "/keys/a%2Fb%00c", nil)
+	expectStatus(t, resp, http.StatusOK)
+	if body != "binary" {
+		t.Errorf("GET returned %q", body)
+	}
+
+	resp, _ = request(t, srv, "PUT", "/keys/key1", strings.NewReader("one"), "If-None-Match", "*")
+	expectStatus(t, resp, http.StatusPreconditionFailed)
+	resp, _ = request(t, srv, "PUT", "/keys/key1", strings.NewReader("one"))
+	expectStatus(t, resp, http.StatusNoContent)
+	if _, body = request(t, srv, "GET", "/keys/key1", nil); body != "one" {
+		t.Errorf("GET returned %q", body)
+	}
+
+	resp, _ = request(t, srv, "DELETE", "/keys/key1", nil)
+	expectStatus(t, resp, http.StatusNoContent)
+	resp, _ = request(t, srv, "DELETE", "/keys/key1", nil)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	resp, _ = request(t, srv, "POST", "/keys/key1", nil)
+	expectStatus(t, resp, http.StatusMethodNotAllowed)
+	resp, _ = request(t, srv, "GET", "/other", nil)
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestReadOnly(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(kvtest.OpenDatabase(t, kvtest.Numbered(25), gdbm.ModeReader), true))
+	defer srv.Close()
+
+	resp, _ := request(t, srv, "PUT", "/keys/key1", strings.NewReader("one"))
+	expectStatus(t, resp, http.StatusMethodNotAllowed)
+	if allow := resp.Header.Get("Allow"); allow != "GET, HEAD" {
+		t.Errorf("Allow: %q", allow)
+	}
+	resp, _ = request(t, srv, "DELETE", "/keys/key1", nil)
+	expectStatus(t, resp, http.StatusMethodNotAllowed)
+	resp, body := request(t, srv, "GET", "/keys/key1", nil)
+	expectStatus(t, resp, http.StatusOK)
+	if body != "1" {
+		t.Errorf("GET returned %q", body)
+	}
+}
+
+func TestList(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(kvtest.OpenDatabase(t, kvtest.Numbered(25), gdbm.ModeNewdb), false))
+	defer srv.Close()
+
+	list := func(query string) ([]string, int) {
+		var keys []string
+		token := ""
+		pages := 0
+		for {
+			q := query
+			if token != "" {
+				q += "&token=" + token
+			}
+			resp, body := request(t, srv, "GET", "/keys?" + q, nil)
+			expectStatus(t, resp, http.StatusOK)
+			var res keyList
+			if err := json.Unmarshal([]byte(body), &res); err != nil {
+				t.Fatalf("%v: %q", err, body)
+			}
+			keys = append(keys, res.Keys...)
+			pages++
+			if res.Next == "" {
+				break
+			}
+			token = res.Next
+		}
+		sort.Strings(keys)
+		return keys, pages
+	}
+
+	keys, pages := list("limit=10")
+	if len(keys) != 25 || pages != 3 {
+		t.Errorf("Got %d keys in %d pages", len(keys), pages)
+	}
+	for i := 1; i < len(keys); i++ {
+		if keys[i] == keys[i-1] {
+			t.Errorf("Duplicate key %q", keys[i])
+		}
+	}
+
+	keys, _ = list("prefix=key1&limit=3")
+	if strings.Join(keys, ",") != "key1,key10,key11,key12,key13,key14,key15,key16,key17,key18,key19" {
+		t.Errorf("Got %v", keys)
+	}
+
+	keys, _ = list("prefix=key2&encoding=base64")
+	if len(keys) != 6 || keys[0] != base64.StdEncoding.EncodeToString([]byte("key2")) {
+		t.Errorf("Got %v", keys)
+	}
+
+	resp, _ := request(t, srv, "GET", "/keys?limit=0", nil)
+	expectStatus(t, resp, http.StatusBadRequest)
+	resp, _ = request(t, srv, "GET", "/keys?token=***", nil)
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	// Token referring to a deleted key
+	token := base64.RawURLEncoding.EncodeToString([]byte("nokey"))
+	resp, _ = request(t, srv, "GET", "/keys?token=" + token, nil)
+	expectStatus(t, resp, http.StatusGone)
+}
+
+func TestStatsAndDump(t *testing.T) {
+	db := kvtest.OpenDatabase(t, kvtest.Numbered(25), gdbm.ModeNewdb)
+	srv := httptest.NewServer(NewHandler(db, true))
+	defer srv.Close()
+
+	resp, body := request(t, srv, "GET", "/stats", nil)
+	expectStatus(t, resp, http.StatusOK)
+	var st stats
+	if err := json.Unmarshal([]byte(body), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Count != 25 || st.Numsync {
+		t.Errorf("Got %+v", st)
+	}
+
+	resp, body = request(t, srv, "GET", "/dump", nil)
+	expectStatus(t, resp, http.StatusOK)
+	if !strings.HasPrefix(body, "# GDBM dump file created by") ||
+		!strings.Contains(body, "#:count=25\n") ||
+		!strings.HasSuffix(body, "# End of data\n") {
+		t.Errorf("Bad dump: %q", body)
+	}
+	resp, body = request(t, srv, "GET", "/dump?format=binary", nil)
+	expectStatus(t, resp, http.StatusOK)
+	if !strings.HasPrefix(body, "!\r\n! GDBM FLAT FILE DUMP") {
+		t.Errorf("Bad dump: %q", body)
+	}
+	resp, _ = request(t, srv, "GET", "/dump?format=xml", nil)
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	db.Close()
+	resp, _ = request(t, srv, "GET", "/dump", nil)
+	expectStatus(t, resp, http.StatusInternalServerError)
+	resp, _ = request(t, srv, "GET", "/stats", nil)
+	expectStatus(t, resp, http.StatusInternalServerError)
+}
+
+// Response writer that blocks until released.
+type stalledWriter struct {
+	header http.Header
+	started chan struct{}
+	release chan struct{}
+	once sync.Once
+}
+
+func (w *stalledWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *stalledWriter) WriteHeader(int) {}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.started) })
+	<-w.release
+	return len(p), nil
+}
+
+func TestDumpStalledClient(t *testing.T) {
+	db := kvtest.OpenDatabase(t, kvtest.Numbered(25), gdbm.ModeNewdb)
+	h := NewHandler(db, false)
+	w := &stalledWriter{
+		header: http.Header{},
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/dump", nil))
+		close(done)
+	}()
+	<-w.started
+
+	// Writers are not blocked by the stalled client.
+	stored := make(chan error, 1)
+	go func() {
+		stored <- db.Store([]byte("new"), []byte("value"), false)
+	}()
+	select {
+	case err := <-stored:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Store blocked by a stalled dump")
+	}
+	close(w.release)
+	<-done
+}
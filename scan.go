@@ -0,0 +1,368 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+/*
+#include <stdlib.h>
+#include <gdbm.h>
+*/
+import "C"
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"unsafe"
+)
+
+// Returns true if key is within the range [lo, hi).  Nil bounds are
+// ignored.
+func inRange(key, lo, hi []byte) bool {
+	return (lo == nil || bytes.Compare(key, lo) >= 0) &&
+		(hi == nil || bytes.Compare(key, hi) < 0)
+}
+
+// ScanPrefix returns a cursor visiting the keys that begin with prefix.
+// Keys are visited in unspecified (hash) order, so the whole database is
+// scanned.  Use SortedScan to obtain keys in sorted order.
+func (db *Database) ScanPrefix(prefix []byte) *Cursor {
+	c := db.Cursor()
+	prefix = append([]byte{}, prefix...)
+	c.match = func(key []byte) bool {
+		return bytes.HasPrefix(key, prefix)
+	}
+	return c
+}
+
+// ScanRange returns a cursor visiting the keys k such that lo <= k < hi,
+// in byte-wise lexicographical comparison.  A nil bound means no limit.
+// As with ScanPrefix, the keys are visited in unspecified order.
+func (db *Database) ScanRange(lo, hi []byte) *Cursor {
+	c := db.Cursor()
+	if lo != nil {
+		lo = append([]byte{}, lo...)
+	}
+	if hi != nil {
+		hi = append([]byte{}, hi...)
+	}
+	c.match = func(key []byte) bool {
+		return inRange(key, lo, hi)
+	}
+	return c
+}
+
+// Default memory limit for sorting keys.
+const DefaultSortMemoryLimit = 64 << 20
+
+// Approximate memory overhead per key kept in memory.
+const sortKeyOverhead = 32
+
+// SortConfig controls SortedScan.
+type SortConfig struct {
+	Prefix []byte
+	// If not nil, only keys beginning with this prefix are included.
+	Lo []byte
+	// If not nil, only keys greater than or equal to Lo are included.
+	Hi []byte
+	// If not nil, only keys less than Hi are included.
+	MemoryLimit int
+	// Approximate amount of memory used for sorting, in bytes.  When
+	// the collected keys exceed it, they are sorted and written to a
+	// temporary file.  Defaults to DefaultSortMemoryLimit.
+	TempDir string
+	// Directory for temporary files.  Defaults to os.TempDir().
+}
+
+// SortedCursor visits keys from a sorted snapshot of the database keys,
+// in ascending byte-wise order.  It is returned by SortedScan and has the
+// same methods as Cursor.
+//
+// Only keys are kept in the snapshot.  Values are read from the database
+// when requested, so they reflect its current state.
+type SortedCursor struct {
+	db *Database
+	runs sortRuns
+	// Sorted runs being merged, ordered by their current keys.
+	files []*os.File
+	// Temporary files holding runs; removed on Close.
+	key []byte
+	value []byte
+	fetched bool
+	done bool
+	err error
+}
+
+// A sorted sequence of keys, kept either in memory or in a file.
+type sortRun struct {
+	keys [][]byte
+	r *bufio.Reader
+	head []byte
+	// Current key.
+}
+
+// Advance the run to its next key.  Returns io.EOF when it is exhausted.
+func (r *sortRun) next() error {
+	if r.r == nil {
+		if len(r.keys) == 0 {
+			return io.EOF
+		}
+		r.head = r.keys[0]
+		r.keys = r.keys[1:]
+		return nil
+	}
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return err
+	}
+	r.head = make([]byte, n)
+	if _, err = io.ReadFull(r.r, r.head); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return nil
+}
+
+// A heap of runs, ordered by their current keys.
+type sortRuns []*sortRun
+
+func (h sortRuns) Len() int { return len(h) }
+func (h sortRuns) Less(i, j int) bool { return bytes.Compare(h[i].head, h[j].head) < 0 }
+func (h sortRuns) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *sortRuns) Push(x interface{}) { *h = append(*h, x.(*sortRun)) }
+func (h *sortRuns) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// SortedScan takes a sorted snapshot of the database keys selected by
+// cfg and returns a cursor over it.  The keys are collected while holding
+// a read lock on the database, so the snapshot is consistent.  Memory use
+// is bounded by cfg.MemoryLimit: larger key sets are sorted in parts,
+// which are spilled to temporary files and merged while iterating.  The
+// cursor must be closed to remove these files.
+//
+// Example:
+//	c, err := db.SortedScan(gdbm.SortConfig{Prefix: []byte("user:")})
+//	if err != nil {
+//		panic(err)
+//	}
+//	defer c.Close()
+//	for c.Next() {
+//		do_something(c.Key(), c.Value())
+//	}
+//	if err := c.Err(); err != nil {
+//		panic(err)
+//	}
+func (db *Database) SortedScan(cfg SortConfig) (*SortedCursor, error) {
+	limit := cfg.MemoryLimit
+	if limit <= 0 {
+		limit = DefaultSortMemoryLimit
+	}
+	c := &SortedCursor{db: db}
+	if err := c.collect(cfg, limit); err != nil {
+		c.Close()
+		return nil, err
+	}
+	for i := 0; i < len(c.runs); {
+		if err := c.runs[i].next(); err != nil {
+			if err != io.EOF {
+				c.Close()
+				return nil, err
+			}
+			c.runs = append(c.runs[:i], c.runs[i+1:]...)
+		} else {
+			i++
+		}
+	}
+	heap.Init(&c.runs)
+	return c, nil
+}
+
+// Call fn for each key in the database.  The key passed to fn points to
+// memory owned by the library and is valid only during the call.  If fn
+// returns an error, the iteration stops and the error is returned.  The
+// caller must hold the database lock.
+func (db *Database) eachKey(fn func(key []byte) error) error {
+	cur := C.gdbm_firstkey(db.dbf)
+	for cur.dptr != nil {
+		if err := fn(cSlice(cur)); err != nil {
+			C.free(unsafe.Pointer(cur.dptr))
+			return err
+		}
+		next := C.gdbm_nextkey(db.dbf, cur)
+		C.free(unsafe.Pointer(cur.dptr))
+		cur = next
+	}
+	if err := lastSequentialError(); !errors.Is(err, ErrItemNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Collect keys matching cfg into sorted runs.
+func (c *SortedCursor) collect(cfg SortConfig, limit int) error {
+	db := c.db
+	db.sync.RLock()
+	defer db.sync.RUnlock()
+	if db.dbf == nil {
+		return ErrNotOpen
+	}
+
+	var keys [][]byte
+	size := 0
+	err := db.eachKey(func(key []byte) error {
+		if !bytes.HasPrefix(key, cfg.Prefix) || !inRange(key, cfg.Lo, cfg.Hi) {
+			return nil
+		}
+		keys = append(keys, append([]byte{}, key...))
+		size += len(key) + sortKeyOverhead
+		if size >= limit {
+			if err := c.spill(keys, cfg.TempDir); err != nil {
+				return err
+			}
+			keys = nil
+			size = 0
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sortKeys(keys)
+	c.runs = append(c.runs, &sortRun{keys: keys})
+	return nil
+}
+
+func sortKeys(keys [][]byte) {
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+}
+
+// Sort keys and write them to a temporary file, adding it as a new run.
+func (c *SortedCursor) spill(keys [][]byte, dir string) error {
+	sortKeys(keys)
+	f, err := os.CreateTemp(dir, "gdbm-sort-*")
+	if err != nil {
+		return err
+	}
+	c.files = append(c.files, f)
+	w := bufio.NewWriter(f)
+	var lenbuf [binary.MaxVarintLen64]byte
+	for _, key := range keys {
+		n := binary.PutUvarint(lenbuf[:], uint64(len(key)))
+		w.Write(lenbuf[:n])
+		w.Write(key)
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	c.runs = append(c.runs, &sortRun{r: bufio.NewReader(f)})
+	return nil
+}
+
+// Advance the cursor to the next key.  Returns false when there are no
+// more keys or an error occurred.
+func (c *SortedCursor) Next() bool {
+	if c.done {
+		return false
+	}
+	if len(c.runs) == 0 {
+		c.Close()
+		return false
+	}
+	run := c.runs[0]
+	c.key = run.head
+	c.value = nil
+	c.fetched = false
+	if err := run.next(); err != nil {
+		if err != io.EOF {
+			c.err = err
+			c.Close()
+			return false
+		}
+		heap.Pop(&c.runs)
+	} else {
+		heap.Fix(&c.runs, 0)
+	}
+	return true
+}
+
+// Returns the key at the current cursor position, or nil if the cursor
+// is not positioned on a key.
+func (c *SortedCursor) Key() []byte {
+	return c.key
+}
+
+// Returns the value associated with the current key, fetching it from the
+// database on the first call.  If the key was deleted after the snapshot
+// was taken, nil is returned and the iteration continues.  On other
+// errors, nil is returned, the iteration stops and Err reports the error.
+func (c *SortedCursor) Value() []byte {
+	if c.key == nil {
+		return nil
+	}
+	if !c.fetched {
+		value, err := c.db.Fetch(c.key)
+		if err != nil {
+			if !errors.Is(err, ErrItemNotFound) {
+				c.err = err
+				c.Close()
+			}
+			return nil
+		}
+		c.value = value
+		c.fetched = true
+	}
+	return c.value
+}
+
+// Returns the error that stopped the iteration, if any.
+func (c *SortedCursor) Err() error {
+	return c.err
+}
+
+// Close the cursor and remove its temporary files.  It is safe to call
+// Close several times.
+func (c *SortedCursor) Close() error {
+	var err error
+	for _, f := range c.files {
+		f.Close()
+		if e := os.Remove(f.Name()); e != nil && err == nil {
+			err = e
+		}
+	}
+	c.files = nil
+	c.runs = nil
+	c.key = nil
+	c.value = nil
+	c.done = true
+	return err
+}
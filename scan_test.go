@@ -0,0 +1,189 @@
+package gdbm
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Collect keys visited by the cursor, checking their values.
+func cursorKeys(t *testing.T, c interface{ Next() bool; Key() []byte; Value() []byte; Err() error }) []string {
+	t.Helper()
+	var res []string
+	for c.Next() {
+		key := string(c.Key())
+		res = append(res, key)
+		if n := keyIndex(key); n == -1 || string(c.Value()) != strconv.Itoa(n) {
+			t.Errorf("Wrong value for %q: %q", key, c.Value())
+		}
+	}
+	if err := c.Err(); err != nil {
+		t.Error("iterating failed: ", err)
+	}
+	return res
+}
+
+func keyIndex(key string) int {
+	for i, k := range keys {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestScanPrefix(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	c := db.ScanPrefix([]byte("t"))
+	defer c.Close()
+	res := cursorKeys(t, c)
+	sort.Strings(res)
+	if strings.Join(res, " ") != "ten three two" {
+		t.Errorf("Unexpected keys: %v", res)
+	}
+
+	c = db.ScanPrefix([]byte("x"))
+	if res = cursorKeys(t, c); len(res) != 0 {
+		t.Errorf("Unexpected keys: %v", res)
+	}
+}
+
+func TestScanRange(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	for _, tc := range []struct {
+		lo, hi string
+		expect string
+	}{
+		{"f", "s", "five four nine one"},
+		{"", "f", "eight"},
+		{"three", "", "three two"},
+		{"", "", "eight five four nine one seven six ten three two"},
+		{"s", "f", ""},
+	} {
+		var lo, hi []byte
+		if tc.lo != "" {
+			lo = []byte(tc.lo)
+		}
+		if tc.hi != "" {
+			hi = []byte(tc.hi)
+		}
+		c := db.ScanRange(lo, hi)
+		res := cursorKeys(t, c)
+		c.Close()
+		sort.Strings(res)
+		if strings.Join(res, " ") != tc.expect {
+			t.Errorf("[%q, %q): unexpected keys: %v", tc.lo, tc.hi, res)
+		}
+	}
+}
+
+func TestSortedScan(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	db, err := Open(dbname, ModeWriter)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	for _, limit := range []int{0, 1, 100} {
+		dir := t.TempDir()
+		for _, tc := range []struct {
+			cfg SortConfig
+			expect string
+		}{
+			{SortConfig{}, "eight five four nine one seven six ten three two"},
+			{SortConfig{Prefix: []byte("t")}, "ten three two"},
+			{SortConfig{Lo: []byte("f"), Hi: []byte("s")}, "five four nine one"},
+			{SortConfig{Prefix: []byte("f"), Lo: []byte("fo")}, "four"},
+			{SortConfig{Prefix: []byte("x")}, ""},
+		} {
+			tc.cfg.MemoryLimit = limit
+			tc.cfg.TempDir = dir
+			c, err := db.SortedScan(tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res := cursorKeys(t, c)
+			if err := c.Close(); err != nil {
+				t.Error(err)
+			}
+			if strings.Join(res, " ") != tc.expect {
+				t.Errorf("limit %d: unexpected keys: %v", limit, res)
+			}
+			if ents, _ := os.ReadDir(dir); len(ents) != 0 {
+				t.Errorf("limit %d: %d temporary files left", limit, len(ents))
+			}
+		}
+	}
+}
+
+func TestSortedScanSnapshot(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	db, err := Open(dbname, ModeWriter)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	defer db.Close()
+
+	c, err := db.SortedScan(SortConfig{MemoryLimit: 1, TempDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	db.Delete([]byte("five"))
+	db.Store([]byte("zero"), []byte("z"), false)
+
+	var res []string
+	for c.Next() {
+		res = append(res, string(c.Key()))
+		if string(c.Key()) == "five" {
+			if c.Value() != nil {
+				t.Error("Value returned for deleted key")
+			}
+		} else if c.Value() == nil {
+			t.Errorf("No value for %q", c.Key())
+		}
+	}
+	if err := c.Err(); err != nil {
+		t.Error("iterating failed: ", err)
+	}
+	if strings.Join(res, " ") != "eight five four nine one seven six ten three two" {
+		t.Errorf("unexpected keys: %v", res)
+	}
+}
+
+func TestSortedScanNotOpen(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal("Can't open the database:", err)
+	}
+	db.Close()
+	if _, err := db.SortedScan(SortConfig{}); err != ErrNotOpen {
+		t.Errorf("SortedScan returned %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package shell
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Split the command line into words.  Words are separated by whitespace.
+// A word in double quotes can contain Go escape sequences (e.g. "\x00").
+// Words in single quotes are taken literally.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	i := 0
+	for {
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+		switch line[i] {
+		case '"':
+			j := i + 1
+			for j < len(line) && line[j] != '"' {
+				if line[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(line) {
+				return nil, errors.New("unterminated string")
+			}
+			s, err := strconv.Unquote(line[i:j+1])
+			if err != nil {
+				return nil, errors.New("bad string: " + line[i:j+1])
+			}
+			args = append(args, s)
+			i = j + 1
+		case '\'':
+			j := strings.IndexByte(line[i+1:], '\'')
+			if j < 0 {
+				return nil, errors.New("unterminated string")
+			}
+			args = append(args, line[i+1:i+1+j])
+			i += j + 2
+		default:
+			j := i
+			for j < len(line) && line[j] != ' ' && line[j] != '\t' {
+				j++
+			}
+			args = append(args, line[i:j])
+			i = j
+		}
+	}
+}
+
+// Returns true if data is valid UTF-8 consisting of printable characters.
+func printable(data []byte) bool {
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size <= 1 {
+			return false
+		}
+		if !unicode.IsPrint(r) {
+			return false
+		}
+		data = data[size:]
+	}
+	return true
+}
+
+// Format data according to the display mode.
+func (sh *Shell) format(data []byte) string {
+	switch sh.display {
+	case DisplayHex:
+		var sb strings.Builder
+		for i, b := range data {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(hex.EncodeToString([]byte{b}))
+		}
+		return sb.String()
+	case DisplayJSON:
+		if json.Valid(data) {
+			var buf bytes.Buffer
+			if json.Indent(&buf, data, "", "  ") == nil {
+				return buf.String()
+			}
+		}
+		if printable(data) {
+			s, _ := json.Marshal(string(data))
+			return string(s)
+		}
+		return strconv.Quote(string(data))
+	default:
+		if printable(data) {
+			return string(data)
+		}
+		return strconv.Quote(string(data))
+	}
+}
@@ -0,0 +1,281 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"github.com/graygnuorg/go-gdbm"
+)
+
+type command struct {
+	args string
+	// Argument synopsis.
+	descr string
+	// Short description.
+	minArgs int
+	maxArgs int
+	// Allowed number of arguments.  Negative maxArgs means unlimited.
+	handler func(sh *Shell, args []string) error
+	// Command handler.  Nil for "quit".
+}
+
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		"open": {"[-r|-w|-c|-n] FILE [NAME]", "open database and make it current", 1, 3, (*Shell).cmdOpen},
+		"close": {"[NAME]", "close the current or named database", 0, 1, (*Shell).cmdClose},
+		"use": {"NAME", "make the named database current", 1, 1, (*Shell).cmdUse},
+		"databases": {"", "list open databases", 0, 0, (*Shell).cmdDatabases},
+		"get": {"KEY", "print the value of KEY", 1, 1, (*Shell).cmdGet},
+		"put": {"KEY VALUE", "store VALUE under KEY", 2, 2, (*Shell).cmdPut},
+		"insert": {"KEY VALUE", "store VALUE under KEY, unless it exists", 2, 2, (*Shell).cmdInsert},
+		"delete": {"KEY...", "delete keys", 1, -1, (*Shell).cmdDelete},
+		"list": {"[PREFIX]", "list records whose keys begin with PREFIX", 0, 1, (*Shell).cmdList},
+		"keys": {"[PREFIX]", "list keys beginning with PREFIX", 0, 1, (*Shell).cmdKeys},
+		"count": {"", "print the number of records", 0, 0, (*Shell).cmdCount},
+		"stat": {"", "print information about the current database", 0, 0, (*Shell).cmdStat},
+		"display": {"[string|hex|json]", "set or show the display mode", 0, 1, (*Shell).cmdDisplay},
+		"history": {"", "show command history", 0, 0, (*Shell).cmdHistory},
+		"help": {"", "show this help", 0, 0, (*Shell).cmdHelp},
+		"quit": {"", "quit the shell", 0, 0, nil},
+	}
+	commands["exit"] = commands["quit"]
+}
+
+var openModes = map[string]int{
+	"-r": gdbm.ModeReader,
+	"-w": gdbm.ModeWriter,
+	"-c": gdbm.ModeWrcreat,
+	"-n": gdbm.ModeNewdb,
+}
+
+func (sh *Shell) cmdOpen(args []string) error {
+	mode := gdbm.ModeReader
+	if m, ok := openModes[args[0]]; ok {
+		mode = m
+		args = args[1:]
+	}
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("usage: open " + commands["open"].args)
+	}
+	name := ""
+	if len(args) == 2 {
+		name = args[1]
+	}
+	return sh.Open(args[0], mode, name)
+}
+
+func (sh *Shell) cmdClose(args []string) error {
+	name := sh.current
+	if len(args) > 0 {
+		name = args[0]
+	}
+	if _, ok := sh.dbs[name]; !ok {
+		if name == "" {
+			return errors.New("no database is open")
+		}
+		return fmt.Errorf("database %q is not open", name)
+	}
+	return sh.closeDB(name)
+}
+
+func (sh *Shell) cmdUse(args []string) error {
+	if _, ok := sh.dbs[args[0]]; !ok {
+		return fmt.Errorf("database %q is not open", args[0])
+	}
+	sh.current = args[0]
+	return nil
+}
+
+func (sh *Shell) cmdDatabases(args []string) error {
+	for _, name := range sh.names() {
+		mark := " "
+		if name == sh.current {
+			mark = "*"
+		}
+		fname, _ := sh.dbs[name].FileName()
+		fmt.Fprintf(sh.Out, "%s %s\t%s\n", mark, name, fname)
+	}
+	return nil
+}
+
+func (sh *Shell) cmdGet(args []string) error {
+	db, err := sh.db()
+	if err != nil {
+		return err
+	}
+	value, err := db.Fetch([]byte(args[0]))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(sh.Out, sh.format(value))
+	return nil
+}
+
+func (sh *Shell) store(args []string, replace bool) error {
+	db, err := sh.db()
+	if err != nil {
+		return err
+	}
+	return db.Store([]byte(args[0]), []byte(args[1]), replace)
+}
+
+func (sh *Shell) cmdPut(args []string) error {
+	return sh.store(args, true)
+}
+
+func (sh *Shell) cmdInsert(args []string) error {
+	return sh.store(args, false)
+}
+
+func (sh *Shell) cmdDelete(args []string) error {
+	db, err := sh.db()
+	if err != nil {
+		return err
+	}
+	for _, key := range args {
+		if err := db.Delete([]byte(key)); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Call fn for each key beginning with prefix.
+func (sh *Shell) scan(args []string, fn func(db *gdbm.Database, key []byte) error) error {
+	db, err := sh.db()
+	if err != nil {
+		return err
+	}
+	var prefix []byte
+	if len(args) > 0 {
+		prefix = []byte(args[0])
+	}
+	next := db.Iterator()
+	for {
+		key, err := next()
+		if err != nil {
+			if errors.Is(err, gdbm.ErrItemNotFound) {
+				return nil
+			}
+			return err
+		}
+		if bytes.HasPrefix(key, prefix) {
+			if err := fn(db, key); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (sh *Shell) cmdList(args []string) error {
+	return sh.scan(args, func(db *gdbm.Database, key []byte) error {
+		value, err := db.Fetch(key)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(sh.Out, "%s => %s\n", sh.format(key), sh.format(value))
+		return nil
+	})
+}
+
+func (sh *Shell) cmdKeys(args []string) error {
+	return sh.scan(args, func(db *gdbm.Database, key []byte) error {
+		fmt.Fprintln(sh.Out, sh.format(key))
+		return nil
+	})
+}
+
+func (sh *Shell) cmdCount(args []string) error {
+	db, err := sh.db()
+	if err != nil {
+		return err
+	}
+	n, err := db.Count()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(sh.Out, n)
+	return nil
+}
+
+func (sh *Shell) cmdStat(args []string) error {
+	db, err := sh.db()
+	if err != nil {
+		return err
+	}
+	fname, err := db.FileName()
+	if err != nil {
+		return err
+	}
+	count, err := db.Count()
+	if err != nil {
+		return err
+	}
+	numsync, err := db.IsNumsync()
+	if err != nil && !errors.Is(err, gdbm.ErrNotImplemented) {
+		return err
+	}
+	fmt.Fprintf(sh.Out, "File name:      %s\n", fname)
+	fmt.Fprintf(sh.Out, "Record count:   %d\n", count)
+	fmt.Fprintf(sh.Out, "Numsync format: %t\n", numsync)
+	fmt.Fprintf(sh.Out, "Needs recovery: %t\n", db.NeedsRecovery())
+	fmt.Fprintf(sh.Out, "GDBM version:   %s\n", gdbm.VersionString())
+	return nil
+}
+
+func (sh *Shell) cmdDisplay(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(sh.Out, displayModeNames[sh.display])
+		return nil
+	}
+	for i, name := range displayModeNames {
+		if args[0] == name {
+			sh.display = i
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown display mode %q", args[0])
+}
+
+func (sh *Shell) cmdHistory(args []string) error {
+	for i, line := range sh.history {
+		fmt.Fprintf(sh.Out, "%4d  %s\n", i + 1, line)
+	}
+	return nil
+}
+
+func (sh *Shell) cmdHelp(args []string) error {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Fprintf(sh.Out, "%-30s %s\n", strings.TrimSpace(name + " " + cmd.args), cmd.descr)
+	}
+	fmt.Fprintln(sh.Out, `
+Arguments in double quotes can contain Go escape sequences, e.g. "\x00".
+Arguments in single quotes are taken literally.`)
+	return nil
+}
@@ -0,0 +1,322 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+// Package shell implements an interactive shell for exploring GDBM
+// databases.  Several databases can be open at the same time, one of
+// them being current.  Keys and values are displayed as strings, in hex
+// or as JSON.
+//
+// Example:
+//
+//	sh := shell.New(os.Stdout)
+//	defer sh.Close()
+//	sh.HistoryFile = filepath.Join(os.Getenv("HOME"), ".gogdbm_history")
+//	err := sh.RunTerminal(os.Stdin)
+//
+// Type "help" at the shell prompt for the list of commands.
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"github.com/graygnuorg/go-gdbm"
+	"golang.org/x/term"
+)
+
+// Display modes.
+const (
+	DisplayString = iota
+	DisplayHex
+	DisplayJSON
+)
+
+var displayModeNames = []string{"string", "hex", "json"}
+
+// Shell is an interactive GDBM shell.
+type Shell struct {
+	Out io.Writer
+	// Where to write the output.
+	HistoryFile string
+	// If not empty, the command history is loaded from and saved to
+	// this file.
+	Prompt string
+	// Prompt to display.  Defaults to "gdbm> ".
+
+	dbs map[string]*gdbm.Database
+	// Open databases, indexed by name.
+	current string
+	// Name of the current database.
+	display int
+	// Display mode.
+	history []string
+	// Command history.
+}
+
+// New returns a new shell writing its output to out.
+func New(out io.Writer) *Shell {
+	return &Shell{Out: out, dbs: make(map[string]*gdbm.Database)}
+}
+
+// Close closes all open databases.
+func (sh *Shell) Close() error {
+	var err error
+	for _, name := range sh.names() {
+		if e := sh.closeDB(name); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Returns the sorted list of open database names.
+func (sh *Shell) names() []string {
+	var names []string
+	for name := range sh.dbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (sh *Shell) closeDB(name string) error {
+	db := sh.dbs[name]
+	delete(sh.dbs, name)
+	if sh.current == name {
+		sh.current = ""
+	}
+	return db.Close()
+}
+
+// Open opens the database file in the given mode (see gdbm.Open) and
+// makes it current.  If name is empty, the base name of the file is used
+// to refer to the database in the shell.
+func (sh *Shell) Open(filename string, mode int, name string) error {
+	if name == "" {
+		name = filepath.Base(filename)
+	}
+	if _, ok := sh.dbs[name]; ok {
+		return fmt.Errorf("database %q is already open", name)
+	}
+	db, err := gdbm.Open(filename, mode)
+	if err != nil {
+		return err
+	}
+	sh.dbs[name] = db
+	sh.current = name
+	return nil
+}
+
+// Returns the current database.
+func (sh *Shell) db() (*gdbm.Database, error) {
+	if sh.current == "" {
+		return nil, errors.New("no database is open (use \"open\")")
+	}
+	return sh.dbs[sh.current], nil
+}
+
+func (sh *Shell) prompt() string {
+	if sh.Prompt != "" {
+		return sh.Prompt
+	}
+	if sh.current != "" {
+		return "gdbm:" + sh.current + "> "
+	}
+	return "gdbm> "
+}
+
+// Load history from HistoryFile.
+func (sh *Shell) loadHistory() {
+	if sh.HistoryFile == "" {
+		return
+	}
+	f, err := os.Open(sh.HistoryFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		sh.history = append(sh.history, sc.Text())
+	}
+	if len(sh.history) > maxHistory {
+		sh.history = sh.history[len(sh.history) - maxHistory:]
+	}
+}
+
+const maxHistory = 1000
+
+// Number of entries kept by the history of the terminal line editor.
+const termHistorySize = 100
+
+// Reads the seed first, then from rw.  Output is discarded while the seed
+// is being read.
+type seedReadWriter struct {
+	seed io.Reader
+	rw io.ReadWriter
+}
+
+func (s *seedReadWriter) Read(p []byte) (int, error) {
+	if s.seed != nil {
+		return s.seed.Read(p)
+	}
+	return s.rw.Read(p)
+}
+
+func (s *seedReadWriter) Write(p []byte) (int, error) {
+	if s.seed != nil {
+		return len(p), nil
+	}
+	return s.rw.Write(p)
+}
+
+// Create a terminal line editor on rw, with the shell history available
+// for recall.  The editor fills its history only with the lines it reads,
+// so the history lines are fed to it as input, with the output discarded.
+func (sh *Shell) newTerminal(rw io.ReadWriter) *term.Terminal {
+	var lines []string
+	for _, line := range sh.history {
+		// Control characters would be taken for editing keys.
+		if line != "" && strings.IndexFunc(line, unicode.IsControl) == -1 {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > termHistorySize {
+		lines = lines[len(lines) - termHistorySize:]
+	}
+	var seed bytes.Buffer
+	for _, line := range lines {
+		seed.WriteString(line)
+		seed.WriteByte('\r')
+	}
+	c := &seedReadWriter{seed: &seed, rw: rw}
+	t := term.NewTerminal(c, "")
+	for range lines {
+		if _, err := t.ReadLine(); err != nil {
+			break
+		}
+	}
+	c.seed = nil
+	t.SetPrompt(sh.prompt())
+	return t
+}
+
+// Record the command in history.
+func (sh *Shell) addHistory(line string) {
+	if len(sh.history) > 0 && sh.history[len(sh.history)-1] == line {
+		return
+	}
+	sh.history = append(sh.history, line)
+	if sh.HistoryFile != "" {
+		f, err := os.OpenFile(sh.HistoryFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err == nil {
+			fmt.Fprintln(f, line)
+			f.Close()
+		}
+	}
+}
+
+// Exec executes a single command line.  Returns true if the shell
+// should exit.
+func (sh *Shell) Exec(line string) (quit bool, err error) {
+	args, err := splitArgs(line)
+	if err != nil || len(args) == 0 {
+		return false, err
+	}
+	name := args[0]
+	cmd, ok := commands[name]
+	if !ok {
+		return false, fmt.Errorf("unknown command %q (type \"help\" for help)", name)
+	}
+	if len(args) - 1 < cmd.minArgs || (cmd.maxArgs >= 0 && len(args) - 1 > cmd.maxArgs) {
+		return false, fmt.Errorf("usage: %s %s", name, cmd.args)
+	}
+	if cmd.handler == nil {
+		return true, nil
+	}
+	return false, cmd.handler(sh, args[1:])
+}
+
+// Execute the line and report errors.  Returns true if the shell should
+// exit.
+func (sh *Shell) execLine(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return false
+	}
+	sh.addHistory(line)
+	quit, err := sh.Exec(line)
+	if err != nil {
+		fmt.Fprintf(sh.Out, "error: %v\n", err)
+	}
+	return quit
+}
+
+// Run reads commands from r and executes them, until end of input or
+// the "quit" command.  No prompt is displayed.
+func (sh *Shell) Run(r io.Reader) error {
+	sh.loadHistory()
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1024 * 1024)
+	for sc.Scan() {
+		if sh.execLine(sc.Text()) {
+			break
+		}
+	}
+	return sc.Err()
+}
+
+// RunTerminal runs the shell interactively, with line editing and
+// history, if f is a terminal.  Otherwise, it is the same as Run.
+// Output is written to f as well.
+func (sh *Shell) RunTerminal(f *os.File) error {
+	fd := int(f.Fd())
+	if !term.IsTerminal(fd) {
+		return sh.Run(f)
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	sh.loadHistory()
+	t := sh.newTerminal(f)
+	out := sh.Out
+	sh.Out = t
+	defer func() { sh.Out = out }()
+	for {
+		t.SetPrompt(sh.prompt())
+		line, err := t.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				fmt.Fprintln(t)
+				return nil
+			}
+			return err
+		}
+		if sh.execLine(line) {
+			return nil
+		}
+	}
+}
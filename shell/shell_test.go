@@ -0,0 +1,173 @@
+package shell
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"github.com/graygnuorg/go-gdbm"
+)
+
+func runScript(t *testing.T, sh *Shell, script string) string {
+	t.Helper()
+	var out bytes.Buffer
+	sh.Out = &out
+	if err := sh.Run(strings.NewReader(script)); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestSplitArgs(t *testing.T) {
+	for _, tc := range []struct{
+		line string
+		args []string
+	}{
+		{"", nil},
+		{"get key", []string{"get", "key"}},
+		{"  put  'a b'  \"c\\x00d\"  ", []string{"put", "a b", "c\x00d"}},
+		{`put "say \"hi\"" ''`, []string{"put", `say "hi"`, ""}},
+	} {
+		args, err := splitArgs(tc.line)
+		if err != nil {
+			t.Errorf("%q: %v", tc.line, err)
+		} else if !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("%q: expected %q, got %q", tc.line, tc.args, args)
+		}
+	}
+	for _, line := range []string{`get "abc`, `get 'abc`, `get "\q"`} {
+		if _, err := splitArgs(line); err == nil {
+			t.Errorf("%q: expected error", line)
+		}
+	}
+}
+
+func TestShell(t *testing.T) {
+	dir := t.TempDir()
+	db1 := filepath.Join(dir, "one.gdbm")
+	db2 := filepath.Join(dir, "two.gdbm")
+	sh := New(nil)
+	sh.HistoryFile = filepath.Join(dir, "history")
+	defer sh.Close()
+
+	out := runScript(t, sh, `
+open -n ` + db1 + `
+put user:1 alice
+put user:2 bob
+put group:1 '{"name":"staff","gid":50}'
+put bin "\x00\x01"
+insert user:1 carol
+get user:1
+count
+open -n ` + db2 + ` second
+put k v
+count
+use one.gdbm
+get user:2
+`)
+	expected := `error: Cannot replace
+alice
+4
+1
+bob
+`
+	if out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+
+	out = runScript(t, sh, "keys user:\n")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	sort.Strings(lines)
+	if !reflect.DeepEqual(lines, []string{"user:1", "user:2"}) {
+		t.Errorf("keys returned %q", out)
+	}
+
+	out = runScript(t, sh, "list group:\ndisplay json\nlist group:\ndisplay hex\nget bin\nlist user:1\ndisplay\ndisplay string\nget bin\n")
+	expected = `group:1 => {"name":"staff","gid":50}
+"group:1" => {
+  "name": "staff",
+  "gid": 50
+}
+00 01
+75 73 65 72 3a 31 => 61 6c 69 63 65
+hex
+"\x00\x01"
+`
+	if out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+
+	out = runScript(t, sh, "stat\n")
+	for _, s := range []string{
+		"File name:      " + db1 + "\n",
+		"Record count:   4\n",
+		"Numsync format: false\n",
+		"Needs recovery: false\n",
+		"GDBM version:   " + gdbm.VersionString() + "\n",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("stat output doesn't contain %q: %q", s, out)
+		}
+	}
+
+	out = runScript(t, sh, "databases\nclose\ndatabases\nget user:1\nuse second\nget k\nclose second\nclose\n")
+	expected = "* one.gdbm\t" + db1 + "\n  second\t" + db2 + "\n" +
+		"  second\t" + db2 + "\n" +
+		"error: no database is open (use \"open\")\n" +
+		"v\n" +
+		"error: no database is open\n"
+	if out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+
+	out = runScript(t, sh, "frob\nget\ndelete\nquit\nget x\n")
+	expected = "error: unknown command \"frob\" (type \"help\" for help)\n" +
+		"error: usage: get KEY\n" +
+		"error: usage: delete KEY...\n"
+	if out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+
+	// History is saved and reloaded
+	hist, err := os.ReadFile(sh.HistoryFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(hist), "get\ndelete\nquit\n") {
+		t.Errorf("Bad history file: %q", hist)
+	}
+	sh2 := New(nil)
+	sh2.HistoryFile = sh.HistoryFile
+	out = runScript(t, sh2, "history\n")
+	if !strings.Contains(out, "   1  open -n " + db1 + "\n") || !strings.HasSuffix(out, "  history\n") {
+		t.Errorf("Bad history: %q", out)
+	}
+}
+
+func TestTermHistory(t *testing.T) {
+	sh := New(nil)
+	sh.HistoryFile = filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(sh.HistoryFile, []byte("list\ncount\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sh.loadHistory()
+
+	// Two up-arrow presses recall the next to last line.
+	var out bytes.Buffer
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader("\x1b[A\x1b[A\r"), &out}
+	tm := sh.newTerminal(rw)
+	line, err := tm.ReadLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "list" {
+		t.Errorf("Expected %q, got %q", "list", line)
+	}
+}
@@ -0,0 +1,268 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+// Package sqldriver implements a database/sql driver for GDBM databases.
+// It registers itself under the name "gdbm":
+//
+//	import (
+//		"database/sql"
+//		_ "github.com/graygnuorg/go-gdbm/sqldriver"
+//	)
+//
+//	db, err := sql.Open("gdbm", "/var/db/data.gdbm?mode=wrcreat")
+//
+// The driver understands a tiny query language.  Statements consist of a
+// verb followed by optional arguments, separated by whitespace or commas.
+// An argument is either a placeholder (?), a string in single quotes
+// (two consecutive quotes stand for a literal quote), or a bare word:
+//
+//	GET key         Return the row (key, value) for the key, if it exists.
+//	PUT key, value  Store the value, replacing the existing one.
+//	DELETE key      Remove the key.  RowsAffected is 0 if it didn't exist.
+//	SCAN [prefix]   Return rows (key, value) for all keys starting with
+//	                prefix, or for all keys, if it is omitted.
+//	COUNT           Return a single row with the number of keys.
+//
+// Verbs are case-insensitive.  GET, SCAN and COUNT are queries, PUT and
+// DELETE must be executed with Exec.  Transactions are not supported.
+//
+// All connections opened with the same DSN share a single database handle,
+// which is closed when the last connection is closed.
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"net/url"
+	"github.com/graygnuorg/go-gdbm"
+)
+
+func init() {
+	sql.Register("gdbm", &Driver{})
+}
+
+var (
+	ErrSyntax = errors.New("gdbm: syntax error")
+	ErrNotQuery = errors.New("gdbm: statement is not a query")
+	ErrNotExec = errors.New("gdbm: statement must be run with Query")
+	ErrTxNotSupported = errors.New("gdbm: transactions are not supported")
+)
+
+// Driver implements driver.Driver and driver.DriverContext.
+type Driver struct{}
+
+// Open opens a connection to the database described by dsn.
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+// OpenConnector parses the dsn and returns a connector for it.
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &connector{driver: d, dsn: dsn, cfg: cfg}, nil
+}
+
+var modeNames = map[string]int{
+	"reader": gdbm.ModeReader,
+	"r": gdbm.ModeReader,
+	"writer": gdbm.ModeWriter,
+	"w": gdbm.ModeWriter,
+	"wrcreat": gdbm.ModeWrcreat,
+	"c": gdbm.ModeWrcreat,
+	"newdb": gdbm.ModeNewdb,
+	"n": gdbm.ModeNewdb,
+}
+
+var flagNames = map[string]int{
+	"nolock": gdbm.OF_NOLOCK,
+	"nommap": gdbm.OF_NOMMAP,
+	"cloexec": gdbm.OF_CLOEXEC,
+	"bsexact": gdbm.OF_BSEXACT,
+	"xverify": gdbm.OF_XVERIFY,
+	"preread": gdbm.OF_PREREAD,
+	"numsync": gdbm.OF_NUMSYNC,
+}
+
+// ParseDSN converts a data source name to the database configuration.
+// The DSN is the database file name, optionally followed by a question
+// mark and a list of parameters in URL query format:
+//
+//	mode             Open mode: reader, writer, wrcreat (default) or newdb.
+//	flags            Comma-separated list of open flags: nolock, nommap,
+//	                 cloexec, bsexact, xverify, preread, numsync.
+//	block_size       Block size for new databases.
+//	file_mode        File mode for new databases, in octal (default 0666).
+//	crash_tolerance  Enable crash tolerance (true or false).
+//
+// Example:
+//
+//	/var/db/data.gdbm?mode=newdb&flags=numsync,nolock&block_size=4096
+func ParseDSN(dsn string) (cfg gdbm.DatabaseConfig, err error) {
+	cfg.Mode = gdbm.ModeWrcreat
+	cfg.FileMode = 0666
+
+	name, query, _ := cut(dsn, "?")
+	if name == "" {
+		return cfg, errors.New("gdbm: empty file name in DSN")
+	}
+	cfg.FileName = name
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return cfg, errors.New("gdbm: bad DSN parameters: " + err.Error())
+	}
+	for key, vals := range params {
+		val := vals[len(vals)-1]
+		switch key {
+		case "mode":
+			mode, ok := modeNames[strings.ToLower(val)]
+			if !ok {
+				return cfg, errors.New("gdbm: unknown mode: " + val)
+			}
+			cfg.Mode = mode
+		case "flags":
+			for _, f := range strings.Split(val, ",") {
+				if f == "" {
+					continue
+				}
+				flag, ok := flagNames[strings.ToLower(f)]
+				if !ok {
+					return cfg, errors.New("gdbm: unknown flag: " + f)
+				}
+				cfg.Flags |= flag
+			}
+		case "block_size":
+			n, e := strconv.Atoi(val)
+			if e != nil || n < 0 {
+				return cfg, errors.New("gdbm: bad block size: " + val)
+			}
+			cfg.BlockSize = n
+		case "file_mode":
+			n, e := strconv.ParseUint(val, 8, 32)
+			if e != nil {
+				return cfg, errors.New("gdbm: bad file mode: " + val)
+			}
+			cfg.FileMode = int(n)
+		case "crash_tolerance":
+			b, e := strconv.ParseBool(val)
+			if e != nil {
+				return cfg, errors.New("gdbm: bad crash_tolerance value: " + val)
+			}
+			cfg.CrashTolerance = b
+		default:
+			return cfg, errors.New("gdbm: unknown DSN parameter: " + key)
+		}
+	}
+	return cfg, nil
+}
+
+// strings.Cut is not available before Go 1.18.
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// Database handle shared by all connections with the same DSN.
+type shared struct {
+	db *gdbm.Database
+	refs int
+}
+
+var (
+	registryMutex sync.Mutex
+	registry = make(map[string]*shared)
+)
+
+type connector struct {
+	driver *Driver
+	dsn string
+	cfg gdbm.DatabaseConfig
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	sh, ok := registry[c.dsn]
+	if !ok {
+		db, err := gdbm.OpenConfig(c.cfg)
+		if err != nil {
+			return nil, err
+		}
+		sh = &shared{db: db}
+		registry[c.dsn] = sh
+	}
+	sh.refs++
+	return &conn{dsn: c.dsn, db: sh.db}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// conn implements driver.Conn.
+type conn struct {
+	dsn string
+	db *gdbm.Database
+}
+
+// DB returns the underlying database.  It can be obtained via
+// sql.Conn.Raw:
+//
+//	conn.Raw(func(c any) error {
+//		db := c.(interface{ DB() *gdbm.Database }).DB()
+//		...
+//	})
+func (c *conn) DB() *gdbm.Database {
+	return c.db
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return parse(c, query)
+}
+
+func (c *conn) Close() error {
+	if c.db == nil {
+		return nil
+	}
+	c.db = nil
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	sh := registry[c.dsn]
+	sh.refs--
+	if sh.refs == 0 {
+		delete(registry, c.dsn)
+		return sh.db.Close()
+	}
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, ErrTxNotSupported
+}
@@ -0,0 +1,213 @@
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sort"
+	"testing"
+	"github.com/graygnuorg/go-gdbm"
+)
+
+func openDB(t *testing.T, params string) *sql.DB {
+	dsn := filepath.Join(t.TempDir(), "junk.gdbm") + params
+	db, err := sql.Open("gdbm", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestParseDSN(t *testing.T) {
+	cfg, err := ParseDSN("/tmp/x.gdbm?mode=newdb&flags=numsync,nolock&block_size=4096&file_mode=0640&crash_tolerance=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := gdbm.DatabaseConfig{
+		FileName: "/tmp/x.gdbm",
+		Mode: gdbm.ModeNewdb,
+		Flags: gdbm.OF_NUMSYNC | gdbm.OF_NOLOCK,
+		BlockSize: 4096,
+		FileMode: 0640,
+		CrashTolerance: true,
+	}
+	if cfg != expected {
+		t.Errorf("Expected %+v, got %+v", expected, cfg)
+	}
+
+	cfg, err = ParseDSN("x.gdbm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Mode != gdbm.ModeWrcreat || cfg.FileMode != 0666 {
+		t.Errorf("Bad defaults: %+v", cfg)
+	}
+
+	for _, dsn := range []string{
+		"",
+		"x.gdbm?mode=bogus",
+		"x.gdbm?flags=nolock,bogus",
+		"x.gdbm?block_size=big",
+		"x.gdbm?file_mode=999",
+		"x.gdbm?crash_tolerance=maybe",
+		"x.gdbm?unknown=1",
+	} {
+		if _, err := ParseDSN(dsn); err == nil {
+			t.Errorf("%q: expected error", dsn)
+		}
+	}
+}
+
+func TestQueries(t *testing.T) {
+	db := openDB(t, "?mode=newdb")
+	db.SetMaxOpenConns(4)
+
+	for k, v := range map[string]string{
+		"user:1": "alice",
+		"user:2": "bob",
+		"group:1": "staff",
+	} {
+		res, err := db.Exec("PUT ?, ?", k, v)
+		if err != nil {
+			t.Fatalf("PUT %s: %v", k, err)
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			t.Errorf("PUT %s: RowsAffected = %d", k, n)
+		}
+	}
+	if _, err := db.Exec("put 'it''s', 42"); err != nil {
+		t.Fatal(err)
+	}
+
+	var key, value string
+	if err := db.QueryRow("GET ?", "user:1").Scan(&key, &value); err != nil {
+		t.Fatal(err)
+	}
+	if key != "user:1" || value != "alice" {
+		t.Errorf("GET returned %q, %q", key, value)
+	}
+	if err := db.QueryRow("get 'it''s'").Scan(&key, &value); err != nil || value != "42" {
+		t.Errorf("GET returned %q, %v", value, err)
+	}
+	if err := db.QueryRow("GET nokey").Scan(&key, &value); !errors.Is(err, sql.ErrNoRows) {
+		t.Error("Unexpected error: ", err)
+	}
+
+	var count int
+	if err := db.QueryRow("COUNT").Scan(&count); err != nil || count != 4 {
+		t.Errorf("COUNT returned %d, %v", count, err)
+	}
+
+	scan := func(query string, args ...interface{}) []string {
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var res []string
+		for rows.Next() {
+			if err := rows.Scan(&key, &value); err != nil {
+				t.Fatal(err)
+			}
+			res = append(res, key + "=" + value)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(res)
+		return res
+	}
+	if res := scan("SCAN ?", "user:"); len(res) != 2 || res[0] != "user:1=alice" || res[1] != "user:2=bob" {
+		t.Errorf("SCAN returned %v", res)
+	}
+	if res := scan("SCAN"); len(res) != 4 {
+		t.Errorf("SCAN returned %v", res)
+	}
+
+	res, err := db.Exec("DELETE ?", "user:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Errorf("DELETE: RowsAffected = %d", n)
+	}
+	res, err = db.Exec("DELETE ?", "user:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 0 {
+		t.Errorf("DELETE: RowsAffected = %d", n)
+	}
+
+	// Several connections share the same database.
+	ctx := context.Background()
+	c1, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	c2, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	if _, err := c1.ExecContext(ctx, "PUT k, v"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c2.QueryRowContext(ctx, "GET k").Scan(&key, &value); err != nil || value != "v" {
+		t.Errorf("GET returned %q, %v", value, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	db := openDB(t, "")
+
+	for _, q := range []string{
+		"",
+		"FROB x",
+		"GET",
+		"GET a b",
+		"PUT a",
+		"COUNT x",
+		"GET 'unterminated",
+	} {
+		if _, err := db.Query(q); !errors.Is(err, ErrSyntax) {
+			t.Errorf("%q: unexpected error %v", q, err)
+		}
+	}
+	if _, err := db.Exec("GET a"); !errors.Is(err, ErrNotExec) {
+		t.Error("Unexpected error: ", err)
+	}
+	if _, err := db.Query("PUT a b"); !errors.Is(err, ErrNotQuery) {
+		t.Error("Unexpected error: ", err)
+	}
+	if _, err := db.Begin(); !errors.Is(err, ErrTxNotSupported) {
+		t.Error("Unexpected error: ", err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "junk.gdbm")
+	gdb, err := gdbm.Open(name, gdbm.ModeNewdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gdb.Store([]byte("a"), []byte("1"), true)
+	gdb.Close()
+
+	db, err := sql.Open("gdbm", name + "?mode=reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("PUT a, 2"); !errors.Is(err, gdbm.ErrReaderCantStore) {
+		t.Error("Unexpected error: ", err)
+	}
+	var key, value string
+	if err := db.QueryRow("GET a").Scan(&key, &value); err != nil || value != "1" {
+		t.Errorf("GET returned %q, %v", value, err)
+	}
+}
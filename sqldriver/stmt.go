@@ -0,0 +1,321 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package sqldriver
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"github.com/graygnuorg/go-gdbm"
+)
+
+// Statement verbs.
+const (
+	verbGet = iota
+	verbPut
+	verbDelete
+	verbScan
+	verbCount
+)
+
+type verbDef struct {
+	code int
+	minArgs int
+	maxArgs int
+	query bool
+}
+
+var verbs = map[string]verbDef{
+	"GET": {verbGet, 1, 1, true},
+	"PUT": {verbPut, 2, 2, false},
+	"DELETE": {verbDelete, 1, 1, false},
+	"SCAN": {verbScan, 0, 1, true},
+	"COUNT": {verbCount, 0, 0, true},
+}
+
+// Statement argument: either a literal or a placeholder.
+type arg struct {
+	literal []byte
+	placeholder int
+	// Ordinal number of the placeholder (0-based), or -1 for literals.
+}
+
+type stmt struct {
+	conn *conn
+	verb verbDef
+	args []arg
+	nplaceholders int
+}
+
+func syntaxError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrSyntax, msg)
+}
+
+// Split the query into tokens.
+func tokenize(query string) (tokens []string, quoted []bool, err error) {
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' || c == ';':
+			i++
+		case c == '\'':
+			var sb strings.Builder
+			i++
+			for {
+				if i == len(query) {
+					return nil, nil, syntaxError("unterminated string")
+				}
+				if query[i] == '\'' {
+					if i+1 < len(query) && query[i+1] == '\'' {
+						sb.WriteByte('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				sb.WriteByte(query[i])
+				i++
+			}
+			tokens = append(tokens, sb.String())
+			quoted = append(quoted, true)
+		default:
+			start := i
+			for i < len(query) && !strings.ContainsRune(" \t\n\r,;'", rune(query[i])) {
+				i++
+			}
+			tokens = append(tokens, query[start:i])
+			quoted = append(quoted, false)
+		}
+	}
+	return
+}
+
+func parse(c *conn, query string) (*stmt, error) {
+	tokens, quoted, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 || quoted[0] {
+		return nil, syntaxError("missing verb")
+	}
+	verb, ok := verbs[strings.ToUpper(tokens[0])]
+	if !ok {
+		return nil, syntaxError("unknown verb " + tokens[0])
+	}
+	s := &stmt{conn: c, verb: verb}
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i] == "?" && !quoted[i] {
+			s.args = append(s.args, arg{placeholder: s.nplaceholders})
+			s.nplaceholders++
+		} else {
+			s.args = append(s.args, arg{literal: []byte(tokens[i]), placeholder: -1})
+		}
+	}
+	if len(s.args) < verb.minArgs || len(s.args) > verb.maxArgs {
+		return nil, syntaxError("wrong number of arguments to " + strings.ToUpper(tokens[0]))
+	}
+	return s, nil
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return s.nplaceholders
+}
+
+// Convert a query argument to bytes.
+func valueBytes(v driver.Value) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case int64:
+		return []byte(strconv.FormatInt(v, 10)), nil
+	case float64:
+		return []byte(strconv.FormatFloat(v, 'g', -1, 64)), nil
+	case bool:
+		return []byte(strconv.FormatBool(v)), nil
+	}
+	return nil, errors.New("gdbm: unsupported argument type")
+}
+
+// Resolve statement arguments.
+func (s *stmt) bind(args []driver.NamedValue) ([][]byte, error) {
+	res := make([][]byte, len(s.args))
+	for i, a := range s.args {
+		if a.placeholder < 0 {
+			res[i] = a.literal
+			continue
+		}
+		var err error
+		if res[i], err = valueBytes(args[a.placeholder].Value); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	res := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		res[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return res
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if s.verb.query {
+		return nil, ErrNotExec
+	}
+	db := s.conn.db
+	if db == nil {
+		return nil, driver.ErrBadConn
+	}
+	vals, err := s.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	switch s.verb.code {
+	case verbPut:
+		if err := db.Store(vals[0], vals[1], true); err != nil {
+			return nil, err
+		}
+	case verbDelete:
+		if err := db.Delete(vals[0]); err != nil {
+			if errors.Is(err, gdbm.ErrItemNotFound) {
+				return driver.RowsAffected(0), nil
+			}
+			return nil, err
+		}
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if !s.verb.query {
+		return nil, ErrNotQuery
+	}
+	db := s.conn.db
+	if db == nil {
+		return nil, driver.ErrBadConn
+	}
+	vals, err := s.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	switch s.verb.code {
+	case verbGet:
+		value, err := db.Fetch(vals[0])
+		if err != nil {
+			if errors.Is(err, gdbm.ErrItemNotFound) {
+				return &listRows{columns: kvColumns}, nil
+			}
+			return nil, err
+		}
+		return &listRows{columns: kvColumns, rows: [][]driver.Value{{vals[0], value}}}, nil
+	case verbCount:
+		n, err := db.Count()
+		if err != nil {
+			return nil, err
+		}
+		return &listRows{columns: []string{"count"}, rows: [][]driver.Value{{int64(n)}}}, nil
+	default:
+		var prefix []byte
+		if len(vals) > 0 {
+			prefix = vals[0]
+		}
+		return &scanRows{cursor: db.CursorContext(ctx), prefix: prefix}, nil
+	}
+}
+
+var kvColumns = []string{"key", "value"}
+
+// Rows computed in advance.
+type listRows struct {
+	columns []string
+	rows [][]driver.Value
+}
+
+func (r *listRows) Columns() []string {
+	return r.columns
+}
+
+func (r *listRows) Close() error {
+	r.rows = nil
+	return nil
+}
+
+func (r *listRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// Rows returned by SCAN.
+type scanRows struct {
+	cursor *gdbm.Cursor
+	prefix []byte
+}
+
+func (r *scanRows) Columns() []string {
+	return kvColumns
+}
+
+func (r *scanRows) Close() error {
+	return r.cursor.Close()
+}
+
+func (r *scanRows) Next(dest []driver.Value) error {
+	for r.cursor.Next() {
+		key := r.cursor.Key()
+		if !bytes.HasPrefix(key, r.prefix) {
+			continue
+		}
+		value := r.cursor.Value()
+		if value == nil {
+			break
+		}
+		dest[0] = key
+		dest[1] = value
+		return nil
+	}
+	if err := r.cursor.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
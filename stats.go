@@ -0,0 +1,170 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+import (
+	"github.com/graygnuorg/go-gdbm/format"
+	"os"
+)
+
+// AvailStat describes an avail block.
+type AvailStat struct {
+	Addr int64
+	// File offset of the block.
+	Size int
+	// Number of slots in the block.
+	Count int
+	// Number of slots in use.
+	Bytes int64
+	// Total size of the free areas listed in the block.
+}
+
+// DatabaseStats describes the layout of the database file.
+type DatabaseStats struct {
+	FileSize int64
+	// Size of the database file, in bytes.
+	BlockSize int
+	// Block size.
+	Numsync bool
+	// True if the database is in extended (numsync) format.
+	NumsyncCount uint32
+	// Number of synchronizations (extended format only).
+	DirSize int
+	// Size of the hash directory, in bytes.
+	DirEntries int
+	// Number of directory entries.
+	DirBits int
+	// Directory depth: number of hash bits used to index the directory.
+	BucketSize int
+	// Size of a bucket, in bytes.
+	BucketElems int
+	// Number of elements in a bucket.
+	Buckets int
+	// Number of buckets.
+	Keys int
+	// Number of bucket elements in use.
+	BucketFill []int
+	// Fill distribution: BucketFill[n] is the number of buckets having
+	// n elements in use.  The slice has BucketElems+1 elements.
+	FillFactor float64
+	// Ratio of the elements in use to the total number of elements in
+	// all buckets.
+	Avail []AvailStat
+	// Avail blocks, starting with the one stored in the file header.
+	BucketAvailEntries int
+	// Number of free areas listed in bucket avail tables.
+	BucketAvailBytes int64
+	// Total size of these areas.
+	WastedBytes int64
+	// Total size of free areas in the file: the sum of the Bytes
+	// fields of Avail and BucketAvailBytes.
+}
+
+// Stats returns statistics describing the database file.  The database is
+// synchronized with its disk file before gathering them, so that the file
+// reflects its current state.  This is a full synchronization: it counts in
+// SyncStats, increments the numsync counter of extended databases and
+// flushes the file to disk.  Stats also holds the exclusive database lock
+// while reading the file, so avoid calling it too often, e.g. from a
+// frequent monitoring poll.  If the file structure is damaged, the returned
+// error is a *CheckProblem (see Check).
+func (db *Database) Stats() (*DatabaseStats, error) {
+	db.sync.Lock()
+	defer db.sync.Unlock()
+	if db.dbf == nil {
+		return nil, ErrNotOpen
+	}
+	return db.layoutStats()
+}
+
+// Gather the database statistics.  The caller must hold the database lock.
+func (db *Database) layoutStats() (*DatabaseStats, error) {
+	if err := db.syncFile(); err != nil {
+		return nil, err
+	}
+	name, err := db.fileName()
+	if err != nil {
+		return nil, err
+	}
+	f, err := format.Open(name)
+	if err != nil {
+		return nil, statsError(err)
+	}
+	defer f.Close()
+
+	h := &f.Header
+	st := &DatabaseStats{
+		BlockSize: h.BlockSize,
+		Numsync: h.Numsync,
+		NumsyncCount: h.NumsyncCount,
+		DirSize: h.DirSize,
+		DirEntries: len(f.Dir),
+		DirBits: h.DirBits,
+		BucketSize: h.BucketSize,
+		BucketElems: h.BucketElems,
+		BucketFill: make([]int, h.BucketElems + 1),
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	st.FileSize = fi.Size()
+
+	for _, addr := range f.BucketAddrs() {
+		b, err := f.ReadBucket(addr)
+		if err != nil {
+			return nil, statsError(err)
+		}
+		st.Buckets++
+		st.Keys += b.Count
+		st.BucketFill[b.Count]++
+		st.BucketAvailEntries += len(b.Avail)
+		for _, e := range b.Avail {
+			st.BucketAvailBytes += int64(e.Size)
+		}
+	}
+	if st.Buckets > 0 {
+		st.FillFactor = float64(st.Keys) / float64(st.Buckets * st.BucketElems)
+	}
+
+	blocks, err := f.AvailBlocks()
+	if err != nil {
+		return nil, statsError(err)
+	}
+	st.WastedBytes = st.BucketAvailBytes
+	for _, blk := range blocks {
+		a := AvailStat{Addr: blk.Addr, Size: blk.Size, Count: blk.Count}
+		for _, e := range blk.Table {
+			a.Bytes += int64(e.Size)
+		}
+		st.Avail = append(st.Avail, a)
+		st.WastedBytes += a.Bytes
+	}
+	return st, nil
+}
+
+// Fragmentation returns the fraction of the file occupied by free areas.
+func (st *DatabaseStats) Fragmentation() float64 {
+	if st.FileSize == 0 {
+		return 0
+	}
+	return float64(st.WastedBytes) / float64(st.FileSize)
+}
+
+func statsError(err error) error {
+	return &CheckProblem{Err: checkError(err), Offset: -1, Message: err.Error()}
+}
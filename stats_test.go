@@ -0,0 +1,154 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	db, err := Open(dbname, ModeWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	st, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Keys != len(keys) {
+		t.Errorf("expected %d keys, got %d", len(keys), st.Keys)
+	}
+	if st.BlockSize <= 0 || st.BucketElems <= 0 || st.Buckets == 0 {
+		t.Errorf("bad stats: %+v", st)
+	}
+	if st.DirEntries != 1 << uint(st.DirBits) {
+		t.Errorf("%d directory entries for depth %d", st.DirEntries, st.DirBits)
+	}
+	if len(st.BucketFill) != st.BucketElems + 1 {
+		t.Fatalf("bad fill distribution length: %d", len(st.BucketFill))
+	}
+	buckets, elems := 0, 0
+	for n, count := range st.BucketFill {
+		buckets += count
+		elems += n * count
+	}
+	if buckets != st.Buckets || elems != st.Keys {
+		t.Errorf("fill distribution doesn't match: %v", st.BucketFill)
+	}
+	if st.FillFactor <= 0 || st.FillFactor > 1 {
+		t.Errorf("bad fill factor: %f", st.FillFactor)
+	}
+	if len(st.Avail) == 0 {
+		t.Error("no avail blocks")
+	}
+	fi, err := os.Stat(dbname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.FileSize != fi.Size() {
+		t.Errorf("file size %d, expected %d", st.FileSize, fi.Size())
+	}
+
+	// Deleting keys creates free areas.
+	for _, k := range keys[:5] {
+		if err := db.Delete([]byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	after, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Keys != len(keys) - 5 {
+		t.Errorf("expected %d keys after delete, got %d", len(keys) - 5, after.Keys)
+	}
+	if after.WastedBytes <= st.WastedBytes {
+		t.Errorf("wasted bytes didn't grow after delete: %d, was %d", after.WastedBytes, st.WastedBytes)
+	}
+	// Each call synchronizes the database.
+	if s := db.SyncStats(); s.Syncs != 2 || s.PendingWrites != 0 {
+		t.Errorf("unexpected sync stats: %+v", s)
+	}
+}
+
+func TestStatsNumsync(t *testing.T) {
+	t.Cleanup(func() {
+		os.Remove(dbname)
+	})
+	db, err := OpenConfig(DatabaseConfig{
+		FileName: dbname,
+		Mode: ModeNewdb,
+		Flags: OF_NUMSYNC,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if numsync, _ := db.IsNumsync(); !numsync {
+		t.Skip("numsync format not supported")
+	}
+	st, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Numsync {
+		t.Error("numsync not reported")
+	}
+	for i := 0; i < 3; i++ {
+		if err := db.Store([]byte(strconv.Itoa(i)), []byte("x"), true); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Sync(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	after, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.NumsyncCount <= st.NumsyncCount {
+		t.Errorf("numsync counter didn't grow: %d, was %d", after.NumsyncCount, st.NumsyncCount)
+	}
+}
+
+func TestStatsBadBucket(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	f := inspectDatabase(t)
+	corruptDatabase(t, f.BucketAddrs()[0], encodeInt(f, 0x7fffffff))
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Stats()
+	if !errors.Is(err, ErrBadBucket) {
+		t.Errorf("expected ErrBadBucket, got %v", err)
+	}
+	db.Close()
+	if _, err = db.Stats(); !errors.Is(err, ErrNotOpen) {
+		t.Errorf("expected ErrNotOpen, got %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+import (
+	"errors"
+)
+
+var (
+	ErrTxDone = errors.New("gdbm: transaction has already finished")
+	// Returned by Tx methods called after the transaction finished.
+)
+
+// Tx is a transaction started by Database.Update.  Its methods operate on
+// the database while recording the previous values of all modified keys,
+// so that the modifications can be undone.
+type Tx struct {
+	db *Database
+	undo []undoRecord
+	// Previous states of the modified keys, in the order they were
+	// first modified.
+	touched map[string]bool
+	// Keys recorded in undo.
+	done bool
+}
+
+// Previous state of a key modified in a transaction.
+type undoRecord struct {
+	key []byte
+	value []byte
+	existed bool
+}
+
+// RollbackError is returned by Update if the transaction failed and some
+// of its modifications could not be undone.  The database is then left in
+// an inconsistent state.
+type RollbackError struct {
+	Err error
+	// Error that caused the rollback.
+	RollbackErr error
+	// First error encountered when undoing modifications.
+}
+
+func (err *RollbackError) Error() string {
+	return err.Err.Error() + " (rollback failed: " + err.RollbackErr.Error() + ")"
+}
+
+func (err *RollbackError) Unwrap() error {
+	return err.Err
+}
+
+// Update runs fn in a transaction.  If fn returns an error or panics,
+// all modifications it made through tx are undone and the error is
+// returned (or the panic is propagated).  Otherwise the modifications
+// remain in effect.
+//
+// The database is locked for the duration of the transaction, so fn must
+// access it only through tx.  Calling other Database methods from fn
+// results in a deadlock.
+//
+// Example:
+//	err := db.Update(func(tx *gdbm.Tx) error {
+//		if err := tx.Delete([]byte("from")); err != nil {
+//			return err
+//		}
+//		return tx.Store([]byte("to"), value, false)
+//	})
+//
+// Update provides atomicity with respect to errors in the running
+// program.  To make the transaction durable as a unit, use UpdateSync.
+func (db *Database) Update(fn func(tx *Tx) error) error {
+	return db.update(fn, false)
+}
+
+// UpdateSync is like Update, but it synchronizes the database with its
+// disk file before running fn, and again after fn completes or its
+// modifications are undone.  Automatic synchronization (see SetSyncMode)
+// is suspended while fn runs, so the database is not synchronized in the
+// middle of the transaction.  If UpdateSync returns nil, the
+// modifications are on disk.
+//
+// If the database was opened in crash tolerance mode (see
+// DatabaseConfig.CrashTolerance), a crash recovers the database to its
+// state as of the last successful synchronization.  A crash while fn runs
+// thus recovers the state before the transaction, and a crash after
+// UpdateSync has returned recovers the state after it.  Without crash
+// tolerance, a crash in the middle of the transaction can leave the disk
+// file in any state.
+func (db *Database) UpdateSync(fn func(tx *Tx) error) error {
+	return db.update(fn, true)
+}
+
+func (db *Database) update(fn func(tx *Tx) error, sync bool) (err error) {
+	db.sync.Lock()
+	defer db.sync.Unlock()
+	if db.dbf == nil {
+		return ErrNotOpen
+	}
+
+	if sync {
+		// Start from a synchronized state.
+		if err = db.syncFile(); err != nil {
+			return
+		}
+		var suspended bool
+		if suspended, err = db.suspendSyncMode(); err != nil {
+			return
+		}
+		if suspended {
+			defer func() {
+				if e := db.resumeSyncMode(); err == nil {
+					err = e
+				}
+			}()
+		}
+	}
+
+	tx := &Tx{db: db, touched: make(map[string]bool)}
+	defer func() {
+		tx.done = true
+		if p := recover(); p != nil {
+			if tx.rollback() == nil && sync {
+				db.syncFile()
+			}
+			panic(p)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		rerr := tx.rollback()
+		if rerr == nil && sync {
+			// Make the rollback durable as well.
+			rerr = db.syncFile()
+		}
+		if rerr != nil {
+			err = &RollbackError{Err: err, RollbackErr: rerr}
+		}
+		return
+	}
+	if sync {
+		err = db.syncFile()
+	}
+	return
+}
+
+// Record the current state of the key, unless it is already recorded.
+func (tx *Tx) save(key []byte) error {
+	if tx.touched[string(key)] {
+		return nil
+	}
+	rec := undoRecord{key: append([]byte{}, key...)}
+	value, err := tx.db.fetch(key)
+	if err == nil {
+		rec.value = value
+		rec.existed = true
+	} else if !errors.Is(err, ErrItemNotFound) {
+		return err
+	}
+	tx.undo = append(tx.undo, rec)
+	tx.touched[string(key)] = true
+	return nil
+}
+
+// Undo the modifications, in reverse order.  Returns the first error
+// encountered.
+func (tx *Tx) rollback() (err error) {
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		rec := tx.undo[i]
+		var e error
+		if rec.existed {
+			e = tx.db.store(rec.key, rec.value, true)
+		} else if e = tx.db.delete(rec.key); errors.Is(e, ErrItemNotFound) {
+			e = nil
+		}
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+	tx.undo = nil
+	return
+}
+
+// Fetch returns the value of the key, reflecting the modifications made
+// in the transaction.
+func (tx *Tx) Fetch(key []byte) ([]byte, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	return tx.db.fetch(key)
+}
+
+// Exists returns true if the key exists.
+func (tx *Tx) Exists(key []byte) bool {
+	if tx.done {
+		return false
+	}
+	return tx.db.exists(key)
+}
+
+// Store the value for the key.  See Database.Store.
+func (tx *Tx) Store(key []byte, value []byte, replace bool) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if err := tx.save(key); err != nil {
+		return err
+	}
+	return tx.db.store(key, value, replace)
+}
+
+// Delete the key.
+func (tx *Tx) Delete(key []byte) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if err := tx.save(key); err != nil {
+		return err
+	}
+	return tx.db.delete(key)
+}
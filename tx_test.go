@@ -0,0 +1,276 @@
+package gdbm
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+var errTest = errors.New("test error")
+
+// Check that the database contains the original records.
+func checkOriginal(t *testing.T, db *Database) {
+	t.Helper()
+	for i, k := range keys {
+		if !expectValue(db, k, string(rune('0' + i))) {
+			t.Errorf("wrong value for %q", k)
+		}
+	}
+	if n, _ := db.Count(); n != uint(len(keys)) {
+		t.Errorf("expected %d keys, found %d", len(keys), n)
+	}
+}
+
+func expectValue(db *Database, key, value string) bool {
+	v, err := db.Fetch([]byte(key))
+	return err == nil && string(v) == value
+}
+
+// Modify the database in tx.
+func modify(t *testing.T, tx *Tx) {
+	t.Helper()
+	if err := tx.Store([]byte("one"), []byte("uno"), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Store([]byte("one"), []byte("eins"), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Delete([]byte("two")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Store([]byte("eleven"), []byte("10"), false); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := tx.Fetch([]byte("one")); err != nil || string(v) != "eins" {
+		t.Errorf("Fetch in transaction returned %q, %v", v, err)
+	}
+	if tx.Exists([]byte("two")) {
+		t.Error("deleted key exists")
+	}
+}
+
+func TestUpdateCommit(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	db, err := Open(dbname, ModeWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var saved *Tx
+	err = db.Update(func(tx *Tx) error {
+		modify(t, tx)
+		saved = tx
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expectValue(db, "one", "eins") || db.Exists([]byte("two")) || !expectValue(db, "eleven", "10") {
+		t.Error("transaction not committed")
+	}
+	if err := saved.Store([]byte("x"), nil, true); err != ErrTxDone {
+		t.Errorf("Store after commit returned %v", err)
+	}
+}
+
+func TestUpdateRollback(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	db, err := Open(dbname, ModeWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *Tx) error {
+		modify(t, tx)
+		return errTest
+	})
+	if err != errTest {
+		t.Errorf("Update returned %v", err)
+	}
+	checkOriginal(t, db)
+	if db.Exists([]byte("eleven")) {
+		t.Error("inserted key not removed")
+	}
+
+	// Errors returned by tx methods roll back the preceding changes.
+	err = db.Update(func(tx *Tx) error {
+		if err := tx.Delete([]byte("three")); err != nil {
+			return err
+		}
+		return tx.Store([]byte("four"), []byte("x"), false)
+	})
+	if !errors.Is(err, ErrCannotReplace) {
+		t.Errorf("Update returned %v", err)
+	}
+	checkOriginal(t, db)
+}
+
+func TestUpdatePanic(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	db, err := Open(dbname, ModeWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	func() {
+		defer func() {
+			if p := recover(); p != errTest {
+				t.Errorf("recovered %v", p)
+			}
+		}()
+		db.Update(func(tx *Tx) error {
+			modify(t, tx)
+			panic(errTest)
+		})
+	}()
+	checkOriginal(t, db)
+}
+
+func TestUpdateReader(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	db, err := Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *Tx) error {
+		return tx.Store([]byte("one"), []byte("x"), true)
+	})
+	if !errors.Is(err, ErrReaderCantStore) {
+		t.Errorf("Update returned %v", err)
+	}
+	checkOriginal(t, db)
+	db.Close()
+	if err := db.Update(func(tx *Tx) error { return nil }); err != ErrNotOpen {
+		t.Errorf("Update on closed database returned %v", err)
+	}
+}
+
+func TestUpdateSync(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	db, err := OpenConfig(DatabaseConfig{FileName: dbname, Mode: ModeWriter, CrashTolerance: true})
+	if err != nil {
+		// Crash tolerance requires reflink support in the file system.
+		t.Log("crash tolerance not available:", err)
+		db, err = Open(dbname, ModeWriter)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		for _, name := range SnapshotNames(dbname) {
+			os.Remove(name)
+		}
+	})
+	err = db.UpdateSync(func(tx *Tx) error {
+		modify(t, tx)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = Open(dbname, ModeReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if !expectValue(db, "one", "eins") || db.Exists([]byte("two")) || !expectValue(db, "eleven", "10") {
+		t.Error("transaction not committed")
+	}
+}
+
+func TestUpdateSyncMode(t *testing.T) {
+	t.Cleanup(func() {
+		os.Remove(dbname)
+	})
+	db, err := OpenConfig(DatabaseConfig{
+		FileName: dbname,
+		Mode: ModeNewdb,
+		Flags: OF_NUMSYNC,
+		SyncMode: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if numsync, _ := db.IsNumsync(); !numsync {
+		t.Skip("numsync format not supported")
+	}
+
+	// Count synchronizations using the numsync counter.  Stats makes
+	// one as well.
+	numsync := func() uint {
+		st, err := db.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return uint(st.NumsyncCount)
+	}
+	store := func(tx *Tx) {
+		if on, _ := tx.db.syncMode(); on {
+			t.Error("sync mode on in transaction")
+		}
+		for _, k := range keys {
+			if err := tx.Store([]byte(k), []byte(k), true); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	n := numsync()
+	if err := db.UpdateSync(func(tx *Tx) error {
+		store(tx)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if m := numsync(); m - n != 3 {
+		t.Errorf("expected 2 synchronizations in commit, got %d", m - n - 1)
+	}
+
+	n = numsync()
+	if err := db.UpdateSync(func(tx *Tx) error {
+		store(tx)
+		return errTest
+	}); err != errTest {
+		t.Fatal(err)
+	}
+	if m := numsync(); m - n != 3 {
+		t.Errorf("expected 2 synchronizations in rollback, got %d", m - n - 1)
+	}
+
+	if on, err := db.SyncMode(); err != nil || !on {
+		t.Errorf("sync mode not restored: %v, %v", on, err)
+	}
+}
+
+func TestUpdateIndex(t *testing.T) {
+	if !createDatabase(t) {
+		return
+	}
+	t.Cleanup(func() { os.Remove(dbname + IndexSuffix) })
+	db := openIndexed(t, ModeWriter)
+	defer db.Close()
+	db.Update(func(tx *Tx) error {
+		modify(t, tx)
+		return errTest
+	})
+	if err := db.CheckIndex(); err != nil {
+		t.Error(err)
+	}
+}
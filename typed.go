@@ -0,0 +1,126 @@
+//go:build go1.18
+
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package gdbm
+
+// Typed provides access to a database whose keys and values are of
+// types K and V.  Keys and values are converted to and from their
+// database representation using the supplied codecs.
+//
+// Example:
+//	users := gdbm.NewTyped[string, User](db, gdbm.StringCodec{}, gdbm.JSONCodec[User]{})
+//	err := users.Put("alice", User{Name: "Alice"})
+//	u, err := users.Get("alice")
+type Typed[K, V any] struct {
+	db *Database
+	keys Codec[K]
+	values Codec[V]
+}
+
+// NewTyped returns a typed wrapper over db.
+func NewTyped[K, V any](db *Database, keys Codec[K], values Codec[V]) *Typed[K, V] {
+	return &Typed[K, V]{db: db, keys: keys, values: values}
+}
+
+// Returns the underlying database.
+func (t *Typed[K, V]) Database() *Database {
+	return t.db
+}
+
+// Get returns the value stored under the key.  If the key does not
+// exist, ErrItemNotFound is returned.
+func (t *Typed[K, V]) Get(key K) (value V, err error) {
+	kb, err := t.keys.Encode(key)
+	if err != nil {
+		return
+	}
+	err = t.db.View(kb, func(data []byte) (err error) {
+		value, err = t.values.Decode(data)
+		return
+	})
+	return
+}
+
+func (t *Typed[K, V]) store(key K, value V, replace bool) error {
+	kb, err := t.keys.Encode(key)
+	if err != nil {
+		return err
+	}
+	vb, err := t.values.Encode(value)
+	if err != nil {
+		return err
+	}
+	return t.db.Store(kb, vb, replace)
+}
+
+// Put stores the value under the key, replacing the existing value, if
+// any.
+func (t *Typed[K, V]) Put(key K, value V) error {
+	return t.store(key, value, true)
+}
+
+// Insert stores the value under the key.  If the key already exists,
+// the database is not modified and ErrCannotReplace is returned.
+func (t *Typed[K, V]) Insert(key K, value V) error {
+	return t.store(key, value, false)
+}
+
+// Delete removes the key.  If the key does not exist, ErrItemNotFound
+// is returned.
+func (t *Typed[K, V]) Delete(key K) error {
+	kb, err := t.keys.Encode(key)
+	if err != nil {
+		return err
+	}
+	return t.db.Delete(kb)
+}
+
+// Has returns true if the key exists in the database.
+func (t *Typed[K, V]) Has(key K) (bool, error) {
+	kb, err := t.keys.Encode(key)
+	if err != nil {
+		return false, err
+	}
+	return t.db.Exists(kb), nil
+}
+
+// Range calls fn for each key/value pair in the database, in unspecified
+// order, until fn returns false.  Returns the first iteration or decoding
+// error.  The database must not be modified while iterating.
+func (t *Typed[K, V]) Range(fn func(key K, value V) bool) error {
+	c := t.db.Cursor()
+	defer c.Close()
+	for c.Next() {
+		key, err := t.keys.Decode(c.Key())
+		if err != nil {
+			return err
+		}
+		data := c.Value()
+		if data == nil {
+			break
+		}
+		value, err := t.values.Decode(data)
+		if err != nil {
+			return err
+		}
+		if !fn(key, value) {
+			break
+		}
+	}
+	return c.Err()
+}
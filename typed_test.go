@@ -0,0 +1,159 @@
+//go:build go1.18
+
+package gdbm
+
+import (
+	"testing"
+	"errors"
+	"encoding/binary"
+	"reflect"
+	"os"
+)
+
+func openTyped[K, V any](t *testing.T, keys Codec[K], values Codec[V]) *Typed[K, V] {
+	db, err := Open(dbname, ModeNewdb)
+	if err != nil {
+		t.Fatal("Can't create the database:", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbname)
+	})
+	return NewTyped(db, keys, values)
+}
+
+func TestTyped(t *testing.T) {
+	tdb := openTyped[string, int64](t, StringCodec{}, BigEndian[int64]{})
+
+	for i, k := range keys {
+		if err := tdb.Insert(k, int64(i) - 5); err != nil {
+			t.Fatalf("Insert %q: %v", k, err)
+		}
+	}
+	if err := tdb.Insert("one", 100); !errors.Is(err, ErrCannotReplace) {
+		t.Error("Unexpected error: ", err)
+	}
+	if err := tdb.Put("one", 100); err != nil {
+		t.Error("Put: ", err)
+	}
+
+	for i, k := range keys {
+		expected := int64(i) - 5
+		if k == "one" {
+			expected = 100
+		}
+		v, err := tdb.Get(k)
+		if err != nil {
+			t.Errorf("Get %q: %v", k, err)
+		} else if v != expected {
+			t.Errorf("Get %q: expected %d, got %d", k, expected, v)
+		}
+	}
+
+	if _, err := tdb.Get("zero"); !errors.Is(err, ErrItemNotFound) {
+		t.Error("Unexpected error: ", err)
+	}
+
+	if ok, err := tdb.Has("two"); err != nil || !ok {
+		t.Error("Has returned ", ok, err)
+	}
+	if err := tdb.Delete("two"); err != nil {
+		t.Error("Delete: ", err)
+	}
+	if err := tdb.Delete("two"); !errors.Is(err, ErrItemNotFound) {
+		t.Error("Unexpected error: ", err)
+	}
+	if ok, err := tdb.Has("two"); err != nil || ok {
+		t.Error("Has returned ", ok, err)
+	}
+
+	seen := make(map[string]int64)
+	err := tdb.Range(func(k string, v int64) bool {
+		seen[k] = v
+		return true
+	})
+	if err != nil {
+		t.Error("Range: ", err)
+	}
+	if len(seen) != len(keys) - 1 || seen["three"] != -3 {
+		t.Errorf("Range returned %v", seen)
+	}
+
+	n := 0
+	tdb.Range(func(string, int64) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("Range didn't stop: %d", n)
+	}
+
+	// Decoding errors are reported
+	tdb.Database().Store([]byte("bad"), []byte{1, 2}, true)
+	if _, err := tdb.Get("bad"); !errors.Is(err, ErrBadIntegerSize) {
+		t.Error("Unexpected error: ", err)
+	}
+	if err := tdb.Range(func(string, int64) bool { return true }); !errors.Is(err, ErrBadIntegerSize) {
+		t.Error("Unexpected error: ", err)
+	}
+}
+
+type codecRecord struct {
+	ID uint32
+	Score int16
+	Tags [2]uint8
+}
+
+func testCodec[T any](t *testing.T, name string, c Codec[T], values ...T) {
+	for _, v := range values {
+		data, err := c.Encode(v)
+		if err != nil {
+			t.Errorf("%s: can't encode %v: %v", name, v, err)
+			continue
+		}
+		res, err := c.Decode(data)
+		if err != nil {
+			t.Errorf("%s: can't decode %v: %v", name, v, err)
+		} else if !reflect.DeepEqual(res, v) {
+			t.Errorf("%s: expected %v, got %v", name, v, res)
+		}
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	rec := codecRecord{ID: 42, Score: -7, Tags: [2]uint8{1, 255}}
+	testCodec[string](t, "string", StringCodec{}, "", "hello")
+	testCodec[[]byte](t, "bytes", BytesCodec{}, []byte{}, []byte{0, 1, 2})
+	testCodec[int8](t, "int8", BigEndian[int8]{}, -128, 0, 127)
+	testCodec[uint16](t, "uint16", BigEndian[uint16]{}, 0, 0xabcd)
+	testCodec[int32](t, "int32", BigEndian[int32]{}, -1, 1 << 30)
+	testCodec[uint64](t, "uint64", BigEndian[uint64]{}, 0, 1 << 63)
+	testCodec[codecRecord](t, "json", JSONCodec[codecRecord]{}, rec)
+	testCodec[map[string]int](t, "gob", GobCodec[map[string]int]{}, map[string]int{"a": 1})
+	testCodec[codecRecord](t, "binary", BinaryCodec[codecRecord]{}, rec)
+	testCodec[codecRecord](t, "binary/le", BinaryCodec[codecRecord]{Order: binary.LittleEndian}, rec)
+
+	data, _ := BigEndian[uint32]{}.Encode(0x01020304)
+	if !reflect.DeepEqual(data, []byte{1, 2, 3, 4}) {
+		t.Errorf("Wrong big-endian encoding: %v", data)
+	}
+	data, _ = BinaryCodec[codecRecord]{}.Encode(rec)
+	if len(data) != 8 {
+		t.Errorf("Wrong binary encoding: %v", data)
+	}
+}
+
+func TestTypedJSON(t *testing.T) {
+	tdb := openTyped[uint32, codecRecord](t, BigEndian[uint32]{}, JSONCodec[codecRecord]{})
+	rec := codecRecord{ID: 1, Score: 10}
+	if err := tdb.Put(rec.ID, rec); err != nil {
+		t.Fatal(err)
+	}
+	res, err := tdb.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != rec {
+		t.Errorf("Expected %v, got %v", rec, res)
+	}
+}
@@ -0,0 +1,150 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// Log file layout
+//
+// The log begins with the magic string, followed by records.  Each record
+// consists of an 8-byte header and payload.  The header contains the
+// CRC-32 checksum of the payload and its length, both as big-endian
+// 32-bit integers.  The payload is a sequence of operations, applied as a
+// unit.  Each operation begins with its code (opPut or opDelete),
+// followed by the uvarint key length and the key.  Put operations then
+// contain the uvarint value length and the value.
+//
+// A record which is incomplete or fails the checksum test marks the end of
+// the log: such records result from a crash while appending to the log,
+// and the corresponding updates were never acknowledged.
+
+const logMagic = "GDBMWAL1"
+
+const recordHeaderSize = 8
+
+// Operation codes.
+const (
+	opPut byte = 1
+	opDelete byte = 2
+)
+
+var errBadRecord = errors.New("malformed log record")
+
+// An operation decoded from the log.
+type logOp struct {
+	code byte
+	key []byte
+	value []byte
+}
+
+// Append an operation to payload.
+func appendOp(payload []byte, code byte, key, value []byte) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	payload = append(payload, code)
+	payload = append(payload, buf[:binary.PutUvarint(buf[:], uint64(len(key)))]...)
+	payload = append(payload, key...)
+	if code == opPut {
+		payload = append(payload, buf[:binary.PutUvarint(buf[:], uint64(len(value)))]...)
+		payload = append(payload, value...)
+	}
+	return payload
+}
+
+// Return the record for the payload.
+func encodeRecord(payload []byte) []byte {
+	rec := make([]byte, recordHeaderSize, recordHeaderSize + len(payload))
+	binary.BigEndian.PutUint32(rec[0:4], crc32.ChecksumIEEE(payload))
+	binary.BigEndian.PutUint32(rec[4:8], uint32(len(payload)))
+	return append(rec, payload...)
+}
+
+// Read a byte slice prefixed with its uvarint length.
+func readBytes(p []byte) ([]byte, []byte, error) {
+	n, l := binary.Uvarint(p)
+	if l <= 0 || n > uint64(len(p) - l) {
+		return nil, nil, errBadRecord
+	}
+	p = p[l:]
+	return p[:n], p[n:], nil
+}
+
+// Decode the operations in payload.
+func decodePayload(payload []byte) ([]logOp, error) {
+	var ops []logOp
+	for len(payload) > 0 {
+		var op logOp
+		var err error
+		op.code = payload[0]
+		if op.key, payload, err = readBytes(payload[1:]); err != nil {
+			return nil, err
+		}
+		switch op.code {
+		case opPut:
+			if op.value, payload, err = readBytes(payload); err != nil {
+				return nil, err
+			}
+		case opDelete:
+		default:
+			return nil, errBadRecord
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// Reads records from the log.
+type logReader struct {
+	r *bufio.Reader
+	off int64
+	// Offset past the last valid record.
+	size int64
+	// Size of the log file.
+}
+
+// Return the payload of the next record.  Returns io.EOF at the end of
+// the valid part of the log.
+func (lr *logReader) next() ([]byte, error) {
+	var hdr [recordHeaderSize]byte
+	if _, err := io.ReadFull(lr.r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	n := int64(binary.BigEndian.Uint32(hdr[4:8]))
+	if n > lr.size - lr.off - recordHeaderSize {
+		return nil, io.EOF
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(lr.r, payload); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(hdr[0:4]) {
+		return nil, io.EOF
+	}
+	lr.off += int64(recordHeaderSize + len(payload))
+	return payload, nil
+}
@@ -0,0 +1,604 @@
+/* go-gdbm - Go interface to the GNU DBM library.
+   Copyright (C) 2022 Sergey Poznyakoff
+
+   go-gdbm is free software; you can redistribute it and/or modify it
+   under the terms of the GNU General Public License as published by the
+   Free Software Foundation; either version 3 of the License, or (at your
+   option) any later version.
+
+   go-gdbm is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License along
+   with go-gdbm. If not, see <http://www.gnu.org/licenses/>. */
+
+// Package wal implements a write-ahead log over GDBM databases.
+//
+// Each update is appended to the log file and flushed to disk.  Only then
+// it is applied to the database and acknowledged, so readers never see
+// updates that are not durable.  If flushing the log fails, the updates
+// waiting for it are removed from the log, reported as failed and never
+// applied.  After a crash, updates recorded in the log are replayed when
+// the database is opened again.  Checkpoints synchronize the database with its disk file
+// and truncate the log.
+//
+// Unlike the crash tolerance mode of GDBM, the write-ahead log does not
+// require file system support for reflink copies.
+//
+// The log records updates, not the database file contents.  It cannot
+// repair a database file left damaged by a crash in the middle of
+// writing it out, e.g. during a checkpoint.  Before replaying the log,
+// Open checks the integrity of the database and returns
+// gdbm.ErrNeedRecovery if it is damaged, leaving the log intact.  The
+// database must then be recovered (see gdbm.Database.Recover) or restored
+// from a backup, after which Open replays the log.
+//
+// Example:
+//
+//	db, err := wal.Open(wal.Config{
+//		Database: gdbm.DatabaseConfig{
+//			FileName: "data.gdbm",
+//			Mode: gdbm.ModeWrcreat,
+//			FileMode: 0644,
+//		},
+//		CheckpointSize: 64 << 20,
+//	})
+//	if err != nil {
+//		panic(err)
+//	}
+//	defer db.Close()
+//	err = db.Store([]byte("key"), []byte("value"), true)
+package wal
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+	"github.com/graygnuorg/go-gdbm"
+)
+
+// Suffix appended to the database file name to obtain the default log
+// file name.
+const LogSuffix = ".wal"
+
+var (
+	ErrBadLog = errors.New("wal: bad log file magic")
+	// The log file is not a write-ahead log.
+	ErrReplayNeeded = errors.New("wal: log must be replayed by opening the database for writing")
+	// Returned when opening a database in ModeReader if its log
+	// contains updates that were not applied to it.
+)
+
+// Config controls opening a database with a write-ahead log.
+type Config struct {
+	Database gdbm.DatabaseConfig
+	// Database configuration.  The CrashTolerance field should not be
+	// set: the log provides crash tolerance itself.
+	LogFile string
+	// Name of the log file.  Defaults to the database file name with
+	// LogSuffix appended.
+	GroupCommitDelay time.Duration
+	// Group commit.  Before flushing the log to disk, wait this long
+	// for more updates to arrive from concurrent writers, so that they
+	// can be flushed together.  This increases throughput at the cost
+	// of latency.  With zero delay, updates that arrive while the log is
+	// being flushed are still flushed together.
+	CheckpointSize int64
+	// If positive, a checkpoint is made whenever the log grows larger
+	// than this number of bytes.
+	LogMode os.FileMode
+	// Permissions of the log file, if it is created.  Defaults to 0600.
+}
+
+// DB is a database with a write-ahead log.  It implements gdbm.KV.  All
+// updates must be made through DB; updates made directly to the
+// underlying database are not logged.
+type DB struct {
+	db *gdbm.Database
+	log *os.File
+	// Log file; nil if the database is read-only.
+	cfg Config
+	replayed int
+	// Number of log records replayed on open.
+
+	mu sync.Mutex
+	// Serializes updates.
+	closed bool
+	size int64
+	// Log file size.
+	pending []pendingRecord
+	// Records appended to the log, but not yet applied to the database.
+	applied uint64
+	// Number of records applied to the database.
+
+	seq uint64
+	// Number of records appended to the log; accessed atomically.
+	cmu sync.Mutex
+	cond *sync.Cond
+	// Group commit state.  The fields below are protected by cmu.
+	durable uint64
+	// Number of records flushed to disk.
+	flushing bool
+	// A writer is flushing the log.
+	err error
+	// Sticky error of flushing the log.
+}
+
+var _ gdbm.KV = (*DB)(nil)
+
+// A record appended to the log and waiting to be applied.
+type pendingRecord struct {
+	seq uint64
+	off int64
+	// Offset of the record in the log.
+	payload []byte
+}
+
+// Flushes the log file to disk.  Replaced in tests.
+var logSync = (*os.File).Sync
+
+// Open opens the database and its log.  If the log contains records,
+// the database is checked for integrity, the records are applied to it,
+// the database is synchronized, and the log is truncated.  If the check
+// fails, gdbm.ErrNeedRecovery is returned.  If the database mode is
+// ModeNewdb, the log is truncated without replaying.  Databases opened in
+// ModeReader don't use the log: if it contains records, ErrReplayNeeded is
+// returned.
+func Open(cfg Config) (*DB, error) {
+	db, err := gdbm.OpenConfig(cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.LogFile == "" {
+		name, err := db.FileName()
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		cfg.LogFile = name + LogSuffix
+	}
+	if cfg.LogMode == 0 {
+		cfg.LogMode = 0600
+	}
+	w := &DB{db: db, cfg: cfg}
+	w.cond = sync.NewCond(&w.cmu)
+	if cfg.Database.Mode == gdbm.ModeReader {
+		err = w.checkLog()
+	} else {
+		err = w.openLog(cfg.Database.Mode == gdbm.ModeNewdb)
+	}
+	if err != nil {
+		if w.log != nil {
+			w.log.Close()
+		}
+		db.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Verify that the log contains no records.
+func (w *DB) checkLog() error {
+	st, err := os.Stat(w.cfg.LogFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if st.Size() > int64(len(logMagic)) {
+		return ErrReplayNeeded
+	}
+	return nil
+}
+
+// Open the log and replay it, unless truncate is true.
+func (w *DB) openLog(truncate bool) error {
+	f, err := os.OpenFile(w.cfg.LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, w.cfg.LogMode)
+	if err != nil {
+		return err
+	}
+	w.log = f
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if st.Size() == 0 {
+		if _, err = f.WriteString(logMagic); err != nil {
+			return err
+		}
+		w.size = int64(len(logMagic))
+		return logSync(f)
+	}
+	magic := make([]byte, len(logMagic))
+	if _, err = io.ReadFull(f, magic); err != nil || string(magic) != logMagic {
+		return ErrBadLog
+	}
+	if !truncate && st.Size() > int64(len(logMagic)) {
+		// Don't replay into a damaged database.
+		report, err := w.db.Check(gdbm.CheckConfig{})
+		if err != nil {
+			return err
+		}
+		if !report.OK() {
+			return gdbm.ErrNeedRecovery
+		}
+		lr := &logReader{r: bufio.NewReader(f), off: int64(len(logMagic)), size: st.Size()}
+		for {
+			payload, err := lr.next()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+			if err = w.apply(payload); err != nil {
+				return err
+			}
+			w.replayed++
+		}
+		if w.replayed > 0 {
+			if err = w.db.Sync(); err != nil {
+				return err
+			}
+		}
+	}
+	return w.truncate()
+}
+
+// Truncate the log, leaving only the magic string.
+func (w *DB) truncate() error {
+	if err := w.log.Truncate(int64(len(logMagic))); err != nil {
+		return err
+	}
+	w.size = int64(len(logMagic))
+	return logSync(w.log)
+}
+
+// Replayed returns the number of log records that were applied to the
+// database when opening it.  A non-zero value means that the database
+// was not closed properly.
+func (w *DB) Replayed() int {
+	return w.replayed
+}
+
+// Database returns the underlying database.  Updates made directly to it
+// bypass the log.
+func (w *DB) Database() *gdbm.Database {
+	return w.db
+}
+
+// Apply the operations from the payload to the database.
+func (w *DB) apply(payload []byte) error {
+	ops, err := decodePayload(payload)
+	if err != nil {
+		return err
+	}
+	if len(ops) == 1 {
+		return applyOp(w.db, ops[0])
+	}
+	return w.db.Update(func(tx *gdbm.Tx) error {
+		for _, op := range ops {
+			if err := applyOp(tx, op); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Database or transaction, as used by applyOp.
+type storer interface {
+	Store(key []byte, value []byte, replace bool) error
+	Delete(key []byte) error
+}
+
+// Apply the operation.  Operations are idempotent, so that the log can be
+// replayed several times.
+func applyOp(s storer, op logOp) error {
+	if op.code == opPut {
+		return s.Store(op.key, op.value, true)
+	}
+	if err := s.Delete(op.key); err != nil && !errors.Is(err, gdbm.ErrItemNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Log the payload and apply it to the database.  If the database is
+// read-only, readerErr is returned.  If check is not nil, it is called
+// first, and its error, if any, is returned without logging.  Returns
+// when the record is flushed to disk and applied.
+func (w *DB) commit(payload []byte, readerErr error, check func() error) error {
+	w.mu.Lock()
+	for {
+		if w.closed {
+			w.mu.Unlock()
+			return gdbm.ErrNotOpen
+		}
+		if w.log == nil {
+			w.mu.Unlock()
+			return readerErr
+		}
+		if check == nil || len(w.pending) == 0 {
+			break
+		}
+		// The check must see the effect of the records logged
+		// before.
+		seq := atomic.LoadUint64(&w.seq)
+		w.mu.Unlock()
+		if err := w.waitDurable(seq); err != nil {
+			return err
+		}
+		w.mu.Lock()
+	}
+	if check != nil {
+		if err := check(); err != nil {
+			w.mu.Unlock()
+			return err
+		}
+	}
+	w.cmu.Lock()
+	err := w.err
+	w.cmu.Unlock()
+	if err != nil {
+		w.mu.Unlock()
+		return err
+	}
+	rec := encodeRecord(payload)
+	if _, err := w.log.Write(rec); err != nil {
+		// Don't leave a partial record in the log.
+		w.discard(err)
+		w.mu.Unlock()
+		return err
+	}
+	seq := atomic.AddUint64(&w.seq, 1)
+	w.pending = append(w.pending, pendingRecord{seq: seq, off: w.size, payload: payload})
+	w.size += int64(len(rec))
+	w.mu.Unlock()
+	if err = w.waitDurable(seq); err != nil {
+		return err
+	}
+	if w.cfg.CheckpointSize > 0 {
+		w.mu.Lock()
+		if !w.closed && w.size > w.cfg.CheckpointSize {
+			err = w.checkpoint()
+		}
+		w.mu.Unlock()
+	}
+	return err
+}
+
+// Apply the pending records up to seq to the database.  The caller must
+// hold w.mu.
+func (w *DB) applyPending(seq uint64) error {
+	for len(w.pending) > 0 && w.pending[0].seq <= seq {
+		if err := w.apply(w.pending[0].payload); err != nil {
+			return err
+		}
+		w.applied = w.pending[0].seq
+		w.pending = w.pending[1:]
+	}
+	return nil
+}
+
+// Remove the pending records from the log after a failure to write,
+// flush or apply them.  The error becomes sticky, and writers waiting for
+// the records get it.  The caller must hold w.mu.
+func (w *DB) discard(err error) {
+	off := w.size
+	if len(w.pending) > 0 {
+		off = w.pending[0].off
+	}
+	w.pending = nil
+	if w.log.Truncate(off) == nil && logSync(w.log) == nil {
+		w.size = off
+	}
+	w.cmu.Lock()
+	w.err = err
+	w.cond.Broadcast()
+	w.cmu.Unlock()
+}
+
+// Wait until the record seq is flushed to disk and applied.  The first
+// writer to wait flushes the log and applies the records for all writers
+// waiting at the moment.
+func (w *DB) waitDurable(seq uint64) error {
+	w.cmu.Lock()
+	defer w.cmu.Unlock()
+	for w.durable < seq {
+		if w.err != nil {
+			return w.err
+		}
+		if w.flushing {
+			w.cond.Wait()
+			continue
+		}
+		w.flushing = true
+		w.cmu.Unlock()
+		if w.cfg.GroupCommitDelay > 0 {
+			time.Sleep(w.cfg.GroupCommitDelay)
+		}
+		target := atomic.LoadUint64(&w.seq)
+		err := logSync(w.log)
+		w.mu.Lock()
+		if err == nil {
+			err = w.applyPending(target)
+		}
+		if err != nil {
+			w.discard(err)
+		}
+		applied := w.applied
+		w.mu.Unlock()
+		w.cmu.Lock()
+		w.flushing = false
+		if applied > w.durable {
+			w.durable = applied
+		}
+		w.cond.Broadcast()
+	}
+	return nil
+}
+
+// Make a checkpoint.  The caller must hold w.mu.
+func (w *DB) checkpoint() error {
+	if len(w.pending) > 0 {
+		// Flush and apply the records logged so far.
+		err := logSync(w.log)
+		if err == nil {
+			err = w.applyPending(atomic.LoadUint64(&w.seq))
+		}
+		if err != nil {
+			w.discard(err)
+			return err
+		}
+	}
+	if err := w.db.Sync(); err != nil {
+		return err
+	}
+	if err := w.truncate(); err != nil {
+		w.cmu.Lock()
+		w.err = err
+		w.cmu.Unlock()
+		return err
+	}
+	// All records are now in the synchronized database.
+	w.cmu.Lock()
+	if w.applied > w.durable {
+		w.durable = w.applied
+	}
+	w.cond.Broadcast()
+	w.cmu.Unlock()
+	return nil
+}
+
+// Checkpoint synchronizes the database with its disk file and truncates
+// the log.
+func (w *DB) Checkpoint() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return gdbm.ErrNotOpen
+	}
+	if w.log == nil {
+		return nil
+	}
+	return w.checkpoint()
+}
+
+// Sync is the same as Checkpoint.
+func (w *DB) Sync() error {
+	return w.Checkpoint()
+}
+
+// Store the value for the key.  See gdbm.Database.Store.
+func (w *DB) Store(key []byte, value []byte, replace bool) error {
+	var check func() error
+	if !replace {
+		check = func() error {
+			if w.db.Exists(key) {
+				return gdbm.ErrCannotReplace
+			}
+			return nil
+		}
+	}
+	return w.commit(appendOp(nil, opPut, key, value), gdbm.ErrReaderCantStore, check)
+}
+
+// Delete the key.
+func (w *DB) Delete(key []byte) error {
+	return w.commit(appendOp(nil, opDelete, key, nil), gdbm.ErrReaderCantDelete, func() error {
+		if !w.db.Exists(key) {
+			return gdbm.ErrItemNotFound
+		}
+		return nil
+	})
+}
+
+// Batch collects updates to be logged and applied as a unit.
+type Batch struct {
+	payload []byte
+	n int
+}
+
+// Put adds storing the value for the key to the batch.  Existing keys are
+// replaced.
+func (b *Batch) Put(key, value []byte) {
+	b.payload = appendOp(b.payload, opPut, key, value)
+	b.n++
+}
+
+// Delete adds deleting the key to the batch.  Deleting a missing key is
+// not an error.
+func (b *Batch) Delete(key []byte) {
+	b.payload = appendOp(b.payload, opDelete, key, nil)
+	b.n++
+}
+
+// Len returns the number of updates in the batch.
+func (b *Batch) Len() int {
+	return b.n
+}
+
+// Reset removes all updates from the batch.
+func (b *Batch) Reset() {
+	b.payload = b.payload[:0]
+	b.n = 0
+}
+
+// Write logs the updates from the batch in a single record and applies
+// them in a transaction (see gdbm.Database.Update).  After a crash,
+// either all of them are replayed or none.
+func (w *DB) Write(b *Batch) error {
+	if b.n == 0 {
+		return nil
+	}
+	return w.commit(append([]byte{}, b.payload...), gdbm.ErrReaderCantStore, nil)
+}
+
+// Fetch returns the value of the key.
+func (w *DB) Fetch(key []byte) ([]byte, error) {
+	return w.db.Fetch(key)
+}
+
+// Exists returns true if the key exists.
+func (w *DB) Exists(key []byte) bool {
+	return w.db.Exists(key)
+}
+
+// Count returns the number of keys.
+func (w *DB) Count() (uint, error) {
+	return w.db.Count()
+}
+
+// Iterator returns an iterator over all keys.  See gdbm.Database.Iterator.
+func (w *DB) Iterator() gdbm.DatabaseIterator {
+	return w.db.Iterator()
+}
+
+// Close makes a checkpoint and closes the database and the log.
+func (w *DB) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return gdbm.ErrNotOpen
+	}
+	w.closed = true
+	var err error
+	if w.log != nil {
+		err = w.checkpoint()
+		if e := w.log.Close(); err == nil {
+			err = e
+		}
+	}
+	if e := w.db.Close(); err == nil {
+		err = e
+	}
+	return err
+}
@@ -0,0 +1,318 @@
+package wal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"github.com/graygnuorg/go-gdbm"
+	"github.com/graygnuorg/go-gdbm/format"
+	"github.com/graygnuorg/go-gdbm/kvtest"
+)
+
+func config(name string, mode int) Config {
+	return Config{Database: gdbm.DatabaseConfig{FileName: name, Mode: mode, FileMode: 0600}}
+}
+
+func open(t *testing.T, cfg Config) *DB {
+	t.Helper()
+	w, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestConformance(t *testing.T) {
+	kvtest.Run(t, func(t *testing.T, records map[string]string, readOnly bool) gdbm.KV {
+		name := filepath.Join(t.TempDir(), "junk.gdbm")
+		w := open(t, config(name, gdbm.ModeNewdb))
+		for k, v := range records {
+			if err := w.Store([]byte(k), []byte(v), false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if readOnly {
+			w.Close()
+			w = open(t, config(name, gdbm.ModeReader))
+		}
+		return w
+	})
+}
+
+// Simulate a crash: the log is left as is, and the database file is
+// restored to the state saved by the last checkpoint.
+type crash struct {
+	name string
+	data []byte
+}
+
+func checkpoint(t *testing.T, w *DB, name string) *crash {
+	t.Helper()
+	if err := w.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &crash{name: name, data: data}
+}
+
+func (c *crash) crash(t *testing.T, w *DB) {
+	t.Helper()
+	w.log.Close()
+	w.db.Close()
+	if err := os.WriteFile(c.name, c.data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "junk.gdbm")
+	w := open(t, config(name, gdbm.ModeNewdb))
+	for i := 0; i < 10; i++ {
+		w.Store([]byte("key" + strconv.Itoa(i)), []byte(strconv.Itoa(i)), true)
+	}
+	c := checkpoint(t, w, name)
+
+	w.Store([]byte("key10"), []byte("10"), false)
+	w.Store([]byte("key1"), []byte("one"), true)
+	w.Delete([]byte("key2"))
+	var b Batch
+	b.Put([]byte("key11"), []byte("11"))
+	b.Delete([]byte("key3"))
+	b.Delete([]byte("missing"))
+	if err := w.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	c.crash(t, w)
+
+	// Without the log, the updates are lost.
+	db, err := gdbm.Open(name, gdbm.ModeReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Exists([]byte("key10")) {
+		t.Fatal("crash simulation failed")
+	}
+	db.Close()
+
+	if _, err := Open(config(name, gdbm.ModeReader)); err != ErrReplayNeeded {
+		t.Errorf("Open in reader mode returned %v", err)
+	}
+
+	w = open(t, config(name, gdbm.ModeWriter))
+	defer w.Close()
+	if w.Replayed() != 4 {
+		t.Errorf("replayed %d records", w.Replayed())
+	}
+	for key, value := range map[string]string{"key10": "10", "key1": "one", "key11": "11", "key4": "4"} {
+		if v, err := w.Fetch([]byte(key)); err != nil || string(v) != value {
+			t.Errorf("%s: got %q, %v", key, v, err)
+		}
+	}
+	if w.Exists([]byte("key2")) || w.Exists([]byte("key3")) {
+		t.Error("deleted keys exist")
+	}
+	if n, _ := w.Count(); n != 10 {
+		t.Errorf("expected 10 keys, got %d", n)
+	}
+	if st, _ := os.Stat(name + LogSuffix); st.Size() != int64(len(logMagic)) {
+		t.Errorf("log not truncated: %d bytes", st.Size())
+	}
+}
+
+func TestTornRecord(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "junk.gdbm")
+	w := open(t, config(name, gdbm.ModeNewdb))
+	c := checkpoint(t, w, name)
+	w.Store([]byte("a"), []byte("1"), true)
+	w.Store([]byte("b"), []byte("2"), true)
+	c.crash(t, w)
+
+	// Cut the last record in half.
+	logname := name + LogSuffix
+	st, _ := os.Stat(logname)
+	if err := os.Truncate(logname, st.Size() - 3); err != nil {
+		t.Fatal(err)
+	}
+	w = open(t, config(name, gdbm.ModeWriter))
+	defer w.Close()
+	if w.Replayed() != 1 || !w.Exists([]byte("a")) || w.Exists([]byte("b")) {
+		t.Errorf("replayed %d records", w.Replayed())
+	}
+}
+
+func TestDamagedDatabase(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "junk.gdbm")
+	w := open(t, config(name, gdbm.ModeNewdb))
+	for i := 0; i < 1000; i++ {
+		w.Store([]byte("key" + strconv.Itoa(i)), []byte(strconv.Itoa(i)), true)
+	}
+	c := checkpoint(t, w, name)
+	w.Store([]byte("a"), []byte("1"), true)
+	c.crash(t, w)
+
+	// Damage a key outside the bucket updated by the log record.
+	f, err := format.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := f.Dir[format.Hash([]byte("a")) >> uint(format.HashBits - f.Header.DirBits)]
+	var off int64
+	for _, addr := range f.BucketAddrs() {
+		if addr == used {
+			continue
+		}
+		b, err := f.ReadBucket(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range b.Table {
+			if e.InUse() {
+				off = e.DataPointer
+				break
+			}
+		}
+		break
+	}
+	f.Close()
+	if off == 0 {
+		t.Fatal("no suitable bucket")
+	}
+	fd, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.WriteAt([]byte{'#'}, off)
+	fd.Close()
+
+	logname := name + LogSuffix
+	st, _ := os.Stat(logname)
+	if _, err := Open(config(name, gdbm.ModeWriter)); !errors.Is(err, gdbm.ErrNeedRecovery) {
+		t.Fatalf("Open returned %v", err)
+	}
+	if nst, _ := os.Stat(logname); nst.Size() != st.Size() {
+		t.Error("log modified")
+	}
+}
+
+func TestApplyFailure(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "junk.gdbm")
+	w := open(t, config(name, gdbm.ModeNewdb))
+	size := w.size
+	// Make applying updates fail.
+	w.db.Close()
+	if err := w.Store([]byte("a"), []byte("1"), true); !errors.Is(err, gdbm.ErrNotOpen) {
+		t.Errorf("Store returned %v", err)
+	}
+	if st, _ := os.Stat(name + LogSuffix); st.Size() != size || w.size != size {
+		t.Errorf("record not removed from the log: %d bytes, expected %d", st.Size(), size)
+	}
+	w.log.Close()
+}
+
+func TestSyncFailure(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "junk.gdbm")
+	w := open(t, config(name, gdbm.ModeNewdb))
+	if err := w.Store([]byte("a"), []byte("1"), true); err != nil {
+		t.Fatal(err)
+	}
+	size := w.size
+
+	errSync := errors.New("sync failed")
+	logSync = func(f *os.File) error {
+		if w.Exists([]byte("b")) {
+			t.Error("update applied before the log was flushed")
+		}
+		return errSync
+	}
+	defer func() {
+		logSync = (*os.File).Sync
+	}()
+	if err := w.Store([]byte("b"), []byte("2"), true); err != errSync {
+		t.Errorf("Store returned %v", err)
+	}
+	if w.Exists([]byte("b")) {
+		t.Error("failed update applied")
+	}
+	if st, _ := os.Stat(name + LogSuffix); st.Size() != size {
+		t.Errorf("record not removed from the log: %d bytes, expected %d", st.Size(), size)
+	}
+	if err := w.Delete([]byte("a")); err != errSync {
+		t.Errorf("Delete returned %v", err)
+	}
+
+	// The failed update is neither persisted nor replayed.
+	logSync = (*os.File).Sync
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	w = open(t, config(name, gdbm.ModeReader))
+	defer w.Close()
+	if !w.Exists([]byte("a")) || w.Exists([]byte("b")) {
+		t.Error("unexpected database contents")
+	}
+}
+
+func TestNewdbTruncates(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "junk.gdbm")
+	w := open(t, config(name, gdbm.ModeNewdb))
+	c := checkpoint(t, w, name)
+	w.Store([]byte("a"), []byte("1"), true)
+	c.crash(t, w)
+
+	w = open(t, config(name, gdbm.ModeNewdb))
+	defer w.Close()
+	if w.Replayed() != 0 || w.Exists([]byte("a")) {
+		t.Error("log replayed into new database")
+	}
+}
+
+func TestBadLog(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "junk.gdbm")
+	if err := os.WriteFile(name + LogSuffix, []byte("not a log file"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(config(name, gdbm.ModeWrcreat)); err != ErrBadLog {
+		t.Errorf("Open returned %v", err)
+	}
+}
+
+func TestGroupCommit(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "junk.gdbm")
+	cfg := config(name, gdbm.ModeNewdb)
+	cfg.GroupCommitDelay = time.Millisecond
+	cfg.CheckpointSize = 1024
+	w := open(t, cfg)
+	defer w.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				key := []byte(strconv.Itoa(i) + "/" + strconv.Itoa(j))
+				if err := w.Store(key, key, false); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n, _ := w.Count(); n != 400 {
+		t.Errorf("expected 400 keys, got %d", n)
+	}
+	if w.size > cfg.CheckpointSize {
+		t.Errorf("log size %d exceeds checkpoint size", w.size)
+	}
+	if err := w.Store([]byte("0/0"), nil, false); !errors.Is(err, gdbm.ErrCannotReplace) {
+		t.Errorf("Store returned %v", err)
+	}
+}